@@ -2,17 +2,45 @@ package acceptRefuse
 
 import (
 	"context"
-	"github.com/Seriyin/GiveMeBackend/config/firebase"
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/deadletter"
 	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
-	"log"
+	"github.com/Seriyin/GiveMeBackend/config/logging"
+	"github.com/Seriyin/GiveMeBackend/config/services"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
 )
 
-var db = firebase.GetDB()
+// Handler reacts to group members accepting or refusing.
+type Handler struct {
+	DB datastore.GiveMeDatabase
+}
+
+// NewHandler builds a Handler over the services of c.
+func NewHandler(c *services.Container) (*Handler, error) {
+	db, err := c.DB()
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{DB: db}, nil
+}
+
+// NewTrigger builds the handler AcceptanceOrRefusal runs over the services of c.
+func NewTrigger(c *services.Container) (trigger.Handler, error) {
+	h, err := NewHandler(c)
+	if err != nil {
+		return nil, err
+	}
+	return h.AcceptanceOrRefusal, nil
+}
+
+// AcceptanceOrRefusal is the deployed entry point, over the default services.
+var AcceptanceOrRefusal = deadletter.Entry("acceptRefuse", NewTrigger)
 
-func AcceptanceOrRefusal(
+func (h *Handler) AcceptanceOrRefusal(
 	ctx context.Context,
 	e firestore.Event,
 ) error {
-	log.Printf(e.Value.Name)
+	ctx = logging.ForEvent(ctx, "acceptRefuse", e.Value.Name)
+	logging.Info(ctx, "Group member answered")
 	return nil
 }
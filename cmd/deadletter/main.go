@@ -0,0 +1,150 @@
+// Command deadletter lists, inspects, edits and replays the events
+// the functions gave up on, reporting as JSON on stdout:
+//
+//	deadletter list [-status dead|retrying|resolved|all]
+//	deadletter show <id>
+//	deadletter payload <id> > event.json
+//	deadletter edit <id> < event.json
+//	deadletter replay <id>
+//
+// Replays run through the same handlers the functions run, under the
+// original event id. Credentials are taken from the environment.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/Seriyin/GiveMeBackend/acceptRefuse"
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/deadletter"
+	"github.com/Seriyin/GiveMeBackend/config/services"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
+	"github.com/Seriyin/GiveMeBackend/confirm"
+	"github.com/Seriyin/GiveMeBackend/dispatch"
+	"github.com/Seriyin/GiveMeBackend/division"
+	"github.com/Seriyin/GiveMeBackend/membership"
+	"github.com/Seriyin/GiveMeBackend/phoneChange"
+	"github.com/Seriyin/GiveMeBackend/register"
+	"github.com/Seriyin/GiveMeBackend/remind"
+	"github.com/Seriyin/GiveMeBackend/request"
+)
+
+// handlers build the handler of each function,
+// by the name it dead-letters events under.
+var handlers = map[string]func(c *services.Container) (trigger.Handler, error){
+	"request":      request.NewTrigger,
+	"confirm":      confirm.NewTrigger,
+	"division":     division.NewTrigger,
+	"membership":   membership.NewTrigger,
+	"acceptRefuse": acceptRefuse.NewTrigger,
+	"register":     register.NewTrigger,
+	"remind":       remind.NewTrigger,
+	"phoneChange":  phoneChange.NewTrigger,
+	"dispatch":     dispatch.NewTrigger,
+}
+
+func main() {
+	status := flag.String(
+		"status",
+		datastore.DeadLetterDead,
+		"status of the letters listed, or all",
+	)
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: deadletter [-status s] list | show id | payload id | edit id | replay id")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 || (args[0] != "list" && len(args) != 2) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	c := services.Default()
+	db, err := c.DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "list":
+		if *status == "all" {
+			*status = ""
+		}
+		letters, err := db.ListDeadLetters(ctx, *status)
+		if err != nil {
+			log.Fatal(err)
+		}
+		report(letters)
+	case "show":
+		letter, err := db.GetDeadLetter(ctx, args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		report(letter)
+	case "payload":
+		letter, err := db.GetDeadLetter(ctx, args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		var out bytes.Buffer
+		if err := json.Indent(&out, []byte(letter.Payload), "", "  "); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(out.String())
+	case "edit":
+		payload, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, payload); err != nil {
+			log.Fatalf("deadletter: malformed payload: %v", err)
+		}
+		letter, err := deadletter.Edit(ctx, db, args[1], compact.Bytes())
+		if err != nil {
+			log.Fatal(err)
+		}
+		report(letter)
+	case "replay":
+		letter, err := db.GetDeadLetter(ctx, args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		build, ok := handlers[letter.Handler]
+		if !ok {
+			log.Fatalf("deadletter: no handler %v", letter.Handler)
+		}
+		h, err := build(c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		letter, err = deadletter.Replay(ctx, db, letter.Id, h)
+		if letter != nil {
+			report(letter)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func report(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,24 @@
+module github.com/Seriyin/GiveMeBackend/cmd/devserver
+
+require (
+	github.com/Seriyin/GiveMeBackend/acceptRefuse v0.0.0
+	github.com/Seriyin/GiveMeBackend/config v0.0.0-20190213115352-2bf309bf9f90
+	github.com/Seriyin/GiveMeBackend/confirm v0.0.0
+	github.com/Seriyin/GiveMeBackend/division v0.0.0
+	github.com/Seriyin/GiveMeBackend/membership v0.0.0
+	github.com/Seriyin/GiveMeBackend/register v0.0.0
+	github.com/Seriyin/GiveMeBackend/remind v0.0.0
+	github.com/Seriyin/GiveMeBackend/request v0.0.0
+)
+
+// Hosts the functions as they are in the tree.
+replace (
+	github.com/Seriyin/GiveMeBackend/acceptRefuse => ../../acceptRefuse
+	github.com/Seriyin/GiveMeBackend/config => ../../config
+	github.com/Seriyin/GiveMeBackend/confirm => ../../confirm
+	github.com/Seriyin/GiveMeBackend/division => ../../division
+	github.com/Seriyin/GiveMeBackend/membership => ../../membership
+	github.com/Seriyin/GiveMeBackend/register => ../../register
+	github.com/Seriyin/GiveMeBackend/remind => ../../remind
+	github.com/Seriyin/GiveMeBackend/request => ../../request
+)
@@ -0,0 +1,113 @@
+// Command devserver hosts the functions on a laptop, over the in-memory
+// datastore and a recording notifier. Writing a document fires the
+// functions whose triggers match it, as deployed:
+//
+//	devserver -addr localhost:8080
+//	curl -X PUT localhost:8080/documents/Profiles/b -d '{"phone":{"stringValue":"+351366366366"}}'
+//	curl -X PUT localhost:8080/documents/MonetaryRequests/a/2019-02/s1 -d @config/firebase/firestore/example.json
+//	curl -X PUT localhost:8080/documents/Devices/b/Tokens/t1 -d '{"idToken":{"stringValue":"b"},"platform":{"stringValue":"android"}}'
+//	curl localhost:8080/events
+//	curl localhost:8080/notifications
+//
+// See devserver.Server for every endpoint.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/Seriyin/GiveMeBackend/acceptRefuse"
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/devserver"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
+	"github.com/Seriyin/GiveMeBackend/config/services"
+	"github.com/Seriyin/GiveMeBackend/confirm"
+	"github.com/Seriyin/GiveMeBackend/division"
+	"github.com/Seriyin/GiveMeBackend/membership"
+	"github.com/Seriyin/GiveMeBackend/register"
+	"github.com/Seriyin/GiveMeBackend/remind"
+	"github.com/Seriyin/GiveMeBackend/request"
+)
+
+var routes = []devserver.Route{
+	{
+		Pattern: "Devices/{uid}/Tokens/{token}",
+		Kind:    devserver.Create,
+		Name:    "Register",
+		Handler: register.Register,
+	},
+	{
+		Pattern: "Devices/{uid}/Tokens/{token}",
+		Kind:    devserver.Update,
+		Name:    "Register",
+		Handler: register.Register,
+	},
+	{
+		Pattern: "MonetaryRequests/{uid}/{month}/{snowflake}",
+		Kind:    devserver.Create,
+		Name:    "Request",
+		Handler: request.Request,
+	},
+	{
+		Pattern: "MonetaryRequests/{uid}/{month}/{snowflake}",
+		Kind:    devserver.Update,
+		Name:    "Confirm",
+		Handler: confirm.Confirm,
+	},
+	{
+		Pattern: "GroupRequests/{uid}/{month}/{snowflake}",
+		Kind:    devserver.Create,
+		Name:    "Division",
+		Handler: division.Division,
+	},
+	{
+		Pattern: "GroupRequests/{uid}/{month}/{snowflake}",
+		Kind:    devserver.Update,
+		Name:    "AcceptanceOrRefusal",
+		Handler: acceptRefuse.AcceptanceOrRefusal,
+	},
+	{
+		Pattern: "Groups/{groupId}",
+		Kind:    devserver.Create,
+		Name:    "Membership",
+		Handler: membership.Membership,
+	},
+	{
+		Pattern: "Groups/{groupId}",
+		Kind:    devserver.Update,
+		Name:    "Membership",
+		Handler: membership.Membership,
+	},
+	{
+		Pattern: "Reminders/{uid}/{snowflake}",
+		Kind:    devserver.Create,
+		Name:    "Remind",
+		Handler: remind.Remind,
+	},
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to listen on")
+	flag.Parse()
+
+	// The functions take their services from the default container,
+	// so swapping it in before serving keeps every one of them local.
+	var s *devserver.Server
+	db := datastore.NewObservedMemoryDB(func(
+		fullPath string,
+		transfer *datastore.MonetaryRequest,
+	) {
+		s.Observe(fullPath, transfer)
+	})
+	notifier := &messaging.RecordingNotifier{}
+	services.SetDefault(services.New(services.Config{
+		DB:       db,
+		Notifier: notifier,
+		Users:    devserver.Users{DB: db},
+	}))
+	s = devserver.New(db, notifier, routes)
+
+	log.Printf("devserver: listening on %v", *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
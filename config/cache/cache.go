@@ -0,0 +1,282 @@
+// Package cache keeps the profiles a database looks up, by id and by
+// phone number, so handlers resolving the same users again, as
+// division does once per member, reach the database once.
+//
+// Entries live for a bounded time, the least recently used going
+// first when the cache is full. Writes through the cache drop the
+// profiles they touch, others are seen once entries expire.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+// Defaults for the cache of the deployed functions.
+const (
+	DefaultSize = 1024
+	DefaultTTL  = time.Minute
+)
+
+// Ensure Database conforms to the GiveMeDatabase interface.
+var _ datastore.GiveMeDatabase = &Database{}
+
+// Database caches the profiles of the database it wraps,
+// every other method is the wrapped one.
+type Database struct {
+	datastore.GiveMeDatabase
+	// Now is the clock entries expire by.
+	Now func() time.Time
+
+	size  int
+	ttl   time.Duration
+	mutex sync.Mutex
+	// lru holds entries, most recently used first.
+	lru   *list.List
+	byId  map[string]*list.Element
+	phone map[string]string
+}
+
+type entry struct {
+	profile *datastore.Profile
+	expires time.Time
+}
+
+// New caches up to size profiles of db, each for ttl.
+func New(
+	db datastore.GiveMeDatabase,
+	size int,
+	ttl time.Duration,
+) *Database {
+	return &Database{
+		GiveMeDatabase: db,
+		Now:            time.Now,
+		size:           size,
+		ttl:            ttl,
+		lru:            list.New(),
+		byId:           map[string]*list.Element{},
+		phone:          map[string]string{},
+	}
+}
+
+// get is the cached profile of id, caller must hold the mutex.
+func (db *Database) get(id string) *datastore.Profile {
+	e, ok := db.byId[id]
+	if !ok {
+		return nil
+	}
+	if db.Now().After(e.Value.(*entry).expires) {
+		db.remove(id)
+		return nil
+	}
+	db.lru.MoveToFront(e)
+	return e.Value.(*entry).profile
+}
+
+// getByPhone is the cached profile phoneNumber resolved to,
+// caller must hold the mutex.
+func (db *Database) getByPhone(phoneNumber string) *datastore.Profile {
+	id, ok := db.phone[phoneNumber]
+	if !ok {
+		return nil
+	}
+	return db.get(id)
+}
+
+// put caches profile, as resolved from phoneNumbers,
+// caller must hold the mutex.
+func (db *Database) put(
+	profile *datastore.Profile,
+	phoneNumbers ...string,
+) {
+	if db.size <= 0 || profile.Id == "" {
+		return
+	}
+	db.remove(profile.Id)
+	db.byId[profile.Id] = db.lru.PushFront(&entry{
+		profile: copyProfile(profile),
+		expires: db.Now().Add(db.ttl),
+	})
+	for _, phoneNumber := range append(phoneNumbers, profile.Phone) {
+		if phoneNumber != "" {
+			db.phone[phoneNumber] = profile.Id
+		}
+	}
+	for db.lru.Len() > db.size {
+		db.remove(db.lru.Back().Value.(*entry).profile.Id)
+	}
+}
+
+// remove drops the profile of id, and the numbers resolving to it,
+// caller must hold the mutex.
+func (db *Database) remove(id string) {
+	e, ok := db.byId[id]
+	if !ok {
+		return
+	}
+	db.lru.Remove(e)
+	delete(db.byId, id)
+	for phoneNumber, owner := range db.phone {
+		if owner == id {
+			delete(db.phone, phoneNumber)
+		}
+	}
+}
+
+// Invalidate drops the profile of id, so it is next read from the database.
+func (db *Database) Invalidate(id string) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.remove(id)
+}
+
+// copyProfile copies p deep enough that neither the cache
+// nor its callers see each other's changes.
+func copyProfile(p *datastore.Profile) *datastore.Profile {
+	copied := *p
+	copied.Device = append([]byte(nil), p.Device...)
+	copied.PubKey = append([]byte(nil), p.PubKey...)
+	copied.PreviousPhones = append([]string(nil), p.PreviousPhones...)
+	copied.Devices = append([]datastore.Device(nil), p.Devices...)
+	copied.PaymentProviders = append([]datastore.PaymentProvider(nil), p.PaymentProviders...)
+	return &copied
+}
+
+// GetProfile retrieves a profile by its ID, cached.
+func (db *Database) GetProfile(
+	ctx context.Context,
+	userId string,
+) (*datastore.Profile, error) {
+	db.mutex.Lock()
+	cached := db.get(userId)
+	db.mutex.Unlock()
+	if cached != nil {
+		return copyProfile(cached), nil
+	}
+
+	profile, err := db.GiveMeDatabase.GetProfile(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	db.mutex.Lock()
+	db.put(profile)
+	db.mutex.Unlock()
+	return profile, nil
+}
+
+// GetProfileByPhoneNumber retrieves a profile by its phone number, cached.
+func (db *Database) GetProfileByPhoneNumber(
+	ctx context.Context,
+	phoneNumber string,
+) (*datastore.Profile, error) {
+	db.mutex.Lock()
+	cached := db.getByPhone(phoneNumber)
+	db.mutex.Unlock()
+	if cached != nil {
+		return copyProfile(cached), nil
+	}
+
+	profile, err := db.GiveMeDatabase.GetProfileByPhoneNumber(ctx, phoneNumber)
+	if err != nil {
+		return nil, err
+	}
+	db.mutex.Lock()
+	db.put(profile, phoneNumber)
+	db.mutex.Unlock()
+	return profile, nil
+}
+
+// GetProfileIdByPhoneNumber retrieves a profile's Id by its phone number,
+// caching the whole profile.
+func (db *Database) GetProfileIdByPhoneNumber(
+	ctx context.Context,
+	phoneNumber string,
+) (string, error) {
+	profile, err := db.GetProfileByPhoneNumber(ctx, phoneNumber)
+	if err != nil {
+		return "", err
+	}
+	return profile.Id, nil
+}
+
+// GetProfilesByPhoneNumbers retrieves the profiles of many phone numbers,
+// asking the database at once for those not cached.
+func (db *Database) GetProfilesByPhoneNumbers(
+	ctx context.Context,
+	phoneNumbers []string,
+) (map[string]*datastore.Profile, error) {
+	profiles := make(map[string]*datastore.Profile, len(phoneNumbers))
+	var missing []string
+	db.mutex.Lock()
+	for _, phoneNumber := range phoneNumbers {
+		if cached := db.getByPhone(phoneNumber); cached != nil {
+			profiles[phoneNumber] = copyProfile(cached)
+		} else {
+			missing = append(missing, phoneNumber)
+		}
+	}
+	db.mutex.Unlock()
+	if len(missing) == 0 {
+		return profiles, nil
+	}
+
+	found, err := db.GiveMeDatabase.GetProfilesByPhoneNumbers(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	for phoneNumber, profile := range found {
+		db.put(profile, phoneNumber)
+		profiles[phoneNumber] = profile
+	}
+	return profiles, nil
+}
+
+// Writes drop the profiles they touch, whether or not they succeed.
+
+func (db *Database) DeleteProfile(
+	ctx context.Context,
+	userId string,
+) error {
+	defer db.Invalidate(userId)
+	return db.GiveMeDatabase.DeleteProfile(ctx, userId)
+}
+
+func (db *Database) UpdateProfile(
+	ctx context.Context,
+	p *datastore.Profile,
+) error {
+	defer db.Invalidate(p.Id)
+	return db.GiveMeDatabase.UpdateProfile(ctx, p)
+}
+
+func (db *Database) RegenProfile(
+	ctx context.Context,
+	p *datastore.Profile,
+) error {
+	defer db.Invalidate(p.Id)
+	return db.GiveMeDatabase.RegenProfile(ctx, p)
+}
+
+func (db *Database) RegisterDevice(
+	ctx context.Context,
+	userId string,
+	device datastore.Device,
+) error {
+	defer db.Invalidate(userId)
+	return db.GiveMeDatabase.RegisterDevice(ctx, userId, device)
+}
+
+func (db *Database) RemoveDeviceToken(
+	ctx context.Context,
+	userId string,
+	token string,
+) error {
+	defer db.Invalidate(userId)
+	return db.GiveMeDatabase.RemoveDeviceToken(ctx, userId, token)
+}
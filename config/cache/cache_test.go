@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/datastore/datastoretest"
+)
+
+// countingDB counts the profile lookups reaching the database.
+type countingDB struct {
+	datastore.GiveMeDatabase
+	lookups int
+}
+
+func (db *countingDB) GetProfile(
+	ctx context.Context,
+	userId string,
+) (*datastore.Profile, error) {
+	db.lookups++
+	return db.GiveMeDatabase.GetProfile(ctx, userId)
+}
+
+func (db *countingDB) GetProfileByPhoneNumber(
+	ctx context.Context,
+	phoneNumber string,
+) (*datastore.Profile, error) {
+	db.lookups++
+	return db.GiveMeDatabase.GetProfileByPhoneNumber(ctx, phoneNumber)
+}
+
+func (db *countingDB) GetProfilesByPhoneNumbers(
+	ctx context.Context,
+	phoneNumbers []string,
+) (map[string]*datastore.Profile, error) {
+	db.lookups++
+	return db.GiveMeDatabase.GetProfilesByPhoneNumbers(ctx, phoneNumbers)
+}
+
+func setup(t *testing.T, size int) (*countingDB, *Database, *time.Time) {
+	ctx := context.Background()
+	memory := datastore.NewMemoryDB()
+	datastoretest.AddProfiles(t, ctx, memory,
+		datastore.UID{Id: "a", Phone: "+351111111111", PreviousPhones: []string{"+351100000000"}},
+		datastore.UID{Id: "b", Phone: "+351222222222"},
+		datastore.UID{Id: "c", Phone: "+351333333333"},
+	)
+	counting := &countingDB{GiveMeDatabase: memory}
+	db := New(counting, size, time.Minute)
+	now := time.Date(2019, 2, 13, 0, 0, 0, 0, time.UTC)
+	db.Now = func() time.Time { return now }
+	return counting, db, &now
+}
+
+func TestCachesByIdAndPhone(t *testing.T) {
+	ctx := context.Background()
+	counting, db, now := setup(t, 10)
+
+	p, err := db.GetProfileByPhoneNumber(ctx, "+351100000000")
+	if err != nil || p.Id != "a" {
+		t.Fatal(p, err)
+	}
+	// Cached by id, by the number asked for and by the current one.
+	db.GetProfile(ctx, "a")
+	db.GetProfileByPhoneNumber(ctx, "+351100000000")
+	if id, _ := db.GetProfileIdByPhoneNumber(ctx, "+351111111111"); id != "a" {
+		t.Error(id)
+	}
+	if counting.lookups != 1 {
+		t.Error(counting.lookups)
+	}
+
+	// Callers changing a profile do not change the cached one.
+	p.PreviousPhones[0] = "+351999999999"
+	if p, _ := db.GetProfile(ctx, "a"); p.PreviousPhones[0] != "+351100000000" {
+		t.Error(p.PreviousPhones)
+	}
+
+	*now = now.Add(time.Minute + time.Second)
+	db.GetProfile(ctx, "a")
+	if counting.lookups != 2 {
+		t.Error("expired entry was served", counting.lookups)
+	}
+
+	// Lookups finding nothing are not cached.
+	for i := 0; i < 2; i++ {
+		if _, err := db.GetProfileByPhoneNumber(ctx, "+351444444444"); !errors.Is(err, datastore.ErrNotFound) {
+			t.Error(err)
+		}
+	}
+	if counting.lookups != 4 {
+		t.Error(counting.lookups)
+	}
+}
+
+func TestEvictsAndInvalidates(t *testing.T) {
+	ctx := context.Background()
+	counting, db, _ := setup(t, 2)
+
+	db.GetProfile(ctx, "a")
+	db.GetProfile(ctx, "b")
+	db.GetProfile(ctx, "a")
+	db.GetProfile(ctx, "c") // evicts b, the least recently used
+	db.GetProfile(ctx, "a")
+	if counting.lookups != 3 {
+		t.Error(counting.lookups)
+	}
+	db.GetProfileByPhoneNumber(ctx, "+351222222222")
+	if counting.lookups != 4 {
+		t.Error("evicted entry was served", counting.lookups)
+	}
+
+	p, _ := db.GetProfile(ctx, "a")
+	p.Name = "Ana"
+	if err := db.UpdateProfile(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := db.GetProfile(ctx, "a"); p.Name != "Ana" {
+		t.Error("stale profile after update", p.Name)
+	}
+	db.RegisterDevice(ctx, "a", datastore.Device{Token: "t"})
+	if p, _ := db.GetProfile(ctx, "a"); len(p.Devices) != 1 {
+		t.Error("stale profile after registering a device", p.Devices)
+	}
+}
+
+func TestGetProfilesByPhoneNumbers(t *testing.T) {
+	ctx := context.Background()
+	counting, db, _ := setup(t, 10)
+
+	db.GetProfile(ctx, "a")
+	profiles, err := db.GetProfilesByPhoneNumbers(ctx, []string{
+		"+351111111111",
+		"+351222222222",
+		"+351444444444",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 2 || profiles["+351111111111"].Id != "a" || profiles["+351222222222"].Id != "b" {
+		t.Errorf("%+v", profiles)
+	}
+	// Only the numbers not cached are asked for, in one call.
+	if counting.lookups != 2 {
+		t.Error(counting.lookups)
+	}
+	db.GetProfileByPhoneNumber(ctx, "+351222222222")
+	if counting.lookups != 2 {
+		t.Error(counting.lookups)
+	}
+}
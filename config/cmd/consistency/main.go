@@ -0,0 +1,57 @@
+// Command consistency reports creditor and debtor copies of requests
+// that disagree, as JSON on stdout, and optionally repairs them.
+//
+//	consistency [-repair creditor|recent]
+//
+// Credentials are taken from the environment, as for the functions.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/Seriyin/GiveMeBackend/config/consistency"
+	"github.com/Seriyin/GiveMeBackend/config/services"
+)
+
+func main() {
+	repair := flag.String(
+		"repair",
+		"",
+		"repair findings, with the creditor's or the most recent copy winning mismatches",
+	)
+	flag.Parse()
+
+	var rule consistency.Rule
+	if *repair != "" {
+		var err error
+		rule, err = consistency.ParseRule(*repair)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	db, err := services.Default().DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	report, err := consistency.Check(ctx, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if rule != "" {
+		consistency.Repair(ctx, db, report, rule)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,48 @@
+// Command migrate moves request copies written under the legacy
+// MonetaryRequest root to MonetaryRequests, reporting as JSON on stdout.
+//
+//	migrate [-dry]
+//
+// Credentials are taken from the environment, as for the functions.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/Seriyin/GiveMeBackend/config/firebase/schema"
+	"github.com/Seriyin/GiveMeBackend/config/migrate"
+	"github.com/Seriyin/GiveMeBackend/config/services"
+)
+
+func main() {
+	dry := flag.Bool("dry", false, "only list what would be moved")
+	flag.Parse()
+
+	ctx := context.Background()
+	db, err := services.Default().DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	report, err := migrate.Run(
+		ctx,
+		db,
+		schema.LegacyMonetaryRequests,
+		schema.MonetaryRequests,
+		*dry,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,267 @@
+// Package consistency pairs the creditor's and the debtor's copies
+// of every request by snowflake, reporting and repairing copies
+// that disagree, lost their mirror or were written twice.
+package consistency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/paths"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/schema"
+)
+
+// Kinds of Finding.
+const (
+	// KindMismatch is a pair of copies disagreeing on some fields.
+	KindMismatch = "mismatch"
+	// KindOrphan is a copy whose registered counterparty holds no mirror.
+	KindOrphan = "orphan"
+	// KindDuplicate is a request stored more than once under one user.
+	KindDuplicate = "duplicate"
+	// KindStray is a copy under a user who is neither party.
+	// Strays are only reported, never repaired.
+	KindStray = "stray"
+)
+
+// Rule picks which copy wins a mismatch.
+type Rule string
+
+const (
+	CreditorWins   Rule = "creditor"
+	MostRecentWins Rule = "recent"
+)
+
+// ParseRule validates a rule given by name.
+func ParseRule(name string) (Rule, error) {
+	switch rule := Rule(name); rule {
+	case CreditorWins, MostRecentWins:
+		return rule, nil
+	}
+	return "", fmt.Errorf("consistency: unknown rule %q", name)
+}
+
+type Finding struct {
+	Kind      string `json:"kind"`
+	Snowflake string `json:"snowflake"`
+	Creditor  string `json:"creditor,omitempty"`
+	Debtor    string `json:"debtor,omitempty"`
+	// Fields the copies disagree on, for mismatches.
+	Fields []string `json:"fields,omitempty"`
+	// Missing is where the mirror of an orphan belongs.
+	Missing     string                             `json:"missing,omitempty"`
+	Copies      []*datastore.StoredMonetaryRequest `json:"copies"`
+	Repaired    bool                               `json:"repaired"`
+	RepairError string                             `json:"repairError,omitempty"`
+}
+
+type Report struct {
+	Owners   int        `json:"owners"`
+	Copies   int        `json:"copies"`
+	Findings []*Finding `json:"findings"`
+}
+
+// Check scans every MonetaryRequests/{uid}/{month} collection of db.
+func Check(
+	ctx context.Context,
+	db datastore.GiveMeDatabase,
+) (*Report, error) {
+	owners, err := db.ListMonetaryRequestOwners(ctx, schema.MonetaryRequests)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Owners: len(owners), Findings: []*Finding{}}
+	bySnowflake := make(map[string][]*datastore.StoredMonetaryRequest)
+	for _, owner := range owners {
+		stored, err := db.ListMonetaryRequests(ctx, schema.MonetaryRequests, owner)
+		if err != nil {
+			return nil, err
+		}
+		report.Copies += len(stored)
+		for _, s := range stored {
+			bySnowflake[s.Request.Snowflake] = append(bySnowflake[s.Request.Snowflake], s)
+		}
+	}
+
+	snowflakes := make([]string, 0, len(bySnowflake))
+	for snowflake := range bySnowflake {
+		snowflakes = append(snowflakes, snowflake)
+	}
+	sort.Strings(snowflakes)
+
+	ids := &idCache{db: db, ids: make(map[string]string)}
+	for _, snowflake := range snowflakes {
+		findings, err := checkPair(ctx, ids, snowflake, bySnowflake[snowflake])
+		if err != nil {
+			return nil, err
+		}
+		report.Findings = append(report.Findings, findings...)
+	}
+	return report, nil
+}
+
+func checkPair(
+	ctx context.Context,
+	ids *idCache,
+	snowflake string,
+	copies []*datastore.StoredMonetaryRequest,
+) ([]*Finding, error) {
+	var findings []*Finding
+	creditor, err := ids.get(ctx, copies[0].Request.From)
+	if err != nil {
+		return nil, err
+	}
+	debtor, err := ids.get(ctx, copies[0].Request.To)
+	if err != nil {
+		return nil, err
+	}
+
+	byOwner := make(map[string][]*datastore.StoredMonetaryRequest)
+	for _, c := range copies {
+		byOwner[ownerOf(c)] = append(byOwner[ownerOf(c)], c)
+	}
+	newFinding := func(kind string, copies ...*datastore.StoredMonetaryRequest) *Finding {
+		return &Finding{
+			Kind:      kind,
+			Snowflake: snowflake,
+			Creditor:  creditor,
+			Debtor:    debtor,
+			Copies:    copies,
+		}
+	}
+
+	owners := make([]string, 0, len(byOwner))
+	for owner := range byOwner {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+	for _, owner := range owners {
+		if len(byOwner[owner]) > 1 {
+			findings = append(findings, newFinding(KindDuplicate, byOwner[owner]...))
+		}
+		if owner != creditor && owner != debtor {
+			findings = append(findings, newFinding(KindStray, byOwner[owner]...))
+		}
+	}
+
+	creditorCopy := mostRecent(byOwner[creditor])
+	debtorCopy := mostRecent(byOwner[debtor])
+	switch {
+	case creditor == "" || debtor == "" || creditor == debtor:
+		// A party who never registered holds no copy to pair with.
+	case creditorCopy != nil && debtorCopy != nil:
+		if fields := diff(creditorCopy.Request, debtorCopy.Request); len(fields) > 0 {
+			f := newFinding(KindMismatch, creditorCopy, debtorCopy)
+			f.Fields = fields
+			findings = append(findings, f)
+		}
+	case creditorCopy != nil:
+		f := newFinding(KindOrphan, creditorCopy)
+		f.Missing = replaceOwner(creditorCopy.Path, debtor)
+		findings = append(findings, f)
+	case debtorCopy != nil:
+		f := newFinding(KindOrphan, debtorCopy)
+		f.Missing = replaceOwner(debtorCopy.Path, creditor)
+		findings = append(findings, f)
+	}
+	return findings, nil
+}
+
+// Repair fixes every repairable finding of report in place,
+// recording the outcome on each finding.
+func Repair(
+	ctx context.Context,
+	db datastore.GiveMeDatabase,
+	report *Report,
+	rule Rule,
+) {
+	for _, f := range report.Findings {
+		var err error
+		switch f.Kind {
+		case KindDuplicate:
+			keep := mostRecent(f.Copies)
+			for _, c := range f.Copies {
+				if c != keep && err == nil {
+					err = db.DeleteMonetaryRequestByFullPath(ctx, c.Path, f.Snowflake)
+				}
+			}
+		case KindMismatch:
+			winner, loser := f.Copies[0], f.Copies[1]
+			if rule == MostRecentWins && loser.Updated.After(winner.Updated) {
+				winner, loser = loser, winner
+			}
+			_, err = db.SetMonetaryRequestByFullPath(ctx, winner.Request, loser.Path)
+		case KindOrphan:
+			_, err = db.SetMonetaryRequestByFullPath(ctx, f.Copies[0].Request, f.Missing)
+		default:
+			continue
+		}
+		f.Repaired = err == nil
+		if err != nil {
+			f.RepairError = err.Error()
+		}
+	}
+}
+
+// diff names the fields, by their firestore tag, where a and b disagree.
+func diff(a *datastore.MonetaryRequest, b *datastore.MonetaryRequest) []string {
+	var fields []string
+	va := reflect.ValueOf(a).Elem()
+	vb := reflect.ValueOf(b).Elem()
+	for i := 0; i < va.NumField(); i++ {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			fields = append(fields, va.Type().Field(i).Tag.Get("firestore"))
+		}
+	}
+	return fields
+}
+
+func mostRecent(copies []*datastore.StoredMonetaryRequest) *datastore.StoredMonetaryRequest {
+	var recent *datastore.StoredMonetaryRequest
+	for _, c := range copies {
+		if recent == nil || c.Updated.After(recent.Updated) {
+			recent = c
+		}
+	}
+	return recent
+}
+
+// ownerOf extracts {Uid} from {Root}/{Uid}/{Date}.
+// ownerOf and replaceOwner drop parse errors,
+// listed paths are always well formed.
+func ownerOf(c *datastore.StoredMonetaryRequest) string {
+	p, _ := paths.Parse(c.Path)
+	return p.UserId
+}
+
+func replaceOwner(path string, owner string) string {
+	p, _ := paths.Parse(path)
+	return p.WithOwner(owner).String()
+}
+
+// idCache resolves phone numbers to profile ids once per scan.
+// Unregistered numbers resolve to "", failed lookups are not cached,
+// a check must not pair copies by a guess.
+type idCache struct {
+	db  datastore.GiveMeDatabase
+	ids map[string]string
+}
+
+func (c *idCache) get(ctx context.Context, phone string) (string, error) {
+	if id, ok := c.ids[phone]; ok {
+		return id, nil
+	}
+	id, err := c.db.GetProfileIdByPhoneNumber(ctx, phone)
+	switch {
+	case errors.Is(err, datastore.ErrNotFound):
+		id = ""
+	case err != nil:
+		return "", err
+	}
+	c.ids[phone] = id
+	return id, nil
+}
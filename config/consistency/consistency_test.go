@@ -0,0 +1,120 @@
+package consistency
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+func TestCheckAndRepair(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	db.AddProfile(ctx, &datastore.Profile{UID: datastore.UID{Id: "a", Phone: "+351111111111"}})
+	db.AddProfile(ctx, &datastore.Profile{UID: datastore.UID{Id: "b", Phone: "+351222222222"}})
+	mon := func(snowflake string, amount int64, confirmed bool) *datastore.MonetaryRequest {
+		return &datastore.MonetaryRequest{
+			From:          "+351111111111",
+			To:            "+351222222222",
+			AmountUnit:    amount,
+			ConfirmedFrom: confirmed,
+			Snowflake:     snowflake,
+		}
+	}
+	// Consistent pair.
+	db.SetMonetaryRequest(ctx, "a", mon("ok", 1, false), "2019-02")
+	db.SetMonetaryRequest(ctx, "b", mon("ok", 1, false), "2019-02")
+	// Debtor copy confirmed last.
+	db.SetMonetaryRequest(ctx, "a", mon("mis", 1, false), "2019-02")
+	db.SetMonetaryRequest(ctx, "b", mon("mis", 2, true), "2019-02")
+	// Debtor copy lost.
+	db.SetMonetaryRequest(ctx, "a", mon("orph", 1, false), "2019-02")
+	// Written twice under the creditor.
+	db.SetMonetaryRequest(ctx, "a", mon("dup", 1, false), "2019-02")
+	db.SetMonetaryRequest(ctx, "a", mon("dup", 1, false), "2019-03")
+	db.SetMonetaryRequest(ctx, "b", mon("dup", 1, false), "2019-03")
+	// Held by neither party.
+	db.SetMonetaryRequest(ctx, "c", mon("stray", 1, false), "2019-02")
+
+	report, err := Check(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := make(map[string]*Finding)
+	for _, f := range report.Findings {
+		kinds[f.Kind+"/"+f.Snowflake] = f
+	}
+	if len(report.Findings) != 4 ||
+		kinds["mismatch/mis"] == nil ||
+		kinds["orphan/orph"] == nil ||
+		kinds["duplicate/dup"] == nil ||
+		kinds["stray/stray"] == nil {
+		t.Fatal(report.Findings)
+	}
+	if f := kinds["mismatch/mis"]; len(f.Fields) != 2 || f.Fields[0] != "amountUnit" || f.Fields[1] != "confirmedFrom" {
+		t.Error(f.Fields)
+	}
+	if f := kinds["orphan/orph"]; f.Missing != "MonetaryRequests/b/2019-02" {
+		t.Error(f.Missing)
+	}
+
+	Repair(ctx, db, report, MostRecentWins)
+	for _, f := range report.Findings {
+		if f.Repaired == (f.Kind == KindStray) {
+			t.Error(f)
+		}
+	}
+	a, _ := db.GetMonetaryRequestWithDateString(ctx, "a", "2019-02", "mis")
+	if a.AmountUnit != 2 || !a.ConfirmedFrom {
+		t.Error(a)
+	}
+
+	report, _ = Check(ctx, db)
+	if len(report.Findings) != 1 || report.Findings[0].Kind != KindStray {
+		t.Error(report.Findings)
+	}
+}
+
+func TestCreditorWins(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	db.AddProfile(ctx, &datastore.Profile{UID: datastore.UID{Id: "a", Phone: "+351111111111"}})
+	db.AddProfile(ctx, &datastore.Profile{UID: datastore.UID{Id: "b", Phone: "+351222222222"}})
+	db.SetMonetaryRequest(ctx, "a", &datastore.MonetaryRequest{From: "+351111111111", To: "+351222222222", AmountUnit: 1, Snowflake: "s1"}, "2019-02")
+	db.SetMonetaryRequest(ctx, "b", &datastore.MonetaryRequest{From: "+351111111111", To: "+351222222222", AmountUnit: 2, Snowflake: "s1"}, "2019-02")
+
+	report, _ := Check(ctx, db)
+	Repair(ctx, db, report, CreditorWins)
+	b, _ := db.GetMonetaryRequestWithDateString(ctx, "b", "2019-02", "s1")
+	if b.AmountUnit != 1 {
+		t.Error(b)
+	}
+}
+
+// flaky fails every profile lookup, as when the database is down.
+type flaky struct {
+	datastore.GiveMeDatabase
+}
+
+func (flaky) GetProfileIdByPhoneNumber(
+	ctx context.Context,
+	phoneNumber string,
+) (string, error) {
+	return "", datastore.NewError(datastore.ErrUnavailable, "test: lookup failed")
+}
+
+func TestCheckFailsOnLookupErrors(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	db.SetMonetaryRequest(ctx, "a", &datastore.MonetaryRequest{
+		From:      "+351111111111",
+		To:        "+351222222222",
+		Snowflake: "s1",
+	}, "2019-02")
+
+	// A failed lookup must not pass for a party who never registered.
+	if report, err := Check(ctx, flaky{db}); !errors.Is(err, datastore.ErrUnavailable) {
+		t.Errorf("%+v %v", report, err)
+	}
+}
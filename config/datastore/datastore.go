@@ -28,6 +28,7 @@ type GiveMeDatabase interface {
 	) (*Profile, error)
 
 	// GetProfileByPhoneNumber retrieves a profile and Id by its associated phone number.
+	// Numbers a profile has migrated away from are matched as a fallback.
 	GetProfileByPhoneNumber(
 		ctx context.Context,
 		phoneNumber string,
@@ -39,6 +40,14 @@ type GiveMeDatabase interface {
 		phoneNumber string,
 	) (string, error)
 
+	// GetProfilesByPhoneNumbers retrieves the profiles of many phone
+	// numbers at once, keyed by the number asked for, matching as
+	// GetProfileByPhoneNumber does. Numbers with none are left out.
+	GetProfilesByPhoneNumbers(
+		ctx context.Context,
+		phoneNumbers []string,
+	) (map[string]*Profile, error)
+
 	// AddProfile saves a given profile, assigning it a new ID.
 	AddProfile(
 		ctx context.Context,
@@ -63,6 +72,22 @@ type GiveMeDatabase interface {
 		p *Profile,
 	) error
 
+	// RegisterDevice adds a device to a profile, or refreshes
+	// the one already registered with the same token.
+	RegisterDevice(
+		ctx context.Context,
+		userId string,
+		device Device,
+	) error
+
+	// RemoveDeviceToken drops a token the messaging service reports
+	// as unregistered from a profile's devices.
+	RemoveDeviceToken(
+		ctx context.Context,
+		userId string,
+		token string,
+	) error
+
 	// Close closes the database, freeing up any available resources.
 	Close() error
 
@@ -115,12 +140,12 @@ type GiveMeDatabase interface {
 		dateBefore time.Time,
 	) ([]*MonetaryRequest, error)
 
-	// GetMonetaryRequests for a group transfer.
+	// GetMonetaryRequestsFromGroup lists the requests stored under
+	// userId that were divided among the Group groupId, in every month.
 	GetMonetaryRequestsFromGroup(
 		ctx context.Context,
 		userId string,
-		date time.Time,
-		groupId int64,
+		groupId string,
 	) ([]*MonetaryRequest, error)
 
 	// GetMonetaryRequests for a recurrent transfer.
@@ -172,4 +197,231 @@ type GiveMeDatabase interface {
 		fullPath string,
 		snowflake string,
 	) error
+
+	// SetMonetaryRequestByFullPathWithOutbox writes a request and enqueues
+	// its notifications atomically. Notifications whose Key is already
+	// in the outbox are left untouched, so replays do not enqueue twice.
+	SetMonetaryRequestByFullPathWithOutbox(
+		ctx context.Context,
+		transfer *MonetaryRequest,
+		fullPath string,
+		outbox []*Notification,
+	) (string, error)
+
+	// UpdateMonetaryRequestConfirmedByFullPathWithOutbox is
+	// UpdateMonetaryRequestConfirmedByFullPath enqueueing notifications
+	// in the same transaction.
+	UpdateMonetaryRequestConfirmedByFullPathWithOutbox(
+		ctx context.Context,
+		confirmedFrom bool,
+		confirmedTo bool,
+		fullPath string,
+		snowflake string,
+		outbox []*Notification,
+	) error
+
+	// ListMonetaryRequestOwners lists every user id holding requests
+	// under root.
+	ListMonetaryRequestOwners(
+		ctx context.Context,
+		root string,
+	) ([]string, error)
+
+	// ListMonetaryRequests lists every copy stored under root/userId,
+	// all months.
+	ListMonetaryRequests(
+		ctx context.Context,
+		root string,
+		userId string,
+	) ([]*StoredMonetaryRequest, error)
+
+	DeleteMonetaryRequestByFullPath(
+		ctx context.Context,
+		fullPath string,
+		snowflake string,
+	) error
+
+	// MoveMonetaryRequest moves a copy from one collection to another,
+	// reporting false and leaving it in place if toPath already has it.
+	MoveMonetaryRequest(
+		ctx context.Context,
+		fromPath string,
+		toPath string,
+		snowflake string,
+	) (bool, error)
+
+	// Mirrored methods keep the creditor's and the debtor's copy
+	// of a request in step. Paths are {Root}/{Uid}/{Date} collections.
+
+	// SetMirroredMonetaryRequest writes both copies of a request and
+	// enqueues its notifications in one transaction.
+	SetMirroredMonetaryRequest(
+		ctx context.Context,
+		transfer *MonetaryRequest,
+		creditorPath string,
+		debtorPath string,
+		outbox []*Notification,
+	) error
+
+	// ConfirmMirroredMonetaryRequest sets confirmations on both copies
+	// in one transaction. Flags passed as false are left as they are,
+	// so a confirmation never regresses. Both copies must exist.
+	ConfirmMirroredMonetaryRequest(
+		ctx context.Context,
+		confirmedFrom bool, //If false ignore
+		confirmedTo bool, //If false ignore
+		creditorPath string,
+		debtorPath string,
+		snowflake string,
+		outbox []*Notification,
+	) error
+
+	// Group request methods
+
+	// SetDivisionReport writes how the group request snowflake of the
+	// fullPath collection was divided onto its document.
+	SetDivisionReport(
+		ctx context.Context,
+		fullPath string,
+		snowflake string,
+		report *DivisionReport,
+	) error
+
+	// GetDivisionReport reads back the report SetDivisionReport wrote.
+	GetDivisionReport(
+		ctx context.Context,
+		fullPath string,
+		snowflake string,
+	) (*DivisionReport, error)
+
+	// Group methods
+
+	// AddGroup validates and saves a new group, assigning it an Id
+	// unless it has one.
+	AddGroup(
+		ctx context.Context,
+		g *Group,
+	) (id string, err error)
+
+	// GetGroup retrieves a group by its Id.
+	GetGroup(
+		ctx context.Context,
+		groupId string,
+	) (*Group, error)
+
+	// UpdateGroup validates and replaces an existing group.
+	UpdateGroup(
+		ctx context.Context,
+		g *Group,
+	) error
+
+	// DeleteGroup removes a group by its Id.
+	DeleteGroup(
+		ctx context.Context,
+		groupId string,
+	) error
+
+	// ListGroups lists every group.
+	ListGroups(
+		ctx context.Context,
+	) ([]*Group, error)
+
+	// ListGroupsByMember lists the groups profileId is a member of.
+	ListGroupsByMember(
+		ctx context.Context,
+		profileId string,
+	) ([]*Group, error)
+
+	// Outbox methods
+
+	// AddNotifications enqueues notifications announcing a change
+	// already written, leaving those whose Key is enqueued as they are.
+	AddNotifications(
+		ctx context.Context,
+		outbox []*Notification,
+	) error
+
+	// ClaimNotification leases a pending notification that is due at now,
+	// counting the attempt. Returns false if it is not due or not pending.
+	ClaimNotification(
+		ctx context.Context,
+		key string,
+		now time.Time,
+		lease time.Duration,
+	) (*Notification, bool, error)
+
+	// UpdateNotification stores the outcome of a delivery attempt.
+	UpdateNotification(
+		ctx context.Context,
+		n *Notification,
+	) error
+
+	// GetDueNotifications lists up to limit pending notifications due at now.
+	GetDueNotifications(
+		ctx context.Context,
+		now time.Time,
+		limit int,
+	) ([]*Notification, error)
+
+	// Processed event methods
+
+	// IsEventProcessed reports whether an unexpired marker exists for key.
+	IsEventProcessed(
+		ctx context.Context,
+		key string,
+		now time.Time,
+	) (bool, error)
+
+	// MarkEventProcessed records the marker for an applied event.
+	MarkEventProcessed(
+		ctx context.Context,
+		event *ProcessedEvent,
+	) error
+
+	// Dead letter methods
+
+	// GetDeadLetter retrieves a dead letter by its Id.
+	GetDeadLetter(
+		ctx context.Context,
+		id string,
+	) (*DeadLetter, error)
+
+	// SetDeadLetter creates or replaces a dead letter.
+	SetDeadLetter(
+		ctx context.Context,
+		letter *DeadLetter,
+	) error
+
+	// ListDeadLetters lists dead letters in status, every one when empty,
+	// most recently failed first.
+	ListDeadLetters(
+		ctx context.Context,
+		status string,
+	) ([]*DeadLetter, error)
+
+	// Delivery log methods
+
+	// AddDelivery appends an attempt to the delivery log.
+	AddDelivery(
+		ctx context.Context,
+		delivery *Delivery,
+	) error
+
+	// GetDeliveriesForRequest lists the notification history of a request,
+	// oldest first.
+	GetDeliveriesForRequest(
+		ctx context.Context,
+		snowflake string,
+	) ([]*Delivery, error)
+
+	// ReplacePhoneNumberInRequests rewrites oldPhone into newPhone
+	// in the From and To of every request stored under userId.
+	// Returns every request under userId involving newPhone afterwards,
+	// so a retried migration still sees the requests it rewrote before.
+	ReplacePhoneNumberInRequests(
+		ctx context.Context,
+		userId string,
+		oldPhone string,
+		newPhone string,
+	) ([]*MonetaryRequest, error)
 }
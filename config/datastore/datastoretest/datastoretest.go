@@ -0,0 +1,26 @@
+// Package datastoretest provides utilities for testing against a
+// GiveMeDatabase.
+package datastoretest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+// AddProfiles stores a profile for each of uids in db, failing t on
+// the first that cannot be stored.
+func AddProfiles(
+	t testing.TB,
+	ctx context.Context,
+	db datastore.GiveMeDatabase,
+	uids ...datastore.UID,
+) {
+	t.Helper()
+	for _, uid := range uids {
+		if err := db.UpdateProfile(ctx, &datastore.Profile{UID: uid}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
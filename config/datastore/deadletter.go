@@ -0,0 +1,42 @@
+package datastore
+
+import (
+	"sort"
+	"time"
+)
+
+// Statuses a DeadLetter moves through.
+const (
+	// DeadLetterRetrying counts failures of an event still being retried.
+	DeadLetterRetrying = "retrying"
+	// DeadLetterDead is an event given up on, awaiting an operator.
+	DeadLetterDead = "dead"
+	// DeadLetterResolved is an event a replay applied.
+	DeadLetterResolved = "resolved"
+)
+
+// DeadLetter captures a trigger event a handler failed on,
+// to inspect, edit and replay it later.
+type DeadLetter struct {
+	//Id is the handler and the event id, the document id.
+	Id      string `firestore:"id" json:"id"`
+	Handler string `firestore:"handler" json:"handler"`
+	EventId string `firestore:"eventId" json:"eventId"`
+	//Payload is the event as the handler received it, as JSON.
+	Payload  string    `firestore:"payload" json:"payload"`
+	Error    string    `firestore:"error" json:"error"`
+	Attempts int64     `firestore:"attempts" json:"attempts"`
+	Status   string    `firestore:"status" json:"status"`
+	First    time.Time `firestore:"first" json:"first"`
+	Last     time.Time `firestore:"last" json:"last"`
+}
+
+// SortDeadLetters orders letters most recently failed first.
+func SortDeadLetters(letters []*DeadLetter) {
+	sort.Slice(letters, func(i, j int) bool {
+		if !letters[i].Last.Equal(letters[j].Last) {
+			return letters[i].Last.After(letters[j].Last)
+		}
+		return letters[i].Id < letters[j].Id
+	})
+}
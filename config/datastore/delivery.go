@@ -0,0 +1,26 @@
+package datastore
+
+import (
+	"time"
+)
+
+// Statuses a Delivery may end in.
+const (
+	DeliverySent         = "sent"
+	DeliveryFailed       = "failed"
+	DeliveryUnregistered = "unregistered"
+)
+
+// Delivery records one attempt at pushing a notification to a device.
+type Delivery struct {
+	Recipient string    `firestore:"recipient" json:"recipient"`
+	Token     string    `firestore:"token" json:"token"`
+	Type      string    `firestore:"type" json:"type"`
+	Status    string    `firestore:"status" json:"status"`
+	MessageId string    `firestore:"messageId" json:"messageId"`
+	Error     string    `firestore:"error" json:"error"`
+	Path      string    `firestore:"path" json:"path"`
+	Snowflake string    `firestore:"snowflake" json:"snowflake"`
+	Date      time.Time `firestore:"date" json:"date"`
+	Trace     string    `firestore:"trace" json:"trace"`
+}
@@ -0,0 +1,49 @@
+package datastore
+
+import (
+	"time"
+)
+
+// Outcomes of dividing a group request, for one member.
+const (
+	// MemberWritten members got their copy of the request.
+	MemberWritten = "written"
+	// MemberPendingInvite members have no profile yet,
+	// only the creditor's copy was written.
+	MemberPendingInvite = "pending-invite"
+	// MemberFailed members could not be written, see Reason.
+	MemberFailed = "failed"
+)
+
+// MemberResult is what dividing a group request did for one member.
+// Member is charged on behalf of Payer.
+type MemberResult struct {
+	Member    string `firestore:"member" json:"member"`
+	Payer     string `firestore:"payer" json:"payer"`
+	Status    string `firestore:"status" json:"status"`
+	Snowflake string `firestore:"snowflake" json:"snowflake"`
+	Reason    string `firestore:"reason" json:"reason"`
+}
+
+// DivisionReport tells the creditor of a group request how it was
+// divided, member by member, in the order of the request.
+type DivisionReport struct {
+	Members       []MemberResult `firestore:"members" json:"members"`
+	Written       int64          `firestore:"written" json:"written"`
+	PendingInvite int64          `firestore:"pendingInvite" json:"pendingInvite"`
+	Failed        int64          `firestore:"failed" json:"failed"`
+	Date          time.Time      `firestore:"date" json:"date"`
+}
+
+// Add records result, counting it by status.
+func (r *DivisionReport) Add(result MemberResult) {
+	r.Members = append(r.Members, result)
+	switch result.Status {
+	case MemberWritten:
+		r.Written++
+	case MemberPendingInvite:
+		r.PendingInvite++
+	case MemberFailed:
+		r.Failed++
+	}
+}
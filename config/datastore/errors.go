@@ -0,0 +1,66 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of failure, for errors.Is. Both implementations classify
+// their errors by these, whatever the message says.
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrConflict is a write lost to a concurrent one, as an aborted
+	// transaction. Trying again may succeed.
+	ErrConflict = errors.New("conflict")
+	// ErrInvalidEvent is a trigger event that cannot be processed
+	// as it is, however often it is delivered.
+	ErrInvalidEvent = errors.New("invalid event")
+	// ErrUnavailable is a transient failure to reach the datastore.
+	ErrUnavailable = errors.New("unavailable")
+	// ErrInternal is a query or document of our own making that the
+	// datastore rejects, a bug no retry fixes. Unlike an invalid event,
+	// it is logged as an error wherever it is given up on.
+	ErrInternal = errors.New("internal")
+)
+
+// Error is a failure of a known Kind, one of the sentinels above.
+// It reads as its cause, which it unwraps to.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+// NewError formats a failure of kind.
+func NewError(
+	kind error,
+	format string,
+	args ...interface{},
+) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the Kind of e, its cause is matched through Unwrap.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Retryable reports whether delivering the event that failed
+// with err again may succeed. Unclassified errors are retryable,
+// only missing or duplicate data, invalid events and internal errors
+// are permanent.
+func Retryable(err error) bool {
+	return err != nil &&
+		!errors.Is(err, ErrNotFound) &&
+		!errors.Is(err, ErrAlreadyExists) &&
+		!errors.Is(err, ErrInvalidEvent) &&
+		!errors.Is(err, ErrInternal)
+}
@@ -0,0 +1,40 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorKinds(t *testing.T) {
+	ctx := context.Background()
+	db := newMemoryDB()
+
+	_, err := db.GetProfile(ctx, "nobody")
+	if !errors.Is(err, ErrNotFound) || Retryable(err) {
+		t.Error(err)
+	}
+	// Wrapping keeps the kind.
+	err = fmt.Errorf("request: %w", err)
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrUnavailable) {
+		t.Error(err)
+	}
+	if err.Error() != "request: memorydb: profile not found with ID nobody" {
+		t.Error(err)
+	}
+
+	for _, err := range []error{
+		errors.New("unclassified"),
+		NewError(ErrUnavailable, "timed out"),
+		NewError(ErrConflict, "aborted"),
+	} {
+		if !Retryable(err) {
+			t.Error(err)
+		}
+	}
+	if Retryable(nil) || Retryable(NewError(ErrInvalidEvent, "no fields")) ||
+		Retryable(NewError(ErrInternal, "bad query")) {
+		t.Error("permanent errors retried")
+	}
+}
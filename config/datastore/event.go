@@ -0,0 +1,14 @@
+package datastore
+
+import (
+	"time"
+)
+
+// ProcessedEvent marks a trigger event a handler already applied.
+// Expires lets a TTL policy reclaim it once retries can no longer arrive.
+type ProcessedEvent struct {
+	Key     string    `firestore:"key" json:"key"`
+	Handler string    `firestore:"handler" json:"handler"`
+	Date    time.Time `firestore:"date" json:"date"`
+	Expires time.Time `firestore:"expires" json:"expires"`
+}
@@ -0,0 +1,209 @@
+package datastore
+
+import (
+	"time"
+)
+
+// Roles a group member may hold.
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// Rules splitting a group request among members.
+const (
+	// SplitEqual splits among the members charged, the creditor aside.
+	SplitEqual = "equal"
+	// SplitEqualIncluded counts the creditor in as one more share.
+	SplitEqualIncluded = "equalIncluded"
+)
+
+// GroupMember is one member of a Group, known by profile id once
+// they have one, by phone number until then.
+type GroupMember struct {
+	ProfileId string    `firestore:"profileId" json:"profileId"`
+	Phone     string    `firestore:"phone" json:"phone"`
+	Role      string    `firestore:"role" json:"role"`
+	Joined    time.Time `firestore:"joined" json:"joined"`
+}
+
+// Key identifies the member, by profile id or phone number.
+func (m GroupMember) Key() string {
+	if m.ProfileId != "" {
+		return m.ProfileId
+	}
+	return m.Phone
+}
+
+// Group is a standing set of people sharing expenses,
+// stored under Groups/{Id}.
+type Group struct {
+	Id              string        `firestore:"id" json:"id"`
+	Name            string        `firestore:"name" json:"name"`
+	Members         []GroupMember `firestore:"members" json:"members"`
+	DefaultCurrency string        `firestore:"defaultCurrency" json:"defaultCurrency"`
+	DefaultSplit    string        `firestore:"defaultSplit" json:"defaultSplit"`
+	//MemberIds are the profile ids of Members,
+	//kept by the datastore so groups can be listed by member.
+	MemberIds []string `firestore:"memberIds" json:"memberIds"`
+	//UpdatedBy is the profile id of the member who wrote this version,
+	//as security rules hold clients to. Empty for the backend's writes.
+	UpdatedBy string    `firestore:"updatedBy" json:"updatedBy"`
+	Created   time.Time `firestore:"created" json:"created"`
+	Updated   time.Time `firestore:"updated" json:"updated"`
+}
+
+// Member finds the member known by key, a profile id or a phone number.
+func (g *Group) Member(key string) (GroupMember, bool) {
+	for _, m := range g.Members {
+		if m.ProfileId == key || m.Phone == key {
+			return m, true
+		}
+	}
+	return GroupMember{}, false
+}
+
+// IsAdmin reports whether the member known by key administers g.
+func (g *Group) IsAdmin(key string) bool {
+	m, ok := g.Member(key)
+	return ok && m.Role == RoleAdmin
+}
+
+// ProfileIds lists the profile ids of the members who have one.
+func (g *Group) ProfileIds() []string {
+	ids := make([]string, 0, len(g.Members))
+	for _, m := range g.Members {
+		if m.ProfileId != "" {
+			ids = append(ids, m.ProfileId)
+		}
+	}
+	return ids
+}
+
+// in finds m in group by either its profile id or its phone number,
+// so a member who got a profile, or whose phone was filled in,
+// is still the same member.
+func (g *Group) in(m GroupMember) (GroupMember, bool) {
+	if g == nil {
+		return GroupMember{}, false
+	}
+	for _, key := range []string{m.ProfileId, m.Phone} {
+		if key == "" {
+			continue
+		}
+		if found, ok := g.Member(key); ok {
+			return found, true
+		}
+	}
+	return GroupMember{}, false
+}
+
+// MembershipChanges lists the members in g and not in old, and
+// those in old and not in g. Either group may be nil, as on
+// creation and deletion.
+func MembershipChanges(
+	old *Group,
+	g *Group,
+) (added []GroupMember, removed []GroupMember) {
+	in := func(group *Group, m GroupMember) bool {
+		_, ok := group.in(m)
+		return ok
+	}
+	if g != nil {
+		for _, m := range g.Members {
+			if !in(old, m) {
+				added = append(added, m)
+			}
+		}
+	}
+	if old != nil {
+		for _, m := range old.Members {
+			if !in(g, m) {
+				removed = append(removed, m)
+			}
+		}
+	}
+	return added, removed
+}
+
+// AuthorizeMembership checks the author of g, its UpdatedBy, could
+// make its membership out of old: only admins add and remove members
+// or change their roles, and any member may leave. The creator of a
+// group must be among its admins. The backend's own writes, with no
+// author, are not checked, neither are deletions, whose author events
+// do not carry.
+func AuthorizeMembership(
+	old *Group,
+	g *Group,
+) error {
+	if g == nil || g.UpdatedBy == "" {
+		return nil
+	}
+	author := g.UpdatedBy
+	if old == nil {
+		if !g.IsAdmin(author) {
+			return NewError(ErrInvalidEvent, "group %v was created by %v, not one of its admins", g.Id, author)
+		}
+		return nil
+	}
+	if old.IsAdmin(author) {
+		return nil
+	}
+
+	added, removed := MembershipChanges(old, g)
+	roles := false
+	for _, m := range g.Members {
+		if was, ok := old.in(m); ok && was.Role != m.Role {
+			roles = true
+		}
+	}
+	if !roles && len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+	leaving := len(removed) == 1 && (removed[0].ProfileId == author || removed[0].Phone == author)
+	if roles || len(added) > 0 || !leaving {
+		return NewError(ErrInvalidEvent, "group %v had its members changed by %v, not one of its admins", g.Id, author)
+	}
+	return nil
+}
+
+// Validate checks g can be stored: it is named, splits by a known
+// rule, lists every member once, each with a known role, and is
+// administered by at least one of them.
+func (g *Group) Validate() error {
+	if g.Name == "" {
+		return NewError(ErrInvalidEvent, "group %v has no name", g.Id)
+	}
+	switch g.DefaultSplit {
+	case "", SplitEqual, SplitEqualIncluded:
+	default:
+		return NewError(ErrInvalidEvent, "group %v splits by unknown rule %v", g.Id, g.DefaultSplit)
+	}
+	seen := make(map[string]bool, 2*len(g.Members))
+	admins := 0
+	for _, m := range g.Members {
+		if m.Key() == "" {
+			return NewError(ErrInvalidEvent, "group %v has a member with neither profile nor phone", g.Id)
+		}
+		for _, key := range []string{m.ProfileId, m.Phone} {
+			if key == "" {
+				continue
+			}
+			if seen[key] {
+				return NewError(ErrInvalidEvent, "group %v lists a member twice", g.Id)
+			}
+			seen[key] = true
+		}
+		switch m.Role {
+		case RoleAdmin:
+			admins++
+		case RoleMember:
+		default:
+			return NewError(ErrInvalidEvent, "group %v has a member of unknown role %v", g.Id, m.Role)
+		}
+	}
+	if admins == 0 {
+		return NewError(ErrInvalidEvent, "group %v has no admin", g.Id)
+	}
+	return nil
+}
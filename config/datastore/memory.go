@@ -8,8 +8,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/Seriyin/GiveMeBackend/config/firebase/schema"
 )
 
 // Ensure memoryDB conforms to the GiveMeDatabase interface.
@@ -21,12 +25,48 @@ type memoryDB struct {
 	profiles map[string]*Profile // maps from profile ID to profile.
 	files    map[string]*Files
 	blocked  map[string][]string
+	// maps from collection path to snowflake to request.
+	requests map[string]map[string]*MonetaryRequest
+	// maps from document path to its last write.
+	updated    map[string]time.Time
+	deliveries []*Delivery
+	outbox     map[string]*Notification
+	events     map[string]*ProcessedEvent
+	letters    map[string]*DeadLetter
+	// maps from group request document path to its report.
+	reports map[string]*DivisionReport
+	groups  map[string]*Group
+	// observe, if set, sees every request written.
+	observe func(fullPath string, transfer *MonetaryRequest)
+}
+
+// NewMemoryDB creates an in-memory GiveMeDatabase for tests and local runs.
+func NewMemoryDB() GiveMeDatabase {
+	return newMemoryDB()
+}
+
+// NewObservedMemoryDB is NewMemoryDB calling observe with a copy of
+// every request written, as Firestore triggers would see them.
+// observe runs with the database locked, it must not call back into it.
+func NewObservedMemoryDB(
+	observe func(fullPath string, transfer *MonetaryRequest),
+) GiveMeDatabase {
+	db := newMemoryDB()
+	db.observe = observe
+	return db
 }
 
 func newMemoryDB() *memoryDB {
 	return &memoryDB{
 		profiles: make(map[string]*Profile),
 		files:    make(map[string]*Files),
+		requests: make(map[string]map[string]*MonetaryRequest),
+		updated:  make(map[string]time.Time),
+		outbox:   make(map[string]*Notification),
+		events:   make(map[string]*ProcessedEvent),
+		letters:  make(map[string]*DeadLetter),
+		reports:  make(map[string]*DivisionReport),
+		groups:   make(map[string]*Group),
 	}
 }
 
@@ -50,7 +90,7 @@ func (db *memoryDB) GetProfile(
 
 	profile, ok := db.profiles[id]
 	if !ok {
-		return nil, fmt.Errorf("memorydb: profile not found with ID %d", id)
+		return nil, NewError(ErrNotFound, "memorydb: profile not found with ID %v", id)
 	}
 	return profile, nil
 }
@@ -59,14 +99,67 @@ func (db *memoryDB) GetProfileIdByPhoneNumber(
 	ctx context.Context,
 	phoneNumber string,
 ) (string, error) {
-	panic("implement me")
+	profile, err := db.GetProfileByPhoneNumber(ctx, phoneNumber)
+	if err != nil {
+		return "", err
+	}
+	return profile.Id, nil
 }
 
+// GetProfileByPhoneNumber retrieves a profile by its current phone number,
+// falling back to numbers it has migrated away from.
 func (db *memoryDB) GetProfileByPhoneNumber(
 	ctx context.Context,
 	phoneNumber string,
 ) (*Profile, error) {
-	panic("implement me")
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if p := db.findProfileByPhoneNumber(phoneNumber); p != nil {
+		return p, nil
+	}
+	return nil, NewError(
+		ErrNotFound,
+		"memorydb: profile not found with phone number %v",
+		phoneNumber,
+	)
+}
+
+// GetProfilesByPhoneNumbers retrieves the profiles of many phone
+// numbers at once, leaving out numbers with none.
+func (db *memoryDB) GetProfilesByPhoneNumbers(
+	ctx context.Context,
+	phoneNumbers []string,
+) (map[string]*Profile, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	profiles := make(map[string]*Profile, len(phoneNumbers))
+	for _, phoneNumber := range phoneNumbers {
+		if p := db.findProfileByPhoneNumber(phoneNumber); p != nil {
+			profiles[phoneNumber] = p
+		}
+	}
+	return profiles, nil
+}
+
+// findProfileByPhoneNumber matches the current phone number first,
+// then any number a profile has migrated away from.
+// Caller must hold the mutex.
+func (db *memoryDB) findProfileByPhoneNumber(phoneNumber string) *Profile {
+	for _, p := range db.profiles {
+		if p.Phone == phoneNumber {
+			return p
+		}
+	}
+	for _, p := range db.profiles {
+		for _, previous := range p.PreviousPhones {
+			if previous == phoneNumber {
+				return p
+			}
+		}
+	}
+	return nil
 }
 
 // AddProfile saves a given profile, assigning it a new ID.
@@ -88,14 +181,14 @@ func (db *memoryDB) DeleteProfile(
 	id string,
 ) error {
 	if id == "" {
-		return errors.New("memorydb: profile with unassigned ID passed into deleteProfile")
+		return NewError(ErrInvalidEvent, "memorydb: profile with unassigned ID passed into deleteProfile")
 	}
 
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
 
 	if _, ok := db.profiles[id]; !ok {
-		return fmt.Errorf("memorydb: could not delete profile with ID %d, does not exist", id)
+		return NewError(ErrNotFound, "memorydb: could not delete profile with ID %v, does not exist", id)
 	}
 	delete(db.profiles, id)
 	return nil
@@ -107,7 +200,7 @@ func (db *memoryDB) UpdateProfile(
 	p *Profile,
 ) error {
 	if p.Id == "" {
-		return errors.New("memorydb: profile with unassigned ID passed into updateProfile")
+		return NewError(ErrInvalidEvent, "memorydb: profile with unassigned ID passed into updateProfile")
 	}
 
 	db.mutex.Lock()
@@ -117,6 +210,41 @@ func (db *memoryDB) UpdateProfile(
 	return nil
 }
 
+func (db *memoryDB) RegisterDevice(
+	ctx context.Context,
+	userId string,
+	device Device,
+) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	p, ok := db.profiles[userId]
+	if !ok {
+		return NewError(ErrNotFound, "memorydb: could not register device, profile with ID %v does not exist", userId)
+	}
+	p.Devices = UpsertDevice(p.Devices, device)
+	return nil
+}
+
+func (db *memoryDB) RemoveDeviceToken(
+	ctx context.Context,
+	userId string,
+	token string,
+) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	p, ok := db.profiles[userId]
+	if !ok {
+		return NewError(ErrNotFound, "memorydb: could not remove device, profile with ID %v does not exist", userId)
+	}
+	p.Devices = RemoveDevice(p.Devices, token)
+	if p.Token == token {
+		p.Token = ""
+	}
+	return nil
+}
+
 // ListFilesSharedBy returns a list of files, ordered by timestamp,
 // filtered by the profile who created the files.
 func (db *memoryDB) ListFilesSharedBy(userID string) (*Files, error) {
@@ -161,7 +289,11 @@ func (db *memoryDB) AddMonetaryRequest(
 	transfer *MonetaryRequest,
 	path string,
 ) (string, error) {
-	panic("implement me")
+	return db.AddMonetaryRequestByFullPath(
+		ctx,
+		transfer,
+		memoryCollectionPath(userId, path),
+	)
 }
 
 func (db *memoryDB) AddMonetaryRequestByFullPath(
@@ -169,7 +301,12 @@ func (db *memoryDB) AddMonetaryRequestByFullPath(
 	transfer *MonetaryRequest,
 	fullPath string,
 ) (string, error) {
-	panic("implement me")
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	transfer.Snowflake = fmt.Sprintf("mem%d", time.Now().UnixNano())
+	db.putRequest(fullPath, transfer)
+	return transfer.Snowflake, nil
 }
 
 func (db *memoryDB) GetMonetaryRequestWithDate(
@@ -178,7 +315,12 @@ func (db *memoryDB) GetMonetaryRequestWithDate(
 	date time.Time,
 	snowflake string,
 ) (*MonetaryRequest, error) {
-	panic("implement me")
+	return db.GetMonetaryRequestWithDateString(
+		ctx,
+		userId,
+		date.Format("2006-01"),
+		snowflake,
+	)
 }
 
 func (db *memoryDB) GetMonetaryRequestWithDateString(
@@ -187,7 +329,19 @@ func (db *memoryDB) GetMonetaryRequestWithDateString(
 	date string,
 	snowflake string,
 ) (*MonetaryRequest, error) {
-	panic("implement me")
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	mon, ok := db.requests[memoryCollectionPath(userId, date)][snowflake]
+	if !ok {
+		return nil, NewError(
+			ErrNotFound,
+			"memorydb: monetary request not found with snowflake %v",
+			snowflake,
+		)
+	}
+	copied := *mon
+	return &copied, nil
 }
 
 func (db *memoryDB) GetMonetaryRequestsDate(
@@ -210,10 +364,19 @@ func (db *memoryDB) GetMonetaryRequestsInterval(
 func (db *memoryDB) GetMonetaryRequestsFromGroup(
 	ctx context.Context,
 	userId string,
-	date time.Time,
-	groupId int64,
+	groupId string,
 ) ([]*MonetaryRequest, error) {
-	panic("implement me")
+	stored, err := db.ListMonetaryRequests(ctx, schema.MonetaryRequests, userId)
+	if err != nil {
+		return nil, err
+	}
+	var mts []*MonetaryRequest
+	for _, s := range stored {
+		if s.Request.Group == groupId {
+			mts = append(mts, s.Request)
+		}
+	}
+	return mts, nil
 }
 
 func (db *memoryDB) GetMonetaryRequestsRecurrent(
@@ -230,7 +393,11 @@ func (db *memoryDB) SetMonetaryRequest(
 	transfer *MonetaryRequest,
 	path string,
 ) (string, error) {
-	panic("implement me")
+	return db.SetMonetaryRequestByFullPath(
+		ctx,
+		transfer,
+		memoryCollectionPath(userId, path),
+	)
 }
 
 func (db *memoryDB) SetMonetaryRequestByFullPath(
@@ -238,24 +405,38 @@ func (db *memoryDB) SetMonetaryRequestByFullPath(
 	transfer *MonetaryRequest,
 	fullPath string,
 ) (string, error) {
-	panic("implement me")
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.putRequest(fullPath, transfer)
+	return transfer.Snowflake, nil
 }
 
 func (db *memoryDB) SetMonetaryRequests(
 	ctx context.Context,
 	userId string,
-	transfer []*MonetaryRequest,
+	transfers []*MonetaryRequest,
 	path string,
 ) error {
-	panic("implement me")
+	return db.SetMonetaryRequestsByFullPath(
+		ctx,
+		transfers,
+		memoryCollectionPath(userId, path),
+	)
 }
 
 func (db *memoryDB) SetMonetaryRequestsByFullPath(
 	ctx context.Context,
-	transfer []*MonetaryRequest,
+	transfers []*MonetaryRequest,
 	fullPath string,
 ) error {
-	panic("implement me")
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for _, transfer := range transfers {
+		db.putRequest(fullPath, transfer)
+	}
+	return nil
 }
 
 func (db *memoryDB) UpdateMonetaryRequestConfirmed(
@@ -266,7 +447,13 @@ func (db *memoryDB) UpdateMonetaryRequestConfirmed(
 	path string,
 	snowflake string,
 ) error {
-	panic("implement me")
+	return db.UpdateMonetaryRequestConfirmedByFullPath(
+		ctx,
+		confirmedFrom,
+		confirmedTo,
+		memoryCollectionPath(userId, path),
+		snowflake,
+	)
 }
 
 func (db *memoryDB) UpdateMonetaryRequestConfirmedByFullPath(
@@ -276,5 +463,616 @@ func (db *memoryDB) UpdateMonetaryRequestConfirmedByFullPath(
 	fullPath string,
 	snowflake string,
 ) error {
-	panic("implement me")
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	mon, ok := db.requests[fullPath][snowflake]
+	if !ok {
+		return NewError(
+			ErrNotFound,
+			"memorydb: failed to update monetary transfer %v in %v, does not exist",
+			snowflake,
+			fullPath,
+		)
+	}
+	mon.ConfirmedFrom = confirmedFrom
+	mon.ConfirmedTo = confirmedTo
+	db.touch(fullPath, snowflake)
+	return nil
+}
+
+func (db *memoryDB) ReplacePhoneNumberInRequests(
+	ctx context.Context,
+	userId string,
+	oldPhone string,
+	newPhone string,
+) ([]*MonetaryRequest, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	var involved []*MonetaryRequest
+	root := memoryCollectionPath(userId, "")
+	for path, collection := range db.requests {
+		if !strings.HasPrefix(path, root) {
+			continue
+		}
+		for snowflake, mon := range collection {
+			if mon.From == oldPhone || mon.To == oldPhone {
+				if mon.From == oldPhone {
+					mon.From = newPhone
+				}
+				if mon.To == oldPhone {
+					mon.To = newPhone
+				}
+				db.touch(path, snowflake)
+			}
+			if mon.From == newPhone || mon.To == newPhone {
+				copied := *mon
+				involved = append(involved, &copied)
+			}
+		}
+	}
+	return involved, nil
+}
+
+func (db *memoryDB) SetMonetaryRequestByFullPathWithOutbox(
+	ctx context.Context,
+	transfer *MonetaryRequest,
+	fullPath string,
+	outbox []*Notification,
+) (string, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.putRequest(fullPath, transfer)
+	db.enqueue(outbox)
+	return transfer.Snowflake, nil
+}
+
+func (db *memoryDB) UpdateMonetaryRequestConfirmedByFullPathWithOutbox(
+	ctx context.Context,
+	confirmedFrom bool,
+	confirmedTo bool,
+	fullPath string,
+	snowflake string,
+	outbox []*Notification,
+) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	mon, ok := db.requests[fullPath][snowflake]
+	if !ok {
+		return NewError(
+			ErrNotFound,
+			"memorydb: failed to update monetary transfer %v in %v, does not exist",
+			snowflake,
+			fullPath,
+		)
+	}
+	mon.ConfirmedFrom = confirmedFrom
+	mon.ConfirmedTo = confirmedTo
+	db.touch(fullPath, snowflake)
+	db.enqueue(outbox)
+	return nil
+}
+
+func (db *memoryDB) SetMirroredMonetaryRequest(
+	ctx context.Context,
+	transfer *MonetaryRequest,
+	creditorPath string,
+	debtorPath string,
+	outbox []*Notification,
+) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.putRequest(creditorPath, transfer)
+	db.putRequest(debtorPath, transfer)
+	db.enqueue(outbox)
+	return nil
+}
+
+func (db *memoryDB) ConfirmMirroredMonetaryRequest(
+	ctx context.Context,
+	confirmedFrom bool, //If false ignore
+	confirmedTo bool, //If false ignore
+	creditorPath string,
+	debtorPath string,
+	snowflake string,
+	outbox []*Notification,
+) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	// Check both copies before touching either, as a transaction would.
+	paths := []string{creditorPath, debtorPath}
+	for _, path := range paths {
+		if _, ok := db.requests[path][snowflake]; !ok {
+			return NewError(
+				ErrNotFound,
+				"memorydb: failed to confirm monetary transfer %v in %v, does not exist",
+				snowflake,
+				path,
+			)
+		}
+	}
+	for _, path := range paths {
+		mon := db.requests[path][snowflake]
+		mon.ConfirmedFrom = mon.ConfirmedFrom || confirmedFrom
+		mon.ConfirmedTo = mon.ConfirmedTo || confirmedTo
+		db.touch(path, snowflake)
+	}
+	db.enqueue(outbox)
+	return nil
+}
+
+// enqueue adds notifications not already in the outbox,
+// caller must hold the mutex.
+func (db *memoryDB) enqueue(outbox []*Notification) {
+	for _, n := range outbox {
+		if _, ok := db.outbox[n.Key]; !ok {
+			copied := *n
+			db.outbox[n.Key] = &copied
+		}
+	}
+}
+
+func (db *memoryDB) AddNotifications(
+	ctx context.Context,
+	outbox []*Notification,
+) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.enqueue(outbox)
+	return nil
+}
+
+func (db *memoryDB) ClaimNotification(
+	ctx context.Context,
+	key string,
+	now time.Time,
+	lease time.Duration,
+) (*Notification, bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	n, ok := db.outbox[key]
+	if !ok {
+		return nil, false, NewError(ErrNotFound, "memorydb: notification %v not found", key)
+	}
+	if n.Status != NotificationPending || n.NextAttempt.After(now) {
+		return nil, false, nil
+	}
+	n.Attempts++
+	n.NextAttempt = now.Add(lease)
+	copied := *n
+	return &copied, true, nil
+}
+
+func (db *memoryDB) UpdateNotification(
+	ctx context.Context,
+	n *Notification,
+) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	copied := *n
+	db.outbox[n.Key] = &copied
+	return nil
+}
+
+func (db *memoryDB) GetDueNotifications(
+	ctx context.Context,
+	now time.Time,
+	limit int,
+) ([]*Notification, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	var due []*Notification
+	for _, n := range db.outbox {
+		if len(due) == limit {
+			break
+		}
+		if n.Status == NotificationPending && !n.NextAttempt.After(now) {
+			copied := *n
+			due = append(due, &copied)
+		}
+	}
+	return due, nil
+}
+
+func (db *memoryDB) IsEventProcessed(
+	ctx context.Context,
+	key string,
+	now time.Time,
+) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	event, ok := db.events[key]
+	return ok && event.Expires.After(now), nil
+}
+
+func (db *memoryDB) MarkEventProcessed(
+	ctx context.Context,
+	event *ProcessedEvent,
+) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	copied := *event
+	db.events[event.Key] = &copied
+	return nil
+}
+
+func (db *memoryDB) GetDeadLetter(
+	ctx context.Context,
+	id string,
+) (*DeadLetter, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	letter, ok := db.letters[id]
+	if !ok {
+		return nil, NewError(ErrNotFound, "memorydb: dead letter %v not found", id)
+	}
+	copied := *letter
+	return &copied, nil
+}
+
+func (db *memoryDB) SetDeadLetter(
+	ctx context.Context,
+	letter *DeadLetter,
+) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	copied := *letter
+	db.letters[letter.Id] = &copied
+	return nil
+}
+
+func (db *memoryDB) ListDeadLetters(
+	ctx context.Context,
+	status string,
+) ([]*DeadLetter, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	var letters []*DeadLetter
+	for _, letter := range db.letters {
+		if status == "" || letter.Status == status {
+			copied := *letter
+			letters = append(letters, &copied)
+		}
+	}
+	SortDeadLetters(letters)
+	return letters, nil
+}
+
+func (db *memoryDB) AddDelivery(
+	ctx context.Context,
+	delivery *Delivery,
+) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	copied := *delivery
+	db.deliveries = append(db.deliveries, &copied)
+	return nil
+}
+
+func (db *memoryDB) GetDeliveriesForRequest(
+	ctx context.Context,
+	snowflake string,
+) ([]*Delivery, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	var history []*Delivery
+	for _, d := range db.deliveries {
+		if d.Snowflake == snowflake {
+			copied := *d
+			history = append(history, &copied)
+		}
+	}
+	return history, nil
+}
+
+func (db *memoryDB) ListMonetaryRequestOwners(
+	ctx context.Context,
+	root string,
+) ([]string, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	seen := make(map[string]bool)
+	var owners []string
+	for path, collection := range db.requests {
+		// {Root}/{Uid}/{Date}
+		splits := strings.Split(path, "/")
+		if splits[0] != root {
+			continue
+		}
+		userId := splits[1]
+		if len(collection) > 0 && !seen[userId] {
+			seen[userId] = true
+			owners = append(owners, userId)
+		}
+	}
+	sort.Strings(owners)
+	return owners, nil
+}
+
+func (db *memoryDB) ListMonetaryRequests(
+	ctx context.Context,
+	root string,
+	userId string,
+) ([]*StoredMonetaryRequest, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	var stored []*StoredMonetaryRequest
+	prefix := root + "/" + userId + "/"
+	for path, collection := range db.requests {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		for snowflake, mon := range collection {
+			copied := *mon
+			stored = append(stored, &StoredMonetaryRequest{
+				Path:    path,
+				Updated: db.updated[path+"/"+snowflake],
+				Request: &copied,
+			})
+		}
+	}
+	sort.Slice(stored, func(i, j int) bool {
+		if stored[i].Path != stored[j].Path {
+			return stored[i].Path < stored[j].Path
+		}
+		return stored[i].Request.Snowflake < stored[j].Request.Snowflake
+	})
+	return stored, nil
+}
+
+func (db *memoryDB) DeleteMonetaryRequestByFullPath(
+	ctx context.Context,
+	fullPath string,
+	snowflake string,
+) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if _, ok := db.requests[fullPath][snowflake]; !ok {
+		return NewError(
+			ErrNotFound,
+			"memorydb: could not delete monetary transfer %v in %v, does not exist",
+			snowflake,
+			fullPath,
+		)
+	}
+	delete(db.requests[fullPath], snowflake)
+	delete(db.updated, fullPath+"/"+snowflake)
+	return nil
+}
+
+func (db *memoryDB) MoveMonetaryRequest(
+	ctx context.Context,
+	fromPath string,
+	toPath string,
+	snowflake string,
+) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	mon, ok := db.requests[fromPath][snowflake]
+	if !ok {
+		return false, NewError(
+			ErrNotFound,
+			"memorydb: could not move monetary transfer %v in %v, does not exist",
+			snowflake,
+			fromPath,
+		)
+	}
+	if _, ok := db.requests[toPath][snowflake]; ok {
+		return false, nil
+	}
+	db.putRequest(toPath, mon)
+	db.updated[toPath+"/"+snowflake] = db.updated[fromPath+"/"+snowflake]
+	delete(db.requests[fromPath], snowflake)
+	delete(db.updated, fromPath+"/"+snowflake)
+	return true, nil
+}
+
+// putRequest stores a copy of transfer, caller must hold the mutex.
+func (db *memoryDB) putRequest(
+	fullPath string,
+	transfer *MonetaryRequest,
+) {
+	collection, ok := db.requests[fullPath]
+	if !ok {
+		collection = make(map[string]*MonetaryRequest)
+		db.requests[fullPath] = collection
+	}
+	copied := *transfer
+	collection[transfer.Snowflake] = &copied
+	db.touch(fullPath, transfer.Snowflake)
+}
+
+// touch records a write of a request, caller must hold the mutex.
+func (db *memoryDB) touch(
+	fullPath string,
+	snowflake string,
+) {
+	db.updated[fullPath+"/"+snowflake] = time.Now()
+	if db.observe != nil {
+		copied := *db.requests[fullPath][snowflake]
+		db.observe(fullPath, &copied)
+	}
+}
+
+func memoryCollectionPath(
+	userId string,
+	path string,
+) string {
+	return schema.MonetaryRequests + "/" + userId + "/" + path
+}
+
+func (db *memoryDB) SetDivisionReport(
+	ctx context.Context,
+	fullPath string,
+	snowflake string,
+	report *DivisionReport,
+) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	copied := *report
+	copied.Members = append([]MemberResult(nil), report.Members...)
+	db.reports[fullPath+"/"+snowflake] = &copied
+	return nil
+}
+
+func (db *memoryDB) GetDivisionReport(
+	ctx context.Context,
+	fullPath string,
+	snowflake string,
+) (*DivisionReport, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	report, ok := db.reports[fullPath+"/"+snowflake]
+	if !ok {
+		return nil, NewError(
+			ErrNotFound,
+			"memorydb: no division report for %v/%v",
+			fullPath,
+			snowflake,
+		)
+	}
+	copied := *report
+	copied.Members = append([]MemberResult(nil), report.Members...)
+	return &copied, nil
+}
+
+// copyGroup copies g deep enough that neither the database
+// nor its callers see each other's changes.
+func copyGroup(g *Group) *Group {
+	copied := *g
+	copied.Members = append([]GroupMember(nil), g.Members...)
+	copied.MemberIds = append([]string(nil), g.MemberIds...)
+	return &copied
+}
+
+func (db *memoryDB) AddGroup(
+	ctx context.Context,
+	g *Group,
+) (string, error) {
+	if err := g.Validate(); err != nil {
+		return "", err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if g.Id == "" {
+		g.Id = fmt.Sprintf("mem%d", time.Now().UnixNano())
+	}
+	if _, ok := db.groups[g.Id]; ok {
+		return "", NewError(ErrAlreadyExists, "memorydb: group %v already exists", g.Id)
+	}
+	g.Created = time.Now()
+	g.Updated = g.Created
+	g.MemberIds = g.ProfileIds()
+	db.groups[g.Id] = copyGroup(g)
+	return g.Id, nil
+}
+
+func (db *memoryDB) GetGroup(
+	ctx context.Context,
+	groupId string,
+) (*Group, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	g, ok := db.groups[groupId]
+	if !ok {
+		return nil, NewError(ErrNotFound, "memorydb: group not found with ID %v", groupId)
+	}
+	return copyGroup(g), nil
+}
+
+func (db *memoryDB) UpdateGroup(
+	ctx context.Context,
+	g *Group,
+) error {
+	if err := g.Validate(); err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	old, ok := db.groups[g.Id]
+	if !ok {
+		return NewError(ErrNotFound, "memorydb: could not update group %v, does not exist", g.Id)
+	}
+	g.Created = old.Created
+	g.Updated = time.Now()
+	g.MemberIds = g.ProfileIds()
+	db.groups[g.Id] = copyGroup(g)
+	return nil
+}
+
+func (db *memoryDB) DeleteGroup(
+	ctx context.Context,
+	groupId string,
+) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if _, ok := db.groups[groupId]; !ok {
+		return NewError(ErrNotFound, "memorydb: could not delete group %v, does not exist", groupId)
+	}
+	delete(db.groups, groupId)
+	return nil
+}
+
+func (db *memoryDB) ListGroups(
+	ctx context.Context,
+) ([]*Group, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	groups := make([]*Group, 0, len(db.groups))
+	for _, g := range db.groups {
+		groups = append(groups, copyGroup(g))
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Id < groups[j].Id
+	})
+	return groups, nil
+}
+
+func (db *memoryDB) ListGroupsByMember(
+	ctx context.Context,
+	profileId string,
+) ([]*Group, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	var groups []*Group
+	for _, g := range db.groups {
+		for _, id := range g.MemberIds {
+			if id == profileId {
+				groups = append(groups, copyGroup(g))
+				break
+			}
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Id < groups[j].Id
+	})
+	return groups, nil
 }
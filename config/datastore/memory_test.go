@@ -0,0 +1,163 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPhoneNumberMigration(t *testing.T) {
+	ctx := context.Background()
+	db := newMemoryDB()
+	db.AddProfile(ctx, &Profile{UID: UID{Id: "a", Phone: "+351111111111"}})
+	db.AddProfile(ctx, &Profile{UID: UID{Id: "b", Phone: "+351222222222"}})
+	mon := &MonetaryRequest{
+		From:      "+351111111111",
+		To:        "+351222222222",
+		Snowflake: "s1",
+	}
+	db.SetMonetaryRequest(ctx, "a", mon, "2019-02")
+	db.SetMonetaryRequest(ctx, "b", mon, "2019-02")
+
+	involved, err := db.ReplacePhoneNumberInRequests(
+		ctx,
+		"a",
+		"+351111111111",
+		"+351333333333",
+	)
+	if err != nil || len(involved) != 1 || involved[0].From != "+351333333333" {
+		t.Error(involved, err)
+	}
+
+	// A retry still reports the requests rewritten before.
+	involved, err = db.ReplacePhoneNumberInRequests(
+		ctx,
+		"a",
+		"+351111111111",
+		"+351333333333",
+	)
+	if err != nil || len(involved) != 1 {
+		t.Error(involved, err)
+	}
+
+	other, err := db.GetMonetaryRequestWithDateString(ctx, "b", "2019-02", "s1")
+	if err != nil || other.From != "+351111111111" {
+		t.Error(other, err)
+	}
+
+	p, _ := db.GetProfile(ctx, "a")
+	p.PreviousPhones = append(p.PreviousPhones, p.Phone)
+	p.Phone = "+351333333333"
+	db.UpdateProfile(ctx, p)
+
+	id, err := db.GetProfileIdByPhoneNumber(ctx, "+351111111111")
+	if err != nil || id != "a" {
+		t.Error(id, err)
+	}
+}
+
+func TestDeviceRegistry(t *testing.T) {
+	ctx := context.Background()
+	db := newMemoryDB()
+	now := time.Now()
+	db.AddProfile(ctx, &Profile{UID: UID{Id: "a", Token: "legacy"}})
+	db.RegisterDevice(ctx, "a", Device{Token: "phone", Platform: PlatformAndroid, LastSeen: now})
+	db.RegisterDevice(ctx, "a", Device{Token: "tablet", Platform: PlatformIOS, LastSeen: now})
+	db.RegisterDevice(ctx, "a", Device{Token: "old", LastSeen: now.Add(-2 * DeviceStaleAfter)})
+
+	p, _ := db.GetProfile(ctx, "a")
+	if active := p.ActiveDevices(now); len(active) != 3 {
+		t.Error(active)
+	}
+
+	db.RemoveDeviceToken(ctx, "a", "legacy")
+	db.RemoveDeviceToken(ctx, "a", "tablet")
+	p, _ = db.GetProfile(ctx, "a")
+	active := p.ActiveDevices(now)
+	if len(active) != 1 || active[0].Token != "phone" {
+		t.Error(active)
+	}
+}
+
+func TestConfirmMirrored(t *testing.T) {
+	ctx := context.Background()
+	db := newMemoryDB()
+	mon := &MonetaryRequest{Snowflake: "s1"}
+	db.SetMirroredMonetaryRequest(ctx, mon, "MonetaryRequests/a/2019-02", "MonetaryRequests/b/2019-02", nil)
+	db.SetMonetaryRequest(ctx, "c", mon, "2019-02")
+
+	// Missing debtor copy leaves the creditor's untouched.
+	err := db.ConfirmMirroredMonetaryRequest(ctx, true, true, "MonetaryRequests/c/2019-02", "MonetaryRequests/d/2019-02", "s1", nil)
+	c, _ := db.GetMonetaryRequestWithDateString(ctx, "c", "2019-02", "s1")
+	if err == nil || c.ConfirmedFrom || c.ConfirmedTo {
+		t.Error(c, err)
+	}
+
+	db.ConfirmMirroredMonetaryRequest(ctx, true, true, "MonetaryRequests/a/2019-02", "MonetaryRequests/b/2019-02", "s1", nil)
+	// A later partial confirmation does not regress the other flag.
+	db.ConfirmMirroredMonetaryRequest(ctx, false, true, "MonetaryRequests/a/2019-02", "MonetaryRequests/b/2019-02", "s1", nil)
+	for _, uid := range []string{"a", "b"} {
+		m, _ := db.GetMonetaryRequestWithDateString(ctx, uid, "2019-02", "s1")
+		if !m.ConfirmedFrom || !m.ConfirmedTo {
+			t.Error(uid, m)
+		}
+	}
+}
+
+func TestGroups(t *testing.T) {
+	ctx := context.Background()
+	db := newMemoryDB()
+	g := &Group{
+		Name: "Trip",
+		Members: []GroupMember{
+			{ProfileId: "a", Role: RoleAdmin},
+			{Phone: "+351222222222", Role: RoleMember},
+		},
+	}
+	if _, err := db.AddGroup(ctx, &Group{Name: "Nobody runs it", Members: []GroupMember{{ProfileId: "a", Role: RoleMember}}}); !errors.Is(err, ErrInvalidEvent) {
+		t.Error("group without admin was added", err)
+	}
+	id, err := db.AddGroup(ctx, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Members known by phone are listed once they have a profile.
+	g.Members[1].ProfileId = "b"
+	if err := db.UpdateGroup(ctx, g); err != nil {
+		t.Fatal(err)
+	}
+	groups, _ := db.ListGroupsByMember(ctx, "b")
+	if len(groups) != 1 || groups[0].Id != id || !groups[0].IsAdmin("a") || groups[0].IsAdmin("+351222222222") {
+		t.Errorf("%+v", groups)
+	}
+
+	if err := db.DeleteGroup(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetGroup(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Error(err)
+	}
+}
+
+func TestMembershipChanges(t *testing.T) {
+	old := &Group{Members: []GroupMember{{ProfileId: "a"}, {Phone: "+351222222222"}}}
+	g := &Group{Members: []GroupMember{{ProfileId: "a"}, {ProfileId: "c"}}}
+	added, removed := MembershipChanges(old, g)
+	if len(added) != 1 || added[0].ProfileId != "c" || len(removed) != 1 || removed[0].Phone != "+351222222222" {
+		t.Error(added, removed)
+	}
+	if added, removed := MembershipChanges(nil, g); len(added) != 2 || len(removed) != 0 {
+		t.Error(added, removed)
+	}
+
+	// Members are the same by either profile id or phone.
+	joined := &Group{Members: []GroupMember{{ProfileId: "a"}, {ProfileId: "b", Phone: "+351222222222"}}}
+	if added, removed := MembershipChanges(old, joined); len(added) != 0 || len(removed) != 0 {
+		t.Error(added, removed)
+	}
+	if added, removed := MembershipChanges(joined, old); len(added) != 0 || len(removed) != 0 {
+		t.Error(added, removed)
+	}
+}
@@ -15,8 +15,19 @@ type MonetaryRequest struct {
 	ConfirmedFrom bool      `firestore:"confirmedFrom" json:"confirmedFrom"`
 	ConfirmedTo   bool      `firestore:"confirmedTo" json:"confirmedTo"`
 	Snowflake     string    `firestore:"snowflake" json:"snowflake"`
-	GroupId       int64     `firestore:"groupId" json:"groupId"`
 	RecurrentId   int64     `firestore:"recurrentId" json:"recurrentId"`
+	//Group is the id of the Group the request was divided among,
+	//if any. It replaces the numeric groupId older clients still
+	//write, which referenced no group and is ignored.
+	Group string `firestore:"group" json:"group"`
+}
+
+// StoredMonetaryRequest is one stored copy of a request,
+// with its collection path {Root}/{Uid}/{Date} and last write time.
+type StoredMonetaryRequest struct {
+	Path    string           `json:"path"`
+	Updated time.Time        `json:"updated"`
+	Request *MonetaryRequest `json:"request"`
 }
 
 type GroupRequest struct {
@@ -28,7 +39,30 @@ type GroupRequest struct {
 	AmountUnit  int64     `firestore:"amountUnit" json:"amountUnit"`
 	AmountCents int64     `firestore:"amountCents" json:"amountCents"`
 	Currency    string    `firestore:"currency" json:"currency"`
-	GroupId     int64     `firestore:"groupId" json:"groupId"`
+	//Group, when set, is the id of the Group whose members
+	//are charged, in place of Tos. Like that of MonetaryRequest,
+	//it replaces the numeric groupId.
+	Group string `firestore:"group" json:"group"`
+	//Payers, when set, paid the expense between them, in place of From.
+	//Amount is then the sum of what they paid.
+	Payers []Payer `firestore:"payers" json:"payers"`
+	//Participants, when set, split the expense by their Shares,
+	//in place of Tos, payers among them only if listed.
+	Participants []Participant `firestore:"participants" json:"participants"`
+}
+
+// Payer paid part of a group expense.
+type Payer struct {
+	Phone       string `firestore:"phone" json:"phone"`
+	AmountUnit  int64  `firestore:"amountUnit" json:"amountUnit"`
+	AmountCents int64  `firestore:"amountCents" json:"amountCents"`
+}
+
+// Participant takes Shares of a group expense, as many parts
+// of it as Shares are of the Shares of every participant.
+type Participant struct {
+	Phone  string `firestore:"phone" json:"phone"`
+	Shares int64  `firestore:"shares" json:"shares"`
 }
 
 type RecurrentRequest struct {
@@ -0,0 +1,38 @@
+package datastore
+
+import (
+	"time"
+)
+
+// Statuses an outbox Notification moves through.
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationDead    = "dead"
+)
+
+// Notification is an outbox entry, written alongside the change
+// it announces and delivered later by a dispatcher.
+type Notification struct {
+	//Key is the idempotency key and the outbox document id.
+	Key         string `firestore:"key" json:"key"`
+	Recipient   string `firestore:"recipient" json:"recipient"`
+	Action      string `firestore:"action" json:"action"`
+	Path        string `firestore:"path" json:"path"`
+	Snowflake   string `firestore:"snowflake" json:"snowflake"`
+	AmountUnit  int64  `firestore:"amountUnit" json:"amountUnit"`
+	AmountCents int64  `firestore:"amountCents" json:"amountCents"`
+	Currency    string `firestore:"currency" json:"currency"`
+	Name        string `firestore:"name" json:"name"`
+	Members     int64  `firestore:"members" json:"members"`
+
+	Status      string    `firestore:"status" json:"status"`
+	Attempts    int64     `firestore:"attempts" json:"attempts"`
+	NextAttempt time.Time `firestore:"nextAttempt" json:"nextAttempt"`
+	LastError   string    `firestore:"lastError" json:"lastError"`
+	//SentTokens are devices already reached, skipped on retries.
+	SentTokens []string  `firestore:"sentTokens" json:"sentTokens"`
+	Created    time.Time `firestore:"created" json:"created"`
+	//Trace is the trace id of the change enqueueing it, to log under.
+	Trace string `firestore:"trace" json:"trace"`
+}
@@ -1,5 +1,9 @@
 package datastore
 
+import (
+	"time"
+)
+
 type Profile struct {
 	UID
 	Metadata
@@ -14,11 +18,88 @@ type UID struct {
 	Token  string `firestore:"token" json:"token"`
 	Name   string `firestore:"name" json:"name"`
 	Email  string `firestore:"email" json:"email"`
+
+	//PreviousPhones are numbers the profile migrated away from,
+	//kept as aliases so older requests still resolve.
+	PreviousPhones []string `firestore:"previousPhones" json:"previousPhones"`
+	//Devices registered for push notifications, superseding Token.
+	Devices []Device `firestore:"devices" json:"devices"`
+	//Language is the preferred BCP 47 tag for notifications, e.g. pt-PT.
+	Language string `firestore:"language" json:"language"`
 	//	SignedPreKey io.ReadWriter
 	//	PreKeyBundle []io.ReadWriter
 }
 
+// Platforms a Device may report.
+const (
+	PlatformAndroid = "android"
+	PlatformIOS     = "ios"
+	PlatformWeb     = "web"
+)
+
+// DeviceStaleAfter is how long a device may go unseen before
+// it stops receiving notifications.
+const DeviceStaleAfter = 60 * 24 * time.Hour
+
+type Device struct {
+	Token      string    `firestore:"token" json:"token"`
+	Platform   string    `firestore:"platform" json:"platform"`
+	LastSeen   time.Time `firestore:"lastSeen" json:"lastSeen"`
+	AppVersion string    `firestore:"appVersion" json:"appVersion"`
+}
+
+// ActiveDevices returns the devices seen since DeviceStaleAfter before now.
+// A legacy Token not carried by any device is kept as an android device.
+func (p *Profile) ActiveDevices(now time.Time) []Device {
+	var active []Device
+	legacy := p.Token != ""
+	for _, d := range p.Devices {
+		if d.Token == p.Token {
+			legacy = false
+		}
+		if now.Sub(d.LastSeen) <= DeviceStaleAfter {
+			active = append(active, d)
+		}
+	}
+	if legacy {
+		active = append(active, Device{
+			Token:    p.Token,
+			Platform: PlatformAndroid,
+		})
+	}
+	return active
+}
+
+// UpsertDevice replaces the device sharing device's token, or appends it.
+func UpsertDevice(devices []Device, device Device) []Device {
+	for i, d := range devices {
+		if d.Token == device.Token {
+			devices[i] = device
+			return devices
+		}
+	}
+	return append(devices, device)
+}
+
+// RemoveDevice filters out the device holding token.
+func RemoveDevice(devices []Device, token string) []Device {
+	kept := devices[:0]
+	for _, d := range devices {
+		if d.Token != token {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
 type Metadata struct {
 	PaymentProviders []PaymentProvider `firestore:"paymentProviders" json:"paymentProviders"`
 	NumberPayments   int64             `firestore:"numberPayments" json:"numberPayments"`
 }
+
+// PhoneChange is written by a user under PhoneChanges/{userId}
+// after verifying the new number with Firebase Auth.
+type PhoneChange struct {
+	NewPhone string    `firestore:"newPhone" json:"newPhone"`
+	Date     time.Time `firestore:"date" json:"date"`
+}
@@ -0,0 +1,323 @@
+// Package deadletter captures trigger events handlers fail on for good,
+// with their payload and error, so they are neither retried forever
+// nor lost, and can be inspected, edited and replayed later.
+package deadletter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+	"github.com/Seriyin/GiveMeBackend/config/logging"
+	"github.com/Seriyin/GiveMeBackend/config/services"
+	"github.com/Seriyin/GiveMeBackend/config/telemetry"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
+)
+
+// DefaultMaxAttempts is how often a retryable failure is retried
+// before its event is given up on.
+const DefaultMaxAttempts = 5
+
+// Entry is the deployed entry point of the handler named name,
+// built by newHandler over the default services on every event.
+// Events it keeps failing on are dead-lettered, not retried forever,
+// as Guard does.
+func Entry(
+	name string,
+	newHandler func(c *services.Container) (trigger.Handler, error),
+) trigger.Handler {
+	return func(
+		ctx context.Context,
+		e firestore.Event,
+	) error {
+		c := services.Default()
+		h, err := newHandler(c)
+		if err != nil {
+			return err
+		}
+		db, err := c.DB()
+		if err != nil {
+			return err
+		}
+		return Guard(ctx, db, name, DefaultMaxAttempts, e, h)
+	}
+}
+
+// Guard runs h on e, counting its failures under handler. An event
+// failing permanently, or maxAttempts times, is captured as dead and
+// acknowledged, other failures are returned to be retried.
+// Failures that cannot be captured are always retried, and a retry
+// that succeeds resolves the letter its failures left.
+// Each run is traced, and telemetry flushed once it is over.
+func Guard(
+	ctx context.Context,
+	db datastore.GiveMeDatabase,
+	handler string,
+	maxAttempts int64,
+	e firestore.Event,
+	h trigger.Handler,
+) error {
+	ctx = logging.ForEvent(ctx, handler, e.Value.Name)
+	defer telemetry.Flush(ctx)
+	err := telemetry.Handle(ctx, "handler."+handler, func(ctx context.Context) error {
+		return h(ctx, e)
+	})
+	if err == nil {
+		if resolveErr := resolve(ctx, db, handler, e); resolveErr != nil {
+			logging.Warning(ctx, "Could not resolve retried event", "error", resolveErr)
+		}
+		return nil
+	}
+
+	letter, captureErr := capture(ctx, db, handler, maxAttempts, e, err)
+	if captureErr != nil {
+		logging.Error(ctx, "Could not capture failed event", "error", captureErr)
+		return err
+	}
+	if letter.Status != datastore.DeadLetterDead {
+		return err
+	}
+	logging.Error(
+		ctx,
+		"Dead-lettered event",
+		"id", letter.Id,
+		"attempts", letter.Attempts,
+		"error", err,
+	)
+	return nil
+}
+
+// capture counts the failure of e under handler, keeping the event
+// as last received, and gives up on it as Guard documents.
+func capture(
+	ctx context.Context,
+	db datastore.GiveMeDatabase,
+	handler string,
+	maxAttempts int64,
+	e firestore.Event,
+	failure error,
+) (*datastore.DeadLetter, error) {
+	id, eventId, payload, err := identify(ctx, handler, e)
+	if err != nil {
+		return nil, err
+	}
+	return count(ctx, db, handler, maxAttempts, id, eventId, payload, failure)
+}
+
+// count records the failure of the event id, eventId, as payload.
+func count(
+	ctx context.Context,
+	db datastore.GiveMeDatabase,
+	handler string,
+	maxAttempts int64,
+	id string,
+	eventId string,
+	payload []byte,
+	failure error,
+) (*datastore.DeadLetter, error) {
+	now := time.Now()
+	letter, err := db.GetDeadLetter(ctx, id)
+	switch {
+	case errors.Is(err, datastore.ErrNotFound):
+		letter = &datastore.DeadLetter{
+			Id:      id,
+			Handler: handler,
+			EventId: eventId,
+			First:   now,
+		}
+	case err != nil:
+		return nil, err
+	}
+	letter.Payload = string(payload)
+	letter.Error = failure.Error()
+	letter.Attempts++
+	letter.Last = now
+	letter.Status = datastore.DeadLetterRetrying
+	if !datastore.Retryable(failure) || letter.Attempts >= maxAttempts {
+		letter.Status = datastore.DeadLetterDead
+	}
+	if err := db.SetDeadLetter(ctx, letter); err != nil {
+		return nil, err
+	}
+	return letter, nil
+}
+
+// Reject is the trigger.Rejecter of handler, over the default
+// services, keeping what it could not decode as dead at once.
+func Reject(handler string) trigger.Rejecter {
+	return func(
+		ctx context.Context,
+		payload []byte,
+		err error,
+	) error {
+		db, dbErr := services.Default().DB()
+		if dbErr != nil {
+			return dbErr
+		}
+		return reject(ctx, db, handler, payload, err)
+	}
+}
+
+// reject captures payload, which handler could not decode an event
+// from, as dead, keyed by its JSON as it carries no usable event id.
+// The letter can be edited into an event and replayed.
+func reject(
+	ctx context.Context,
+	db datastore.GiveMeDatabase,
+	handler string,
+	payload []byte,
+	failure error,
+) error {
+	if datastore.Retryable(failure) {
+		failure = datastore.NewError(datastore.ErrInvalidEvent, "%v", failure)
+	}
+	letter, err := count(ctx, db, handler, DefaultMaxAttempts, Key(handler, "", payload), "", payload, failure)
+	if err != nil {
+		logging.Error(ctx, "Could not capture undecodable event", "error", err)
+		return err
+	}
+	logging.Error(ctx, "Dead-lettered undecodable event", "id", letter.Id, "error", failure)
+	return nil
+}
+
+// resolve marks the letter of an earlier failure of e under handler
+// resolved, now that a retry succeeded. Most events never failed
+// and have none.
+func resolve(
+	ctx context.Context,
+	db datastore.GiveMeDatabase,
+	handler string,
+	e firestore.Event,
+) error {
+	id, _, _, err := identify(ctx, handler, e)
+	if err != nil {
+		return err
+	}
+	letter, err := db.GetDeadLetter(ctx, id)
+	switch {
+	case errors.Is(err, datastore.ErrNotFound):
+		return nil
+	case err != nil:
+		return err
+	}
+	if letter.Status == datastore.DeadLetterResolved {
+		return nil
+	}
+	letter.Status = datastore.DeadLetterResolved
+	letter.Last = time.Now()
+	return db.SetDeadLetter(ctx, letter)
+}
+
+// identify keys e under handler by the id of the event in ctx,
+// also returned with the JSON of e.
+func identify(
+	ctx context.Context,
+	handler string,
+	e firestore.Event,
+) (string, string, []byte, error) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("deadletter: could not encode event: %v", err)
+	}
+	eventId := ""
+	if meta, err := metadata.FromContext(ctx); err == nil {
+		eventId = meta.EventID
+	}
+	return Key(handler, eventId, payload), eventId, payload, nil
+}
+
+// Key identifies the event eventId of handler, or without an id,
+// as in local runs, the event whose JSON is payload.
+func Key(
+	handler string,
+	eventId string,
+	payload []byte,
+) string {
+	if eventId == "" {
+		eventId = fmt.Sprintf("sha256-%x", sha256.Sum256(payload))[:23]
+	}
+	return handler + ":" + eventId
+}
+
+// Decode reads the event captured in letter.
+func Decode(letter *datastore.DeadLetter) (firestore.Event, error) {
+	var e firestore.Event
+	if err := json.Unmarshal([]byte(letter.Payload), &e); err != nil {
+		return e, datastore.NewError(
+			datastore.ErrInvalidEvent,
+			"deadletter: malformed payload of %v: %v",
+			letter.Id,
+			err,
+		)
+	}
+	if e.Value.Name == "" && e.OldValue.Name == "" {
+		return e, datastore.NewError(
+			datastore.ErrInvalidEvent,
+			"deadletter: payload of %v names no document",
+			letter.Id,
+		)
+	}
+	return e, nil
+}
+
+// Edit replaces the payload of the letter id, to replay it fixed.
+func Edit(
+	ctx context.Context,
+	db datastore.GiveMeDatabase,
+	id string,
+	payload []byte,
+) (*datastore.DeadLetter, error) {
+	letter, err := db.GetDeadLetter(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	letter.Payload = string(payload)
+	if _, err := Decode(letter); err != nil {
+		return nil, err
+	}
+	return letter, db.SetDeadLetter(ctx, letter)
+}
+
+// Replay runs h on the event of the letter id, under its event id,
+// so idempotent handlers still skip what they applied. The letter is
+// resolved when h succeeds, and keeps counting attempts otherwise.
+func Replay(
+	ctx context.Context,
+	db datastore.GiveMeDatabase,
+	id string,
+	h trigger.Handler,
+) (*datastore.DeadLetter, error) {
+	letter, err := db.GetDeadLetter(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	e, err := Decode(letter)
+	if err != nil {
+		return letter, err
+	}
+
+	now := time.Now()
+	ctx = metadata.NewContext(ctx, &metadata.Metadata{
+		EventID:   letter.EventId,
+		Timestamp: now,
+	})
+	failure := h(ctx, e)
+	letter.Last = now
+	if failure != nil {
+		letter.Attempts++
+		letter.Error = failure.Error()
+	} else {
+		letter.Status = datastore.DeadLetterResolved
+	}
+	if err := db.SetDeadLetter(ctx, letter); err != nil {
+		return letter, err
+	}
+	return letter, failure
+}
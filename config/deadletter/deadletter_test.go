@@ -0,0 +1,180 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/functions/metadata"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+)
+
+const name = "projects/p/databases/(default)/documents/MonetaryRequests/a/2019-02/s1"
+
+func event() firestore.Event {
+	var e firestore.Event
+	e.Value.Name = name
+	e.Value.Fields = []byte(`{"amountUnit":{"stringValue":"five"}}`)
+	return e
+}
+
+func TestGuardPermanent(t *testing.T) {
+	db := datastore.NewMemoryDB()
+	ctx := metadata.NewContext(
+		context.Background(),
+		&metadata.Metadata{EventID: "e1"},
+	)
+	decode := func(ctx context.Context, e firestore.Event) error {
+		_, err := firestore.UnmarshallAndConvertMonetary(e.Value.Fields)
+		return err
+	}
+
+	// Undecodable events are captured at once, and acknowledged.
+	if err := Guard(ctx, db, "request", DefaultMaxAttempts, event(), decode); err != nil {
+		t.Fatal(err)
+	}
+	letter, err := db.GetDeadLetter(ctx, "request:e1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if letter.Status != datastore.DeadLetterDead || letter.Attempts != 1 ||
+		letter.Handler != "request" || letter.EventId != "e1" || letter.Error == "" {
+		t.Errorf("%+v", letter)
+	}
+	if e, err := Decode(letter); err != nil || e.Value.Name != name {
+		t.Error(e, err)
+	}
+}
+
+func TestGuardRetryable(t *testing.T) {
+	db := datastore.NewMemoryDB()
+	ctx := context.Background()
+	transient := datastore.NewError(datastore.ErrUnavailable, "timed out")
+	fail := func(ctx context.Context, e firestore.Event) error {
+		return transient
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := Guard(ctx, db, "confirm", 3, event(), fail); err != transient {
+			t.Fatal(i, err)
+		}
+	}
+	letters, _ := db.ListDeadLetters(ctx, datastore.DeadLetterRetrying)
+	if len(letters) != 1 || letters[0].Attempts != 2 {
+		t.Fatalf("%+v", letters)
+	}
+	// Without an event id, the payload identifies the event.
+	if letters[0].EventId != "" || letters[0].Id != Key("confirm", "", []byte(letters[0].Payload)) {
+		t.Errorf("%+v", letters[0])
+	}
+
+	// The last attempt gives up on the event.
+	if err := Guard(ctx, db, "confirm", 3, event(), fail); err != nil {
+		t.Fatal(err)
+	}
+	letters, _ = db.ListDeadLetters(ctx, datastore.DeadLetterDead)
+	if len(letters) != 1 || letters[0].Attempts != 3 {
+		t.Fatalf("%+v", letters)
+	}
+}
+
+func TestGuardResolvesRetried(t *testing.T) {
+	db := datastore.NewMemoryDB()
+	ctx := metadata.NewContext(
+		context.Background(),
+		&metadata.Metadata{EventID: "e1"},
+	)
+	failures := 1
+	flaky := func(ctx context.Context, e firestore.Event) error {
+		if failures > 0 {
+			failures--
+			return datastore.NewError(datastore.ErrUnavailable, "timed out")
+		}
+		return nil
+	}
+
+	if err := Guard(ctx, db, "confirm", 3, event(), flaky); err == nil {
+		t.Fatal("first attempt succeeded")
+	}
+	if err := Guard(ctx, db, "confirm", 3, event(), flaky); err != nil {
+		t.Fatal(err)
+	}
+	letter, err := db.GetDeadLetter(ctx, "confirm:e1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if letter.Status != datastore.DeadLetterResolved || letter.Attempts != 1 {
+		t.Errorf("%+v", letter)
+	}
+	if letters, _ := db.ListDeadLetters(ctx, datastore.DeadLetterRetrying); len(letters) != 0 {
+		t.Errorf("%+v", letters)
+	}
+}
+
+func TestRejectUndecodable(t *testing.T) {
+	db := datastore.NewMemoryDB()
+	ctx := context.Background()
+	payload := []byte(`{"specversion":`)
+	malformed := errors.New("malformed CloudEvent")
+
+	// Captured dead at once, redeliveries keep the one letter.
+	for i := 0; i < 2; i++ {
+		if err := reject(ctx, db, "request", payload, malformed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	letters, _ := db.ListDeadLetters(ctx, datastore.DeadLetterDead)
+	if len(letters) != 1 || letters[0].Payload != string(payload) ||
+		letters[0].Id != Key("request", "", payload) || letters[0].Handler != "request" {
+		t.Fatalf("%+v", letters)
+	}
+	// It names no document until edited into an event.
+	if _, err := Decode(letters[0]); !errors.Is(err, datastore.ErrInvalidEvent) {
+		t.Error(err)
+	}
+}
+
+func TestEditAndReplay(t *testing.T) {
+	db := datastore.NewMemoryDB()
+	ctx := context.Background()
+	var replayed firestore.Event
+	var replayedId string
+	h := func(ctx context.Context, e firestore.Event) error {
+		if m, err := metadata.FromContext(ctx); err == nil {
+			replayedId = m.EventID
+		}
+		replayed = e
+		_, err := firestore.UnmarshallAndConvertMonetary(e.Value.Fields)
+		return err
+	}
+	db.SetDeadLetter(ctx, &datastore.DeadLetter{
+		Id:       "request:e1",
+		Handler:  "request",
+		EventId:  "e1",
+		Payload:  `{"value":{"name":"` + name + `","fields":{"amountUnit":{"stringValue":"five"}}}}`,
+		Status:   datastore.DeadLetterDead,
+		Attempts: 1,
+	})
+
+	letter, err := Replay(ctx, db, "request:e1", h)
+	if err == nil || letter.Attempts != 2 || letter.Status != datastore.DeadLetterDead {
+		t.Fatalf("%+v %v", letter, err)
+	}
+
+	if _, err := Edit(ctx, db, "request:e1", []byte(`{"value":{}}`)); !errors.Is(err, datastore.ErrInvalidEvent) {
+		t.Error(err)
+	}
+	fixed := `{"value":{"name":"` + name + `","fields":{"amountUnit":{"integerValue":"5"}}}}`
+	if _, err := Edit(ctx, db, "request:e1", []byte(fixed)); err != nil {
+		t.Fatal(err)
+	}
+	letter, err = Replay(ctx, db, "request:e1", h)
+	if err != nil || letter.Status != datastore.DeadLetterResolved {
+		t.Fatalf("%+v %v", letter, err)
+	}
+	if replayedId != "e1" || replayed.Value.Name != name {
+		t.Error(replayedId, replayed)
+	}
+}
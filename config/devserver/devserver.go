@@ -0,0 +1,406 @@
+// Package devserver simulates Firestore triggers over the in-memory
+// datastore, so the functions can be driven end to end on a laptop.
+// Documents written through it, or by the functions themselves,
+// fire the handlers routed to their path, and notifications enqueued
+// on the way are dispatched to a recording notifier.
+package devserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/paths"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/schema"
+	"github.com/Seriyin/GiveMeBackend/config/outbox"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
+)
+
+// Document events a Route listens to.
+const (
+	Create = "create"
+	Update = "update"
+)
+
+// namePrefix turns document paths into the resource names events carry.
+const namePrefix = "projects/local/databases/(default)/documents/"
+
+// Route fires Handler on Kind events of documents matching Pattern,
+// a path whose {braced} segments match any id, as deployed triggers do.
+type Route struct {
+	Pattern string
+	Kind    string
+	Name    string
+	Handler trigger.Handler
+}
+
+func (r Route) matches(path string) bool {
+	pattern := strings.Split(r.Pattern, "/")
+	segments := strings.Split(path, "/")
+	if len(pattern) != len(segments) {
+		return false
+	}
+	for i, p := range pattern {
+		if !strings.HasPrefix(p, "{") && p != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Fired is one handler invocation.
+type Fired struct {
+	Id       int             `json:"id"`
+	EventId  string          `json:"eventId"`
+	Function string          `json:"function"`
+	Kind     string          `json:"kind"`
+	Path     string          `json:"path"`
+	Error    string          `json:"error,omitempty"`
+	Event    firestore.Event `json:"event"`
+}
+
+// write is a document write waiting to fire its triggers.
+type write struct {
+	path   string
+	fields json.RawMessage
+}
+
+// Server holds the simulated documents and the log of fired handlers.
+type Server struct {
+	DB         datastore.GiveMeDatabase
+	Notifier   *messaging.RecordingNotifier
+	Dispatcher *outbox.Dispatcher
+	Routes     []Route
+	// MaxEvents bounds the handlers one write may cascade into,
+	// so handlers rewriting each other's documents cannot spin forever.
+	MaxEvents int
+
+	// run serialises writes, so cascades do not interleave.
+	run sync.Mutex
+
+	mutex   sync.Mutex
+	docs    map[string]json.RawMessage
+	pending []write
+	fired   []*Fired
+}
+
+// New creates a Server over db, which must report its request writes
+// to Observe, as a database from datastore.NewObservedMemoryDB does.
+func New(
+	db datastore.GiveMeDatabase,
+	notifier *messaging.RecordingNotifier,
+	routes []Route,
+) *Server {
+	return &Server{
+		DB:         db,
+		Notifier:   notifier,
+		Dispatcher: outbox.NewDispatcher(db, notifier),
+		Routes:     routes,
+		MaxEvents:  100,
+		docs:       make(map[string]json.RawMessage),
+	}
+}
+
+// Observe queues a request written to the datastore, to fire its
+// triggers once the current handler returns. It never calls the datastore.
+func (s *Server) Observe(
+	fullPath string,
+	transfer *datastore.MonetaryRequest,
+) {
+	fields, err := firestore.EncodeFields(transfer)
+	if err != nil {
+		// MonetaryRequest has nothing EncodeFields rejects.
+		panic(err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pending = append(s.pending, write{fullPath + "/" + transfer.Snowflake, fields})
+}
+
+// Write stores the fields of the document at path, as a client would,
+// and runs every handler the write cascades into.
+// Requests, profiles and groups are stored in the datastore for the handlers.
+func (s *Server) Write(
+	ctx context.Context,
+	path string,
+	fields json.RawMessage,
+) ([]*Fired, error) {
+	s.run.Lock()
+	defer s.run.Unlock()
+
+	segments := strings.Split(path, "/")
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("devserver: malformed document path %q", path)
+		}
+	}
+	if len(segments)%2 != 0 {
+		return nil, fmt.Errorf("devserver: %q is a collection, not a document", path)
+	}
+
+	switch segments[0] {
+	case schema.MonetaryRequests:
+		p, err := paths.Parse(path)
+		if err != nil {
+			return nil, err
+		}
+		mon := &datastore.MonetaryRequest{}
+		if err := firestore.DecodeFields(fields, mon); err != nil {
+			return nil, err
+		}
+		mon.Snowflake = p.Snowflake
+		// Observed, which queues the write.
+		if _, err := s.DB.SetMonetaryRequestByFullPath(ctx, mon, p.Collection()); err != nil {
+			return nil, err
+		}
+	case schema.Profiles:
+		profile := &datastore.Profile{}
+		if err := firestore.DecodeFields(fields, profile); err != nil {
+			return nil, err
+		}
+		profile.Id = segments[1]
+		if err := s.DB.UpdateProfile(ctx, profile); err != nil {
+			return nil, err
+		}
+		s.queue(path, fields)
+	case schema.Groups:
+		g := &datastore.Group{}
+		if err := firestore.DecodeFields(fields, g); err != nil {
+			return nil, err
+		}
+		g.Id = segments[1]
+		if _, err := s.DB.GetGroup(ctx, g.Id); err == nil {
+			err = s.DB.UpdateGroup(ctx, g)
+			if err != nil {
+				return nil, err
+			}
+		} else if _, err := s.DB.AddGroup(ctx, g); err != nil {
+			return nil, err
+		}
+		s.queue(path, fields)
+	default:
+		s.queue(path, fields)
+	}
+	return s.drain(ctx)
+}
+
+// Invoke runs the handler named function on e directly,
+// then every handler its writes cascade into.
+func (s *Server) Invoke(
+	ctx context.Context,
+	function string,
+	e firestore.Event,
+) ([]*Fired, error) {
+	s.run.Lock()
+	defer s.run.Unlock()
+
+	for _, r := range s.Routes {
+		if r.Name == function {
+			kind := Update
+			if len(e.OldValue.Fields) == 0 {
+				kind = Create
+			}
+			f := s.fire(ctx, r, kind, "", e)
+			rest, err := s.drain(ctx)
+			return append([]*Fired{f}, rest...), err
+		}
+	}
+	return nil, fmt.Errorf("devserver: no function %v", function)
+}
+
+// Replay fires the logged invocation id again, with its event id,
+// to exercise deduplication, or with a new one when fresh.
+func (s *Server) Replay(
+	ctx context.Context,
+	id int,
+	fresh bool,
+) ([]*Fired, error) {
+	s.run.Lock()
+	defer s.run.Unlock()
+
+	s.mutex.Lock()
+	if id < 0 || id >= len(s.fired) {
+		s.mutex.Unlock()
+		return nil, fmt.Errorf("devserver: no event %v", id)
+	}
+	old := s.fired[id]
+	s.mutex.Unlock()
+
+	eventId := old.EventId
+	if fresh {
+		eventId = ""
+	}
+	for _, r := range s.Routes {
+		if r.Name == old.Function {
+			f := s.fire(ctx, r, old.Kind, eventId, old.Event)
+			rest, err := s.drain(ctx)
+			return append([]*Fired{f}, rest...), err
+		}
+	}
+	return nil, fmt.Errorf("devserver: no function %v", old.Function)
+}
+
+// Fired returns the log of every handler invocation.
+func (s *Server) Fired() []*Fired {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]*Fired(nil), s.fired...)
+}
+
+// Document returns the fields last written to path.
+func (s *Server) Document(path string) (json.RawMessage, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	fields, ok := s.docs[path]
+	return fields, ok
+}
+
+func (s *Server) queue(
+	path string,
+	fields json.RawMessage,
+) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pending = append(s.pending, write{path, fields})
+}
+
+// drain fires the triggers of queued writes until none are left,
+// dispatching the notifications enqueued meanwhile.
+func (s *Server) drain(ctx context.Context) ([]*Fired, error) {
+	var fired []*Fired
+	for {
+		s.mutex.Lock()
+		if len(s.pending) == 0 {
+			s.mutex.Unlock()
+			break
+		}
+		w := s.pending[0]
+		s.pending = s.pending[1:]
+		old, existed := s.docs[w.path]
+		s.docs[w.path] = w.fields
+		s.mutex.Unlock()
+
+		mask, err := changedFields(old, w.fields)
+		if err != nil {
+			return fired, err
+		}
+		// Firestore fires nothing for writes changing nothing.
+		if existed && len(mask) == 0 {
+			continue
+		}
+
+		var e firestore.Event
+		e.Value = firestore.Value{
+			Name:       namePrefix + w.path,
+			Fields:     w.fields,
+			UpdateTime: time.Now(),
+		}
+		kind := Create
+		if existed {
+			kind = Update
+			e.OldValue = firestore.Value{Name: namePrefix + w.path, Fields: old}
+			e.UpdateMask.FieldPaths = mask
+		}
+		for _, r := range s.Routes {
+			if r.Kind != kind || !r.matches(w.path) {
+				continue
+			}
+			if len(fired) >= s.MaxEvents {
+				return fired, fmt.Errorf("devserver: more than %v events, handlers may be looping", s.MaxEvents)
+			}
+			fired = append(fired, s.fire(ctx, r, kind, "", e))
+		}
+	}
+	return fired, s.Dispatcher.DispatchDue(ctx, s.MaxEvents)
+}
+
+// fire runs r on e under eventId, or a new id when empty.
+func (s *Server) fire(
+	ctx context.Context,
+	r Route,
+	kind string,
+	eventId string,
+	e firestore.Event,
+) *Fired {
+	s.mutex.Lock()
+	f := &Fired{
+		Id:       len(s.fired),
+		EventId:  eventId,
+		Function: r.Name,
+		Kind:     kind,
+		Path:     strings.TrimPrefix(e.Value.Name, namePrefix),
+		Event:    e,
+	}
+	if f.EventId == "" {
+		f.EventId = "local-" + strconv.Itoa(f.Id)
+	}
+	s.fired = append(s.fired, f)
+	s.mutex.Unlock()
+
+	ctx = metadata.NewContext(ctx, &metadata.Metadata{
+		EventID:   f.EventId,
+		Timestamp: time.Now(),
+		EventType: trigger.FirestoreEventPrefix + kind + "d",
+		Resource:  &metadata.Resource{Name: e.Value.Name},
+	})
+	if err := r.Handler(ctx, e); err != nil {
+		s.mutex.Lock()
+		f.Error = err.Error()
+		s.mutex.Unlock()
+	}
+	return f
+}
+
+// changedFields lists the top-level fields differing between
+// two encodings of a document.
+func changedFields(
+	old json.RawMessage,
+	new json.RawMessage,
+) ([]string, error) {
+	var o, n map[string]json.RawMessage
+	if len(old) > 0 {
+		if err := json.Unmarshal(old, &o); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(new, &n); err != nil {
+		return nil, fmt.Errorf("devserver: malformed fields: %v", err)
+	}
+	changes := make(map[string]bool)
+	for k, v := range n {
+		if !jsonEqual(o[k], v) {
+			changes[k] = true
+		}
+	}
+	for k := range o {
+		if _, ok := n[k]; !ok {
+			changes[k] = true
+		}
+	}
+	var mask []string
+	for k := range changes {
+		mask = append(mask, k)
+	}
+	sort.Strings(mask)
+	return mask, nil
+}
+
+// jsonEqual compares JSON values regardless of formatting.
+func jsonEqual(a json.RawMessage, b json.RawMessage) bool {
+	var x, y interface{}
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
@@ -0,0 +1,116 @@
+package devserver
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/paths"
+	"github.com/Seriyin/GiveMeBackend/config/outbox"
+)
+
+func newServer(routes func(db datastore.GiveMeDatabase) []Route) *Server {
+	var s *Server
+	db := datastore.NewObservedMemoryDB(func(fullPath string, transfer *datastore.MonetaryRequest) {
+		s.Observe(fullPath, transfer)
+	})
+	s = New(db, &messaging.RecordingNotifier{}, routes(db))
+	return s
+}
+
+func TestTriggerCascade(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(func(db datastore.GiveMeDatabase) []Route {
+		// A stand-in for Request, mirroring the creditor's copy.
+		request := func(ctx context.Context, e firestore.Event) error {
+			mon, err := firestore.UnmarshallAndConvertMonetary(e.Value.Fields)
+			if err != nil {
+				return err
+			}
+			profile, err := db.GetProfileByPhoneNumber(ctx, mon.To)
+			if err != nil {
+				return err
+			}
+			path, err := paths.Parse(e.Value.Name)
+			if err != nil {
+				return err
+			}
+			dbPath := path.WithOwner(profile.Id).Collection()
+			_, err = db.SetMonetaryRequestByFullPathWithOutbox(ctx, mon, dbPath, []*datastore.Notification{
+				outbox.New(ctx, messaging.ActionRequest, profile.Id, mon, messaging.Link{Path: dbPath, Snowflake: mon.Snowflake}, mon.From),
+			})
+			return err
+		}
+		return []Route{
+			{Pattern: "MonetaryRequests/{uid}/{month}/{id}", Kind: Create, Name: "Request", Handler: request},
+			{Pattern: "MonetaryRequests/{uid}/{month}/{id}", Kind: Update, Name: "Confirm", Handler: func(context.Context, firestore.Event) error { return nil }},
+		}
+	})
+
+	fired, err := s.Write(ctx, "Profiles/b", []byte(`{"phone":{"stringValue":"+351222222222"},"devices":{"arrayValue":{"values":[{"mapValue":{"fields":{"token":{"stringValue":"t"},"lastSeen":{"timestampValue":"`+time.Now().UTC().Format(time.RFC3339)+`"}}}}]}}}`))
+	if err != nil || len(fired) != 0 {
+		t.Fatal(fired, err)
+	}
+
+	request := `{"from":{"stringValue":"+351111111111"},"to":{"stringValue":"+351222222222"},"amountUnit":{"integerValue":"5"}}`
+	fired, err = s.Write(ctx, "MonetaryRequests/a/2019-02/s1", []byte(request))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The creditor's copy, then the debtor's, which rewrites itself unchanged.
+	if len(fired) != 2 || fired[0].Path != "MonetaryRequests/a/2019-02/s1" || fired[1].Path != "MonetaryRequests/b/2019-02/s1" {
+		t.Fatal(fired)
+	}
+	for _, f := range fired {
+		if f.Function != "Request" || f.Error != "" {
+			t.Error(f)
+		}
+	}
+	if sent := s.Notifier.Messages(); len(sent) != 1 || sent[0].Token != "t" {
+		t.Error(sent)
+	}
+
+	fired, err = s.Write(ctx, "MonetaryRequests/a/2019-02/s1", []byte(strings.Replace(request, `"5"`, `"5"},"confirmedTo":{"booleanValue":true`, 1)))
+	if err != nil || len(fired) != 1 || fired[0].Function != "Confirm" {
+		t.Fatal(fired, err)
+	}
+	if mask := fired[0].Event.UpdateMask.FieldPaths; len(mask) != 1 || mask[0] != "confirmedTo" {
+		t.Error(mask)
+	}
+
+	fired, _ = s.Replay(ctx, 0, false)
+	if len(fired) != 1 || fired[0].EventId != "local-0" || fired[0].Id != 3 {
+		t.Error(fired)
+	}
+	if len(s.Fired()) != 4 {
+		t.Error(s.Fired())
+	}
+}
+
+func TestRunawayHandlers(t *testing.T) {
+	s := newServer(func(db datastore.GiveMeDatabase) []Route {
+		bump := func(ctx context.Context, e firestore.Event) error {
+			mon, _ := firestore.UnmarshallAndConvertMonetary(e.Value.Fields)
+			mon.AmountUnit++
+			_, err := db.SetMonetaryRequestByFullPath(ctx, mon, "MonetaryRequests/a/2019-02")
+			return err
+		}
+		return []Route{
+			{Pattern: "MonetaryRequests/{uid}/{month}/{id}", Kind: Create, Name: "Bump", Handler: bump},
+			{Pattern: "MonetaryRequests/{uid}/{month}/{id}", Kind: Update, Name: "Bump", Handler: bump},
+		}
+	})
+	s.MaxEvents = 10
+	fired, err := s.Write(context.Background(), "MonetaryRequests/a/2019-02/s1", []byte(`{}`))
+	if err == nil || len(fired) != 10 {
+		t.Error(len(fired), err)
+	}
+
+	if _, err := s.Write(context.Background(), "MonetaryRequests/a/2019-02", []byte(`{}`)); err == nil {
+		t.Error("wrote a collection")
+	}
+}
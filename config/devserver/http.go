@@ -0,0 +1,112 @@
+package devserver
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+)
+
+// ServeHTTP exposes the Server:
+//
+//	PUT  /documents/{path}          write fields, as in example.json
+//	GET  /documents/{path}          read the fields last written
+//	POST /functions/{name}          run a function on a whole event
+//	GET  /events                    list every invocation
+//	POST /events/{id}/replay[?fresh] fire an invocation again
+//	GET  /notifications             list the messages sent
+func (s *Server) ServeHTTP(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	ctx := r.Context()
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/documents/"):
+		path := strings.TrimPrefix(r.URL.Path, "/documents/")
+		switch r.Method {
+		case http.MethodGet:
+			fields, ok := s.Document(path)
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			writeJSON(w, fields)
+		case http.MethodPut, http.MethodPost, http.MethodPatch:
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			fired, err := s.Write(ctx, path, body)
+			respond(w, fired, err)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	case strings.HasPrefix(r.URL.Path, "/functions/") && r.Method == http.MethodPost:
+		var e firestore.Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fired, err := s.Invoke(ctx, strings.TrimPrefix(r.URL.Path, "/functions/"), e)
+		respond(w, fired, err)
+
+	case r.URL.Path == "/events" && r.Method == http.MethodGet:
+		writeJSON(w, s.Fired())
+
+	case strings.HasPrefix(r.URL.Path, "/events/") &&
+		strings.HasSuffix(r.URL.Path, "/replay") &&
+		r.Method == http.MethodPost:
+		id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/events/"), "/replay"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, fresh := r.URL.Query()["fresh"]
+		fired, err := s.Replay(ctx, id, fresh)
+		respond(w, fired, err)
+
+	case r.URL.Path == "/notifications" && r.Method == http.MethodGet:
+		writeJSON(w, s.Notifier.Messages())
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// respond writes what fired, with the error of the write if any.
+// Handler errors are reported per invocation, not as failures.
+func respond(
+	w http.ResponseWriter,
+	fired []*Fired,
+	err error,
+) {
+	if err != nil {
+		log.Print(err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(struct {
+			Error string   `json:"error"`
+			Fired []*Fired `json:"fired"`
+		}{err.Error(), fired})
+		return
+	}
+	writeJSON(w, fired)
+}
+
+func writeJSON(
+	w http.ResponseWriter,
+	v interface{},
+) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,75 @@
+package firestore
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Change is one top-level field that differs between
+// the old and the new value of a document.
+type Change struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+// ChangeSet holds the changed fields of an update, by firestore name.
+type ChangeSet map[string]Change
+
+// Changes decodes the old and the new value of e into old and new,
+// pointers to the same struct type, and compares them field by field.
+// On creates the old value stays zero, so every set field is changed.
+func (e Event) Changes(
+	old interface{},
+	new interface{},
+) (ChangeSet, error) {
+	if reflect.TypeOf(old) != reflect.TypeOf(new) {
+		return nil, fmt.Errorf("firestore: cannot compare %T with %T", old, new)
+	}
+	if len(e.OldValue.Fields) > 0 {
+		if err := DecodeFields(e.OldValue.Fields, old); err != nil {
+			return nil, fmt.Errorf("firestore: old value: %w", err)
+		}
+	}
+	if err := DecodeFields(e.Value.Fields, new); err != nil {
+		return nil, err
+	}
+
+	oldFields := structFields(reflect.ValueOf(old).Elem())
+	changes := make(ChangeSet)
+	for name, f := range structFields(reflect.ValueOf(new).Elem()) {
+		o := oldFields[name].Interface()
+		n := f.Interface()
+		if !reflect.DeepEqual(o, n) {
+			changes[name] = Change{Field: name, Old: o, New: n}
+		}
+	}
+	return changes, nil
+}
+
+// Changed reports whether field changed.
+func (c ChangeSet) Changed(field string) bool {
+	_, ok := c[field]
+	return ok
+}
+
+// Became reports whether field changed to v, such as
+// Became("confirmedTo", true) for a false to true transition.
+func (c ChangeSet) Became(
+	field string,
+	v interface{},
+) bool {
+	change, ok := c[field]
+	return ok && reflect.DeepEqual(change.New, v)
+}
+
+// Fields lists the changed fields in order.
+func (c ChangeSet) Fields() []string {
+	fields := make([]string, 0, len(c))
+	for field := range c {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
@@ -0,0 +1,44 @@
+package firestore
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+func TestChanges(t *testing.T) {
+	var e Event
+	e.OldValue.Fields = json.RawMessage(`{"from":{"stringValue":"a"},"amountUnit":{"integerValue":"1"},"confirmedFrom":{"booleanValue":false}}`)
+	e.Value.Fields = json.RawMessage(`{"from":{"stringValue":"a"},"amountUnit":{"integerValue":"2"},"confirmedFrom":{"booleanValue":true}}`)
+
+	var old, cur datastore.MonetaryRequest
+	changes, err := e.Changes(&old, &cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := changes.Fields(); len(f) != 2 || f[0] != "amountUnit" || f[1] != "confirmedFrom" {
+		t.Error(f)
+	}
+	if c := changes["amountUnit"]; c.Old != int64(1) || c.New != int64(2) {
+		t.Error(c)
+	}
+	if !changes.Became("confirmedFrom", true) || changes.Became("amountUnit", int64(1)) ||
+		changes.Changed("from") || changes.Became("confirmedTo", true) {
+		t.Error(changes)
+	}
+	if old.AmountUnit != 1 || cur.AmountUnit != 2 {
+		t.Error(old, cur)
+	}
+
+	// A create has no old value.
+	e.OldValue.Fields = nil
+	changes, err = e.Changes(&datastore.MonetaryRequest{}, &datastore.MonetaryRequest{})
+	if err != nil || !changes.Changed("from") || changes.Changed("confirmedTo") {
+		t.Error(changes, err)
+	}
+
+	if _, err := e.Changes(&datastore.MonetaryRequest{}, &datastore.GroupRequest{}); err == nil {
+		t.Error("compared different types")
+	}
+}
@@ -0,0 +1,379 @@
+package firestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+// value is one typed value of the Firestore REST API,
+// of which exactly one member is set. nullValue is kept raw,
+// as it is sent as a JSON null.
+type value struct {
+	NullValue      json.RawMessage  `json:"nullValue"`
+	BooleanValue   *bool            `json:"booleanValue"`
+	IntegerValue   *json.RawMessage `json:"integerValue"`
+	DoubleValue    *json.RawMessage `json:"doubleValue"`
+	TimestampValue *time.Time       `json:"timestampValue"`
+	StringValue    *string          `json:"stringValue"`
+	BytesValue     *[]byte          `json:"bytesValue"`
+	ReferenceValue *string          `json:"referenceValue"`
+	GeoPointValue  *GeoPoint        `json:"geoPointValue"`
+	ArrayValue     *struct {
+		Values []value `json:"values"`
+	} `json:"arrayValue"`
+	MapValue *struct {
+		Fields map[string]value `json:"fields"`
+	} `json:"mapValue"`
+}
+
+// GeoPoint is what a geoPointValue decodes to into an interface{}.
+// Into a struct, any with float64 Latitude and Longitude will do.
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+// DecodeFields decodes the fields of a Firestore event value into dst,
+// a pointer to a struct, naming struct fields by their firestore tags
+// as the Firestore client does. Fields missing from dst are ignored.
+// Fields that do not fit dst are a datastore.ErrInvalidEvent.
+func DecodeFields(
+	fields json.RawMessage,
+	dst interface{},
+) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("firestore: cannot decode into %T, need a struct pointer", dst)
+	}
+	var m map[string]value
+	if err := json.Unmarshal(fields, &m); err != nil {
+		return datastore.NewError(datastore.ErrInvalidEvent, "firestore: malformed fields: %v", err)
+	}
+	if err := decodeStruct("", m, rv.Elem()); err != nil {
+		return &datastore.Error{Kind: datastore.ErrInvalidEvent, Err: err}
+	}
+	return nil
+}
+
+func decodeStruct(
+	path string,
+	m map[string]value,
+	rv reflect.Value,
+) error {
+	for name, f := range structFields(rv) {
+		v, ok := m[name]
+		if !ok {
+			continue
+		}
+		if err := decodeValue(join(path, name), v, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// structFields maps firestore names to the settable fields of rv,
+// flattening untagged embedded structs like the Firestore client.
+func structFields(rv reflect.Value) map[string]reflect.Value {
+	fields := make(map[string]reflect.Value)
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("firestore")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			for n, f := range structFields(rv.Field(i)) {
+				if _, ok := fields[n]; !ok {
+					fields[n] = f
+				}
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields[name] = rv.Field(i)
+	}
+	return fields
+}
+
+func decodeValue(
+	path string,
+	v value,
+	rv reflect.Value,
+) error {
+	mismatch := func(kind string) error {
+		return fmt.Errorf("firestore: field %v: cannot decode %v into %v", path, kind, rv.Type())
+	}
+
+	if len(v.NullValue) > 0 {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return decodeValue(path, v, rv.Elem())
+	}
+	if rv.Kind() == reflect.Interface && rv.NumMethod() == 0 {
+		i, err := natural(path, v)
+		if err != nil {
+			return err
+		}
+		if i == nil {
+			rv.Set(reflect.Zero(rv.Type()))
+		} else {
+			rv.Set(reflect.ValueOf(i))
+		}
+		return nil
+	}
+
+	switch {
+	case v.BooleanValue != nil:
+		if rv.Kind() != reflect.Bool {
+			return mismatch("booleanValue")
+		}
+		rv.SetBool(*v.BooleanValue)
+
+	case v.IntegerValue != nil:
+		i, err := parseInteger(*v.IntegerValue)
+		if err != nil {
+			return fmt.Errorf("firestore: field %v: malformed integerValue: %v", path, err)
+		}
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if rv.OverflowInt(i) {
+				return fmt.Errorf("firestore: field %v: %v overflows %v", path, i, rv.Type())
+			}
+			rv.SetInt(i)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if i < 0 || rv.OverflowUint(uint64(i)) {
+				return fmt.Errorf("firestore: field %v: %v overflows %v", path, i, rv.Type())
+			}
+			rv.SetUint(uint64(i))
+		case reflect.Float32, reflect.Float64:
+			rv.SetFloat(float64(i))
+		default:
+			return mismatch("integerValue")
+		}
+
+	case v.DoubleValue != nil:
+		f, err := parseDouble(*v.DoubleValue)
+		if err != nil {
+			return fmt.Errorf("firestore: field %v: malformed doubleValue: %v", path, err)
+		}
+		switch rv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			if rv.OverflowFloat(f) {
+				return fmt.Errorf("firestore: field %v: %v overflows %v", path, f, rv.Type())
+			}
+			rv.SetFloat(f)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			// Clients without integers, as in JavaScript, may send whole doubles.
+			if f != math.Trunc(f) || rv.OverflowInt(int64(f)) {
+				return fmt.Errorf("firestore: field %v: %v does not fit %v", path, f, rv.Type())
+			}
+			rv.SetInt(int64(f))
+		default:
+			return mismatch("doubleValue")
+		}
+
+	case v.TimestampValue != nil:
+		if rv.Type() != timeType {
+			return mismatch("timestampValue")
+		}
+		rv.Set(reflect.ValueOf(*v.TimestampValue))
+
+	case v.StringValue != nil:
+		if rv.Kind() != reflect.String {
+			return mismatch("stringValue")
+		}
+		rv.SetString(*v.StringValue)
+
+	case v.BytesValue != nil:
+		if rv.Type() != bytesType {
+			return mismatch("bytesValue")
+		}
+		rv.SetBytes(*v.BytesValue)
+
+	case v.ReferenceValue != nil:
+		if rv.Kind() != reflect.String {
+			return mismatch("referenceValue")
+		}
+		rv.SetString(*v.ReferenceValue)
+
+	case v.GeoPointValue != nil:
+		if rv.Kind() != reflect.Struct {
+			return mismatch("geoPointValue")
+		}
+		lat := rv.FieldByName("Latitude")
+		lng := rv.FieldByName("Longitude")
+		if !lat.IsValid() || !lng.IsValid() ||
+			lat.Kind() != reflect.Float64 || lng.Kind() != reflect.Float64 {
+			return mismatch("geoPointValue")
+		}
+		lat.SetFloat(v.GeoPointValue.Latitude)
+		lng.SetFloat(v.GeoPointValue.Longitude)
+
+	case v.ArrayValue != nil:
+		values := v.ArrayValue.Values
+		switch rv.Kind() {
+		case reflect.Slice:
+			rv.Set(reflect.MakeSlice(rv.Type(), len(values), len(values)))
+		case reflect.Array:
+			if len(values) > rv.Len() {
+				return fmt.Errorf("firestore: field %v: %v values overflow %v", path, len(values), rv.Type())
+			}
+			rv.Set(reflect.Zero(rv.Type()))
+		default:
+			return mismatch("arrayValue")
+		}
+		for i, e := range values {
+			err := decodeValue(fmt.Sprintf("%v[%d]", path, i), e, rv.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+
+	case v.MapValue != nil:
+		fields := v.MapValue.Fields
+		switch {
+		case rv.Kind() == reflect.Struct && rv.Type() != timeType:
+			return decodeStruct(path, fields, rv)
+		case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
+			rv.Set(reflect.MakeMapWithSize(rv.Type(), len(fields)))
+			for k, e := range fields {
+				elem := reflect.New(rv.Type().Elem()).Elem()
+				if err := decodeValue(join(path, k), e, elem); err != nil {
+					return err
+				}
+				rv.SetMapIndex(reflect.ValueOf(k).Convert(rv.Type().Key()), elem)
+			}
+		default:
+			return mismatch("mapValue")
+		}
+
+	default:
+		return fmt.Errorf("firestore: field %v: value has no known type", path)
+	}
+	return nil
+}
+
+// natural is the Go value of v without a destination type,
+// as the Firestore client returns them from DocumentSnapshot.Data.
+func natural(
+	path string,
+	v value,
+) (interface{}, error) {
+	switch {
+	case len(v.NullValue) > 0:
+		return nil, nil
+	case v.BooleanValue != nil:
+		return *v.BooleanValue, nil
+	case v.IntegerValue != nil:
+		i, err := parseInteger(*v.IntegerValue)
+		if err != nil {
+			return nil, fmt.Errorf("firestore: field %v: malformed integerValue: %v", path, err)
+		}
+		return i, nil
+	case v.DoubleValue != nil:
+		f, err := parseDouble(*v.DoubleValue)
+		if err != nil {
+			return nil, fmt.Errorf("firestore: field %v: malformed doubleValue: %v", path, err)
+		}
+		return f, nil
+	case v.TimestampValue != nil:
+		return *v.TimestampValue, nil
+	case v.StringValue != nil:
+		return *v.StringValue, nil
+	case v.BytesValue != nil:
+		return *v.BytesValue, nil
+	case v.ReferenceValue != nil:
+		return *v.ReferenceValue, nil
+	case v.GeoPointValue != nil:
+		return *v.GeoPointValue, nil
+	case v.ArrayValue != nil:
+		a := make([]interface{}, len(v.ArrayValue.Values))
+		for i, e := range v.ArrayValue.Values {
+			n, err := natural(fmt.Sprintf("%v[%d]", path, i), e)
+			if err != nil {
+				return nil, err
+			}
+			a[i] = n
+		}
+		return a, nil
+	case v.MapValue != nil:
+		m := make(map[string]interface{}, len(v.MapValue.Fields))
+		for k, e := range v.MapValue.Fields {
+			n, err := natural(join(path, k), e)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = n
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("firestore: field %v: value has no known type", path)
+}
+
+// parseInteger reads an integerValue, a decimal string
+// as int64 is sent, or a plain JSON number.
+func parseInteger(raw json.RawMessage) (int64, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		var i int64
+		if err := json.Unmarshal(raw, &i); err != nil {
+			return 0, err
+		}
+		return i, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// parseDouble reads a doubleValue, a JSON number
+// or one of the strings "NaN", "Infinity" and "-Infinity".
+func parseDouble(raw json.RawMessage) (float64, error) {
+	var f float64
+	if err := json.Unmarshal(raw, &f); err == nil {
+		return f, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, err
+	}
+	switch s {
+	case "NaN":
+		return math.NaN(), nil
+	case "Infinity":
+		return math.Inf(1), nil
+	case "-Infinity":
+		return math.Inf(-1), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func join(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,130 @@
+package firestore
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type inner struct {
+	Name  string `firestore:"name"`
+	Count int32  `firestore:"count"`
+}
+
+type Embedded struct {
+	Flat string `firestore:"flat"`
+}
+
+type decoded struct {
+	Embedded
+
+	Null      *string                `firestore:"null"`
+	Double    float64                `firestore:"double"`
+	WholeInt  int64                  `firestore:"wholeInt"`
+	NaN       float64                `firestore:"nan"`
+	Bytes     []byte                 `firestore:"bytes"`
+	Ref       string                 `firestore:"ref"`
+	Geo       GeoPoint               `firestore:"geo"`
+	Inner     inner                  `firestore:"inner"`
+	Inners    []*inner               `firestore:"inners"`
+	Counts    map[string]int         `firestore:"counts"`
+	Any       interface{}            `firestore:"any"`
+	Anys      map[string]interface{} `firestore:"anys"`
+	Untagged  string
+	Skipped   string `firestore:"-"`
+	unexposed string
+}
+
+func TestDecodeFields(t *testing.T) {
+	fields := `{
+		"flat": {"stringValue": "f"},
+		"null": {"nullValue": null},
+		"double": {"doubleValue": 1.5},
+		"wholeInt": {"doubleValue": 3},
+		"nan": {"doubleValue": "NaN"},
+		"bytes": {"bytesValue": "aGk="},
+		"ref": {"referenceValue": "projects/p/databases/(default)/documents/Profiles/a"},
+		"geo": {"geoPointValue": {"latitude": 38.7, "longitude": -9.1}},
+		"inner": {"mapValue": {"fields": {"name": {"stringValue": "n"}, "count": {"integerValue": "2"}}}},
+		"inners": {"arrayValue": {"values": [{"mapValue": {"fields": {"name": {"stringValue": "x"}}}}, {"nullValue": null}]}},
+		"counts": {"mapValue": {"fields": {"a": {"integerValue": "1"}}}},
+		"any": {"arrayValue": {"values": [{"integerValue": "1"}, {"timestampValue": "2019-02-13T00:21:13Z"}]}},
+		"anys": {"mapValue": {"fields": {"b": {"booleanValue": true}, "n": {"nullValue": null}}}},
+		"Untagged": {"stringValue": "u"},
+		"Skipped": {"stringValue": "s"},
+		"unknown": {"stringValue": "ignored"}
+	}`
+	d := decoded{Skipped: "kept"}
+	if err := DecodeFields([]byte(fields), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Flat != "f" || d.Null != nil || d.Double != 1.5 || d.WholeInt != 3 || !math.IsNaN(d.NaN) ||
+		string(d.Bytes) != "hi" || !strings.HasSuffix(d.Ref, "/Profiles/a") ||
+		d.Geo != (GeoPoint{38.7, -9.1}) || d.Inner != (inner{"n", 2}) ||
+		d.Untagged != "u" || d.Skipped != "kept" {
+		t.Errorf("%+v", d)
+	}
+	if len(d.Inners) != 2 || d.Inners[0].Name != "x" || d.Inners[1] != nil {
+		t.Errorf("%+v", d.Inners)
+	}
+	if !reflect.DeepEqual(d.Counts, map[string]int{"a": 1}) {
+		t.Error(d.Counts)
+	}
+	date := time.Date(2019, 2, 13, 0, 21, 13, 0, time.UTC)
+	if a, ok := d.Any.([]interface{}); !ok || len(a) != 2 || a[0] != int64(1) || !a[1].(time.Time).Equal(date) {
+		t.Error(d.Any)
+	}
+	if !reflect.DeepEqual(d.Anys, map[string]interface{}{"b": true, "n": nil}) {
+		t.Error(d.Anys)
+	}
+}
+
+func TestDecodeFieldsErrors(t *testing.T) {
+	for fields, field := range map[string]string{
+		`{"inner": {"mapValue": {"fields": {"count": {"stringValue": "2"}}}}}`:               "inner.count",
+		`{"inner": {"mapValue": {"fields": {"count": {"integerValue": "4294967296"}}}}}`:     "inner.count",
+		`{"inners": {"arrayValue": {"values": [{"mapValue": {}}, {"booleanValue": true}]}}}`: "inners[1]",
+		`{"wholeInt": {"doubleValue": 1.5}}`:                                                 "wholeInt",
+		`{"double": {}}`:                                                                     "double",
+	} {
+		var d decoded
+		err := DecodeFields([]byte(fields), &d)
+		if err == nil || !strings.Contains(err.Error(), "field "+field+":") {
+			t.Errorf("%v: %v", fields, err)
+		}
+	}
+	var d decoded
+	if err := DecodeFields([]byte(`{}`), d); err == nil {
+		t.Error("decoded into a struct value")
+	}
+}
+
+func TestEncodeFieldsRoundTrip(t *testing.T) {
+	want := decoded{
+		Embedded: Embedded{Flat: "f"},
+		Double:   math.Inf(-1),
+		WholeInt: -3,
+		Bytes:    []byte("hi"),
+		Geo:      GeoPoint{38.7, -9.1},
+		Inner:    inner{"n", 2},
+		Inners:   []*inner{{Name: "x"}, nil},
+		Counts:   map[string]int{"a": 1},
+		Any:      []interface{}{int64(1), "s"},
+		Untagged: "u",
+		Skipped:  "not encoded",
+	}
+	fields, err := EncodeFields(&want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got decoded
+	if err := DecodeFields(fields, &got); err != nil {
+		t.Fatal(err)
+	}
+	want.Skipped = ""
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%+v\n%+v\n%s", got, want, fields)
+	}
+}
@@ -0,0 +1,162 @@
+package firestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EncodeFields is the inverse of DecodeFields, writing src,
+// a struct or a pointer to one, as the fields of a Firestore event value.
+func EncodeFields(
+	src interface{},
+) (json.RawMessage, error) {
+	rv := reflect.Indirect(reflect.ValueOf(src))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("firestore: cannot encode %T, need a struct", src)
+	}
+	fields, err := encodeStruct("", rv)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+func encodeStruct(
+	path string,
+	rv reflect.Value,
+) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	for name, f := range structFields(rv) {
+		if omitEmpty(rv, name) && isEmpty(f) {
+			continue
+		}
+		v, err := encodeValue(join(path, name), f)
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = v
+	}
+	return fields, nil
+}
+
+func encodeValue(
+	path string,
+	rv reflect.Value,
+) (interface{}, error) {
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return map[string]interface{}{"nullValue": nil}, nil
+		}
+		return encodeValue(path, rv.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"booleanValue": rv.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"integerValue": strconv.FormatInt(rv.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("firestore: field %v: %v overflows int64", path, rv.Uint())
+		}
+		return map[string]interface{}{"integerValue": strconv.FormatUint(rv.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		switch {
+		case math.IsNaN(f):
+			return map[string]interface{}{"doubleValue": "NaN"}, nil
+		case math.IsInf(f, 1):
+			return map[string]interface{}{"doubleValue": "Infinity"}, nil
+		case math.IsInf(f, -1):
+			return map[string]interface{}{"doubleValue": "-Infinity"}, nil
+		}
+		return map[string]interface{}{"doubleValue": f}, nil
+	case reflect.String:
+		return map[string]interface{}{"stringValue": rv.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if rv.Type() == bytesType {
+			return map[string]interface{}{"bytesValue": rv.Bytes()}, nil
+		}
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return map[string]interface{}{"nullValue": nil}, nil
+		}
+		values := make([]interface{}, rv.Len())
+		for i := range values {
+			v, err := encodeValue(fmt.Sprintf("%v[%d]", path, i), rv.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("firestore: field %v: cannot encode %v", path, rv.Type())
+		}
+		if rv.IsNil() {
+			return map[string]interface{}{"nullValue": nil}, nil
+		}
+		fields := make(map[string]interface{}, rv.Len())
+		for _, k := range rv.MapKeys() {
+			v, err := encodeValue(join(path, k.String()), rv.MapIndex(k))
+			if err != nil {
+				return nil, err
+			}
+			fields[k.String()] = v
+		}
+		return map[string]interface{}{"mapValue": map[string]interface{}{"fields": fields}}, nil
+	case reflect.Struct:
+		switch rv.Type() {
+		case timeType:
+			return map[string]interface{}{"timestampValue": rv.Interface()}, nil
+		case reflect.TypeOf(GeoPoint{}):
+			return map[string]interface{}{"geoPointValue": rv.Interface()}, nil
+		}
+		fields, err := encodeStruct(path, rv)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"mapValue": map[string]interface{}{"fields": fields}}, nil
+	}
+	return nil, fmt.Errorf("firestore: field %v: cannot encode %v", path, rv.Type())
+}
+
+// omitEmpty reports whether the field named name in rv
+// is tagged omitempty, looking into embedded structs.
+func omitEmpty(
+	rv reflect.Value,
+	name string,
+) bool {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		opts := strings.Split(sf.Tag.Get("firestore"), ",")
+		if sf.Anonymous && opts[0] == "" && sf.Type.Kind() == reflect.Struct {
+			if omitEmpty(rv.Field(i), name) {
+				return true
+			}
+			continue
+		}
+		if opts[0] == name || (opts[0] == "" && sf.Name == name) {
+			for _, o := range opts[1:] {
+				if o == "omitempty" {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return false
+}
+
+func isEmpty(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return reflect.DeepEqual(rv.Interface(), reflect.Zero(rv.Type()).Interface())
+}
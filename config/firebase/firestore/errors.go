@@ -0,0 +1,35 @@
+package firestore
+
+import (
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+// classify tags err with the kind of failure its gRPC code stands for,
+// leaving errors of other codes as they are.
+// An exhausted query, iterator.Done, found nothing.
+func classify(err error) error {
+	var kind error
+	switch status.Code(err) {
+	case codes.NotFound:
+		kind = datastore.ErrNotFound
+	case codes.AlreadyExists:
+		kind = datastore.ErrAlreadyExists
+	case codes.Aborted:
+		kind = datastore.ErrConflict
+	case codes.InvalidArgument:
+		// Queries and documents are ours, not the event's.
+		kind = datastore.ErrInternal
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal:
+		kind = datastore.ErrUnavailable
+	default:
+		if err != iterator.Done {
+			return err
+		}
+		kind = datastore.ErrNotFound
+	}
+	return &datastore.Error{Kind: kind, Err: err}
+}
@@ -0,0 +1,51 @@
+package firestore
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+func TestClassify(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		kind error
+	}{
+		{status.Error(codes.NotFound, "no document"), datastore.ErrNotFound},
+		{iterator.Done, datastore.ErrNotFound},
+		{status.Error(codes.AlreadyExists, "exists"), datastore.ErrAlreadyExists},
+		{status.Error(codes.Aborted, "contention"), datastore.ErrConflict},
+		{status.Error(codes.Unavailable, "down"), datastore.ErrUnavailable},
+		{status.Error(codes.DeadlineExceeded, "slow"), datastore.ErrUnavailable},
+		{status.Error(codes.InvalidArgument, "bad field"), datastore.ErrInternal},
+	} {
+		err := classify(c.err)
+		if !errors.Is(err, c.kind) || errors.Unwrap(err) != c.err {
+			t.Error(c.err, err)
+		}
+	}
+	err := status.Error(codes.PermissionDenied, "denied")
+	if classify(err) != err {
+		t.Error("classified an unknown failure")
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	var dst struct {
+		Count int `firestore:"count"`
+	}
+	for _, fields := range []string{
+		`not json`,
+		`{"count":{"stringValue":"three"}}`,
+	} {
+		err := DecodeFields([]byte(fields), &dst)
+		if !errors.Is(err, datastore.ErrInvalidEvent) {
+			t.Error(fields, err)
+		}
+	}
+}
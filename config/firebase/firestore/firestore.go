@@ -3,15 +3,19 @@ package firestore
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/schema"
+	"github.com/Seriyin/GiveMeBackend/config/logging"
 )
 
 type firestoreDB struct {
@@ -42,8 +46,8 @@ func NewFirestoreDB(
 	)
 	if err != nil {
 		return nil, fmt.Errorf(
-			"datastoredb: could not connect: %v",
-			err,
+			"datastoredb: could not connect: %w",
+			classify(err),
 		)
 	}
 	return &firestoreDB{
@@ -61,19 +65,19 @@ func (db *firestoreDB) GetProfile(
 	ctx context.Context,
 	userId string,
 ) (*datastore.Profile, error) {
-	doc := db.client.Collection("Profiles").Doc(userId)
+	doc := db.client.Collection(schema.Profiles).Doc(userId)
 	profile := &datastore.Profile{}
 	docSnap, err := doc.Get(ctx)
 	if err != nil {
 		return nil, fmt.Errorf(
-			"datastoredb: could not get Profile: %v",
-			err,
+			"datastoredb: could not get Profile: %w",
+			classify(err),
 		)
 	}
 	if err := docSnap.DataTo(profile); err != nil {
 		return nil, fmt.Errorf(
-			"datastoredb: could not populate Profile: %v",
-			err,
+			"datastoredb: could not populate Profile: %w",
+			classify(err),
 		)
 	}
 	return profile, nil
@@ -84,24 +88,18 @@ func (db *firestoreDB) GetProfileByPhoneNumber(
 	ctx context.Context,
 	phoneNumber string,
 ) (*datastore.Profile, error) {
-	docs := db.client.Collection("Profiles").Where(
-		"phone",
-		"==",
-		phoneNumber,
-	).Documents(ctx)
 	profile := &datastore.Profile{}
-	defer docs.Stop()
-	docSnap, err := docs.Next()
+	docSnap, err := db.findProfileByPhoneNumber(ctx, phoneNumber)
 	if err != nil {
 		return nil, fmt.Errorf(
-			"datastoredb: could not get Profile: %v",
-			err,
+			"datastoredb: could not get Profile: %w",
+			classify(err),
 		)
 	}
 	if err := docSnap.DataTo(profile); err != nil {
 		return nil, fmt.Errorf(
-			"datastoredb: could not populate Profile: %v",
-			err,
+			"datastoredb: could not populate Profile: %w",
+			classify(err),
 		)
 	}
 	return profile, nil
@@ -112,20 +110,88 @@ func (db *firestoreDB) GetProfileIdByPhoneNumber(
 	ctx context.Context,
 	phoneNumber string,
 ) (string, error) {
-	docs := db.client.Collection("Profiles").Where(
+	docSnap, err := db.findProfileByPhoneNumber(ctx, phoneNumber)
+	if err != nil {
+		return "", fmt.Errorf(
+			"datastoredb: could not get Profile: %w",
+			classify(err),
+		)
+	}
+	return docSnap.Ref.ID, nil
+}
+
+// lookupConcurrency bounds the queries GetProfilesByPhoneNumbers
+// runs at once.
+const lookupConcurrency = 10
+
+// GetProfilesByPhoneNumbers retrieves the profiles of many phone numbers
+// at once. The client cannot send `in` filters, so each distinct number
+// is queried as GetProfileByPhoneNumber does, lookupConcurrency at a time.
+func (db *firestoreDB) GetProfilesByPhoneNumbers(
+	ctx context.Context,
+	phoneNumbers []string,
+) (map[string]*datastore.Profile, error) {
+	type lookup struct {
+		phoneNumber string
+		profile     *datastore.Profile
+		err         error
+	}
+	unique := make(map[string]bool, len(phoneNumbers))
+	for _, phoneNumber := range phoneNumbers {
+		unique[phoneNumber] = true
+	}
+	lookups := make(chan lookup, len(unique))
+	slots := make(chan struct{}, lookupConcurrency)
+	for phoneNumber := range unique {
+		go func(phoneNumber string) {
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			profile, err := db.GetProfileByPhoneNumber(ctx, phoneNumber)
+			lookups <- lookup{phoneNumber, profile, err}
+		}(phoneNumber)
+	}
+
+	profiles := make(map[string]*datastore.Profile, len(unique))
+	var failed error
+	for range unique {
+		l := <-lookups
+		switch {
+		case l.err == nil:
+			profiles[l.phoneNumber] = l.profile
+		case !errors.Is(l.err, datastore.ErrNotFound):
+			failed = l.err
+		}
+	}
+	if failed != nil {
+		return nil, failed
+	}
+	return profiles, nil
+}
+
+// findProfileByPhoneNumber matches the current phone number first,
+// then any number the profile has migrated away from.
+func (db *firestoreDB) findProfileByPhoneNumber(
+	ctx context.Context,
+	phoneNumber string,
+) (*firestore.DocumentSnapshot, error) {
+	profiles := db.client.Collection(schema.Profiles)
+	docs := profiles.Where(
 		"phone",
 		"==",
 		phoneNumber,
 	).Documents(ctx)
 	defer docs.Stop()
 	docSnap, err := docs.Next()
-	if err != nil {
-		return "", fmt.Errorf(
-			"datastoredb: could not get Profile: %v",
-			err,
-		)
+	if err != iterator.Done {
+		return docSnap, err
 	}
-	return docSnap.Ref.ID, nil
+	aliases := profiles.Where(
+		"previousPhones",
+		"array-contains",
+		phoneNumber,
+	).Documents(ctx)
+	defer aliases.Stop()
+	return aliases.Next()
 }
 
 // AddProfile saves a given profile, assigning it a new ID.
@@ -134,13 +200,13 @@ func (db *firestoreDB) AddProfile(
 	p *datastore.Profile,
 ) (string, error) {
 	doc := db.client.Collection(
-		"Profiles",
+		schema.Profiles,
 	).Doc(p.Id)
 	_, err := doc.Create(ctx, p)
 	if err != nil {
 		return "", fmt.Errorf(
-			"datastoredb: could not put Profile: %v",
-			err,
+			"datastoredb: could not put Profile: %w",
+			classify(err),
 		)
 	}
 	return p.Id, nil
@@ -152,13 +218,13 @@ func (db *firestoreDB) DeleteProfile(
 	userId string,
 ) error {
 	doc := db.client.Collection(
-		"Profiles",
+		schema.Profiles,
 	).Doc(userId)
 	_, err := doc.Delete(ctx)
 	if err != nil {
 		return fmt.Errorf(
-			"datastoredb: could not delete Profile: %v",
-			err,
+			"datastoredb: could not delete Profile: %w",
+			classify(err),
 		)
 	}
 	return nil
@@ -170,13 +236,87 @@ func (db *firestoreDB) UpdateProfile(
 	p *datastore.Profile,
 ) error {
 	doc := db.client.Collection(
-		"Profiles",
+		schema.Profiles,
 	).Doc(p.Id)
 	_, err := doc.Set(ctx, p, firestore.MergeAll)
 	if err != nil {
 		return fmt.Errorf(
-			"datastoredb: could not update Profile: %v",
-			err,
+			"datastoredb: could not update Profile: %w",
+			classify(err),
+		)
+	}
+	return nil
+}
+
+// RegisterDevice adds a device to a profile, or refreshes
+// the one already registered with the same token.
+func (db *firestoreDB) RegisterDevice(
+	ctx context.Context,
+	userId string,
+	device datastore.Device,
+) error {
+	return db.updateDevices(
+		ctx,
+		userId,
+		func(p *datastore.Profile) []firestore.Update {
+			return []firestore.Update{
+				{Path: "devices", Value: datastore.UpsertDevice(p.Devices, device)},
+			}
+		},
+	)
+}
+
+// RemoveDeviceToken drops an unregistered token from a profile's devices.
+func (db *firestoreDB) RemoveDeviceToken(
+	ctx context.Context,
+	userId string,
+	token string,
+) error {
+	return db.updateDevices(
+		ctx,
+		userId,
+		func(p *datastore.Profile) []firestore.Update {
+			updates := []firestore.Update{
+				{Path: "devices", Value: datastore.RemoveDevice(p.Devices, token)},
+			}
+			if p.Token == token {
+				updates = append(updates, firestore.Update{Path: "token", Value: ""})
+			}
+			return updates
+		},
+	)
+}
+
+// updateDevices reads a profile and applies the updates built from it
+// in one transaction, so concurrent registrations are not lost.
+func (db *firestoreDB) updateDevices(
+	ctx context.Context,
+	userId string,
+	build func(p *datastore.Profile) []firestore.Update,
+) error {
+	doc := db.client.Collection(schema.Profiles).Doc(userId)
+	err := db.client.RunTransaction(
+		ctx,
+		func(
+			ctx context.Context,
+			tx *firestore.Transaction,
+		) error {
+			docSnap, err := tx.Get(doc)
+			if err != nil {
+				return err
+			}
+			profile := &datastore.Profile{}
+			if err := docSnap.DataTo(profile); err != nil {
+				return err
+			}
+			return tx.Update(doc, build(profile))
+		},
+	)
+	if err != nil {
+		return fmt.Errorf(
+			"datastoredb: could not update devices of Profile %v: %w",
+			userId,
+			classify(err),
 		)
 	}
 	return nil
@@ -198,13 +338,13 @@ func (db *firestoreDB) RegenProfile(
 	p *datastore.Profile,
 ) error {
 	doc := db.client.Collection(
-		"Profiles",
+		schema.Profiles,
 	).Doc(p.Id)
 	_, err := doc.Set(ctx, p)
 	if err != nil {
 		return fmt.Errorf(
-			"datastoredb: could not put Profile: %v",
-			err,
+			"datastoredb: could not put Profile: %w",
+			classify(err),
 		)
 	}
 	return nil
@@ -216,21 +356,21 @@ func (db *firestoreDB) IsBlocked(
 	blocked string,
 ) (bool, error) {
 	doc := db.client.Collection(
-		"Blocked",
+		schema.Blocked,
 	).Doc(userId)
 	docSnap, err := doc.Get(ctx)
 	if err != nil {
 		return false, fmt.Errorf(
-			"datastoredb: could not find Blocked: %v",
-			err,
+			"datastoredb: could not find Blocked: %w",
+			classify(err),
 		)
 	}
 	var blockedP []string
 	err = docSnap.DataTo(&blockedP)
 	if err != nil {
 		return false, fmt.Errorf(
-			"datastoredb: could not populate blocked array: %v",
-			err,
+			"datastoredb: could not populate blocked array: %w",
+			classify(err),
 		)
 	}
 	isBlocked := false
@@ -266,10 +406,10 @@ func (db *firestoreDB) AddMonetaryRequestByFullPath(
 	wr, err := doc.Set(ctx, transfer)
 	if err != nil {
 		return "", fmt.Errorf(
-			"datastoredb: failed to add monetary transfer in %v: %v %v",
+			"datastoredb: failed to add monetary transfer in %v: %v %w",
 			fullPath,
 			wr,
-			err,
+			classify(err),
 		)
 	}
 	return doc.ID, err
@@ -288,16 +428,16 @@ func (db *firestoreDB) GetMonetaryRequestWithDate(
 	docSnap, err := doc.Get(ctx)
 	if err != nil {
 		return nil, fmt.Errorf(
-			"datastoredb: could not get monetary_transfer: %v",
-			err,
+			"datastoredb: could not get monetary_transfer: %w",
+			classify(err),
 		)
 	}
 	var mon datastore.MonetaryRequest
 	err = docSnap.DataTo(&mon)
 	if err != nil {
 		return nil, fmt.Errorf(
-			"datastoredb: could not convert to monetary_transfer: %v",
-			err,
+			"datastoredb: could not convert to monetary_transfer: %w",
+			classify(err),
 		)
 	}
 	return &mon, nil
@@ -315,16 +455,16 @@ func (db *firestoreDB) GetMonetaryRequestWithDateString(
 	docSnap, err := doc.Get(ctx)
 	if err != nil {
 		return nil, fmt.Errorf(
-			"datastoredb: could not get monetary_transfer: %v",
-			err,
+			"datastoredb: could not get monetary_transfer: %w",
+			classify(err),
 		)
 	}
 	var mon datastore.MonetaryRequest
 	err = docSnap.DataTo(&mon)
 	if err != nil {
 		return nil, fmt.Errorf(
-			"datastoredb: could not convert to monetary_transfer: %v",
-			err,
+			"datastoredb: could not convert to monetary_transfer: %w",
+			classify(err),
 		)
 	}
 	return &mon, nil
@@ -335,7 +475,7 @@ func (db *firestoreDB) GetMonetaryRequestsDate(
 	userId string,
 	dateBefore time.Time,
 ) ([]*datastore.MonetaryRequest, error) {
-	pathRoot := "MonetaryRequest/" + userId + "/"
+	pathRoot := schema.MonetaryRequests + "/" + userId + "/"
 
 	now := time.Now()
 	dt := time.Date(
@@ -385,11 +525,10 @@ func collectFromDate(
 	for ; err != iterator.Done; doc, err = docIter.Next() {
 		err = doc.DataTo(&mon)
 		if err != nil {
-			log.Print(
-				fmt.Errorf(
-					"datastoredb: could not convert to monetary_transfer: %v",
-					err,
-				),
+			logging.Error(
+				ctx,
+				"datastoredb: could not convert to monetary_transfer",
+				"error", err,
 			)
 		}
 	}
@@ -404,33 +543,44 @@ func (db *firestoreDB) GetMonetaryRequestsInterval(
 	panic("implement me")
 }
 
+// GetMonetaryRequestsFromGroup queries every month of userId,
+// the client has no collection group queries to do it at once.
 func (db *firestoreDB) GetMonetaryRequestsFromGroup(
 	ctx context.Context,
 	userId string,
-	date time.Time,
-	groupId int64,
+	groupId string,
 ) ([]*datastore.MonetaryRequest, error) {
-	dt := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
-	docs, err := db.client.Collection(
-		buildCollectionPathWithDate(userId, dt),
-	).Where("groupId", "==", groupId).Documents(ctx).GetAll()
+	months, err := db.client.Collection(
+		schema.MonetaryRequests,
+	).Doc(userId).Collections(ctx).GetAll()
 	if err != nil {
 		return nil, fmt.Errorf(
-			"datastoredb: could not get MonetaryTransfers: %v",
-			err,
+			"datastoredb: could not list monetary transfer months: %w",
+			classify(err),
 		)
 	}
-	mts := make([]*datastore.MonetaryRequest, len(docs))
-	for _, r := range docs {
-		var mon datastore.MonetaryRequest
-		err = r.DataTo(&mon)
+	var mts []*datastore.MonetaryRequest
+	for _, month := range months {
+		docs, err := month.Where("group", "==", groupId).Documents(ctx).GetAll()
 		if err != nil {
 			return nil, fmt.Errorf(
-				"datastoredb: could not convert to monetary_transfer: %v",
-				err,
+				"datastoredb: could not get MonetaryTransfers in %v: %w",
+				month.Path,
+				classify(err),
 			)
 		}
-		mts = append(mts, &mon)
+		for _, r := range docs {
+			var mon datastore.MonetaryRequest
+			err = r.DataTo(&mon)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"datastoredb: could not convert to monetary_transfer: %w",
+					classify(err),
+				)
+			}
+			mon.Snowflake = r.Ref.ID
+			mts = append(mts, &mon)
+		}
 	}
 	return mts, nil
 }
@@ -468,10 +618,10 @@ func (db *firestoreDB) SetMonetaryRequestByFullPath(
 	wr, err := doc.Set(ctx, transfer)
 	if err != nil {
 		return "", fmt.Errorf(
-			"datastoredb: failed to add monetary transfer in %v: %v %v",
+			"datastoredb: failed to add monetary transfer in %v: %v %w",
 			fullPath,
 			wr,
-			err,
+			classify(err),
 		)
 	}
 	return doc.ID, err
@@ -542,16 +692,713 @@ func (db *firestoreDB) UpdateMonetaryRequestConfirmedByFullPath(
 	})
 	if err != nil {
 		return fmt.Errorf(
-			"datastoredb: failed to update monetary transfer %v in %v: %v %v",
+			"datastoredb: failed to update monetary transfer %v in %v: %v %w",
 			linkedId,
 			fullPath,
 			wr,
-			err,
+			classify(err),
+		)
+	}
+	return nil
+}
+
+func (db *firestoreDB) ReplacePhoneNumberInRequests(
+	ctx context.Context,
+	userId string,
+	oldPhone string,
+	newPhone string,
+) ([]*datastore.MonetaryRequest, error) {
+	months := db.client.Collection(
+		schema.MonetaryRequests,
+	).Doc(userId).Collections(ctx)
+	var involved []*datastore.MonetaryRequest
+	var updated []*firestore.DocumentRef
+	var updates [][]firestore.Update
+	for {
+		month, err := months.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf(
+				"datastoredb: could not list monetary transfer months: %w",
+				classify(err),
+			)
+		}
+		docs, err := month.Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf(
+				"datastoredb: could not get MonetaryTransfers in %v: %w",
+				month.Path,
+				classify(err),
+			)
+		}
+		for _, doc := range docs {
+			var mon datastore.MonetaryRequest
+			err = doc.DataTo(&mon)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"datastoredb: could not convert to monetary_transfer: %v",
+					err,
+				)
+			}
+			var update []firestore.Update
+			if mon.From == oldPhone {
+				mon.From = newPhone
+				update = append(update, firestore.Update{Path: "from", Value: newPhone})
+			}
+			if mon.To == oldPhone {
+				mon.To = newPhone
+				update = append(update, firestore.Update{Path: "to", Value: newPhone})
+			}
+			if len(update) > 0 {
+				updated = append(updated, doc.Ref)
+				updates = append(updates, update)
+			}
+			if mon.From == newPhone || mon.To == newPhone {
+				involved = append(involved, &mon)
+			}
+		}
+	}
+	// Batches are capped at 500 writes.
+	for start := 0; start < len(updated); start += 500 {
+		end := start + 500
+		if end > len(updated) {
+			end = len(updated)
+		}
+		batch := db.client.Batch()
+		for i := start; i < end; i++ {
+			batch.Update(updated[i], updates[i])
+		}
+		_, err := batch.Commit(ctx)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"datastoredb: failed to replace phone number for %v: %w",
+				userId,
+				classify(err),
+			)
+		}
+	}
+	return involved, nil
+}
+
+func (db *firestoreDB) SetMonetaryRequestByFullPathWithOutbox(
+	ctx context.Context,
+	transfer *datastore.MonetaryRequest,
+	fullPath string,
+	outbox []*datastore.Notification,
+) (string, error) {
+	doc := db.client.Collection(
+		fullPath,
+	).Doc(transfer.Snowflake)
+	err := db.client.RunTransaction(
+		ctx,
+		func(
+			ctx context.Context,
+			tx *firestore.Transaction,
+		) error {
+			fresh, err := db.freshNotifications(tx, outbox)
+			if err != nil {
+				return err
+			}
+			if err := tx.Set(doc, transfer); err != nil {
+				return err
+			}
+			return db.enqueue(tx, fresh)
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf(
+			"datastoredb: failed to add monetary transfer in %v: %w",
+			fullPath,
+			classify(err),
+		)
+	}
+	return doc.ID, nil
+}
+
+func (db *firestoreDB) UpdateMonetaryRequestConfirmedByFullPathWithOutbox(
+	ctx context.Context,
+	confirmedFrom bool,
+	confirmedTo bool,
+	fullPath string,
+	linkedId string,
+	outbox []*datastore.Notification,
+) error {
+	doc := db.client.Collection(
+		fullPath,
+	).Doc(linkedId)
+	err := db.client.RunTransaction(
+		ctx,
+		func(
+			ctx context.Context,
+			tx *firestore.Transaction,
+		) error {
+			fresh, err := db.freshNotifications(tx, outbox)
+			if err != nil {
+				return err
+			}
+			err = tx.Update(doc, []firestore.Update{
+				{Path: "confirmedFrom", Value: confirmedFrom},
+				{Path: "confirmedTo", Value: confirmedTo},
+			})
+			if err != nil {
+				return err
+			}
+			return db.enqueue(tx, fresh)
+		},
+	)
+	if err != nil {
+		return fmt.Errorf(
+			"datastoredb: failed to update monetary transfer %v in %v: %w",
+			linkedId,
+			fullPath,
+			classify(err),
+		)
+	}
+	return nil
+}
+
+func (db *firestoreDB) SetMirroredMonetaryRequest(
+	ctx context.Context,
+	transfer *datastore.MonetaryRequest,
+	creditorPath string,
+	debtorPath string,
+	outbox []*datastore.Notification,
+) error {
+	err := db.client.RunTransaction(
+		ctx,
+		func(
+			ctx context.Context,
+			tx *firestore.Transaction,
+		) error {
+			fresh, err := db.freshNotifications(tx, outbox)
+			if err != nil {
+				return err
+			}
+			for _, path := range []string{creditorPath, debtorPath} {
+				doc := db.client.Collection(path).Doc(transfer.Snowflake)
+				if err := tx.Set(doc, transfer); err != nil {
+					return err
+				}
+			}
+			return db.enqueue(tx, fresh)
+		},
+	)
+	if err != nil {
+		return fmt.Errorf(
+			"datastoredb: failed to add mirrored monetary transfer %v in %v and %v: %w",
+			transfer.Snowflake,
+			creditorPath,
+			debtorPath,
+			classify(err),
+		)
+	}
+	return nil
+}
+
+func (db *firestoreDB) ConfirmMirroredMonetaryRequest(
+	ctx context.Context,
+	confirmedFrom bool, //If false ignore
+	confirmedTo bool, //If false ignore
+	creditorPath string,
+	debtorPath string,
+	linkedId string,
+	outbox []*datastore.Notification,
+) error {
+	var updates []firestore.Update
+	if confirmedFrom {
+		updates = append(updates, firestore.Update{Path: "confirmedFrom", Value: true})
+	}
+	if confirmedTo {
+		updates = append(updates, firestore.Update{Path: "confirmedTo", Value: true})
+	}
+	docs := []*firestore.DocumentRef{
+		db.client.Collection(creditorPath).Doc(linkedId),
+		db.client.Collection(debtorPath).Doc(linkedId),
+	}
+	err := db.client.RunTransaction(
+		ctx,
+		func(
+			ctx context.Context,
+			tx *firestore.Transaction,
+		) error {
+			// Reading both copies fails the transaction if either is missing.
+			for _, doc := range docs {
+				if _, err := tx.Get(doc); err != nil {
+					return err
+				}
+			}
+			fresh, err := db.freshNotifications(tx, outbox)
+			if err != nil {
+				return err
+			}
+			if len(updates) > 0 {
+				for _, doc := range docs {
+					if err := tx.Update(doc, updates); err != nil {
+						return err
+					}
+				}
+			}
+			return db.enqueue(tx, fresh)
+		},
+	)
+	if err != nil {
+		return fmt.Errorf(
+			"datastoredb: failed to confirm mirrored monetary transfer %v in %v and %v: %w",
+			linkedId,
+			creditorPath,
+			debtorPath,
+			classify(err),
+		)
+	}
+	return nil
+}
+
+func (db *firestoreDB) ListMonetaryRequestOwners(
+	ctx context.Context,
+	root string,
+) ([]string, error) {
+	// Owners are usually missing documents with only subcollections,
+	// which DocumentRefs still lists.
+	refs, err := db.client.Collection(
+		root,
+	).DocumentRefs(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"datastoredb: could not list monetary transfer owners: %w",
+			classify(err),
+		)
+	}
+	owners := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		owners = append(owners, ref.ID)
+	}
+	return owners, nil
+}
+
+func (db *firestoreDB) ListMonetaryRequests(
+	ctx context.Context,
+	root string,
+	userId string,
+) ([]*datastore.StoredMonetaryRequest, error) {
+	months, err := db.client.Collection(
+		root,
+	).Doc(userId).Collections(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"datastoredb: could not list monetary transfer months: %w",
+			classify(err),
+		)
+	}
+	var stored []*datastore.StoredMonetaryRequest
+	for _, month := range months {
+		docs, err := month.Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf(
+				"datastoredb: could not get MonetaryTransfers in %v: %w",
+				month.Path,
+				classify(err),
+			)
+		}
+		path := root + "/" + userId + "/" + month.ID
+		for _, doc := range docs {
+			var mon datastore.MonetaryRequest
+			if err := doc.DataTo(&mon); err != nil {
+				return nil, fmt.Errorf(
+					"datastoredb: could not convert to monetary_transfer: %v",
+					err,
+				)
+			}
+			// The snowflake field may lag behind the document id.
+			mon.Snowflake = doc.Ref.ID
+			stored = append(stored, &datastore.StoredMonetaryRequest{
+				Path:    path,
+				Updated: doc.UpdateTime,
+				Request: &mon,
+			})
+		}
+	}
+	return stored, nil
+}
+
+func (db *firestoreDB) DeleteMonetaryRequestByFullPath(
+	ctx context.Context,
+	fullPath string,
+	linkedId string,
+) error {
+	_, err := db.client.Collection(
+		fullPath,
+	).Doc(linkedId).Delete(ctx)
+	if err != nil {
+		return fmt.Errorf(
+			"datastoredb: failed to delete monetary transfer %v in %v: %w",
+			linkedId,
+			fullPath,
+			classify(err),
 		)
 	}
 	return nil
 }
 
+func (db *firestoreDB) MoveMonetaryRequest(
+	ctx context.Context,
+	fromPath string,
+	toPath string,
+	linkedId string,
+) (bool, error) {
+	from := db.client.Collection(fromPath).Doc(linkedId)
+	to := db.client.Collection(toPath).Doc(linkedId)
+	var moved bool
+	err := db.client.RunTransaction(
+		ctx,
+		func(ctx context.Context, tx *firestore.Transaction) error {
+			moved = false
+			doc, err := tx.Get(from)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Get(to)
+			if err == nil {
+				return nil
+			} else if status.Code(err) != codes.NotFound {
+				return err
+			}
+			// Copied as raw fields, so none the struct lacks are lost.
+			err = tx.Set(to, doc.Data())
+			if err != nil {
+				return err
+			}
+			moved = true
+			return tx.Delete(from)
+		},
+	)
+	if err != nil {
+		return false, fmt.Errorf(
+			"datastoredb: failed to move monetary transfer %v from %v to %v: %w",
+			linkedId,
+			fromPath,
+			toPath,
+			classify(err),
+		)
+	}
+	return moved, nil
+}
+
+// freshNotifications reads which notifications are not yet in the outbox.
+// Transactions need every read done before the first write.
+func (db *firestoreDB) freshNotifications(
+	tx *firestore.Transaction,
+	outbox []*datastore.Notification,
+) ([]*datastore.Notification, error) {
+	var fresh []*datastore.Notification
+	for _, n := range outbox {
+		_, err := tx.Get(db.client.Collection(schema.Outbox).Doc(n.Key))
+		if status.Code(err) == codes.NotFound {
+			fresh = append(fresh, n)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return fresh, nil
+}
+
+func (db *firestoreDB) enqueue(
+	tx *firestore.Transaction,
+	outbox []*datastore.Notification,
+) error {
+	for _, n := range outbox {
+		err := tx.Create(db.client.Collection(schema.Outbox).Doc(n.Key), n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddNotifications creates every notification not yet in the outbox.
+func (db *firestoreDB) AddNotifications(
+	ctx context.Context,
+	outbox []*datastore.Notification,
+) error {
+	for _, n := range outbox {
+		_, err := db.client.Collection(schema.Outbox).Doc(n.Key).Create(ctx, n)
+		if err != nil && status.Code(err) != codes.AlreadyExists {
+			return fmt.Errorf(
+				"datastoredb: could not enqueue notification %v: %w",
+				n.Key,
+				classify(err),
+			)
+		}
+	}
+	return nil
+}
+
+func (db *firestoreDB) ClaimNotification(
+	ctx context.Context,
+	key string,
+	now time.Time,
+	lease time.Duration,
+) (*datastore.Notification, bool, error) {
+	doc := db.client.Collection(schema.Outbox).Doc(key)
+	var claimed *datastore.Notification
+	err := db.client.RunTransaction(
+		ctx,
+		func(
+			ctx context.Context,
+			tx *firestore.Transaction,
+		) error {
+			claimed = nil
+			docSnap, err := tx.Get(doc)
+			if err != nil {
+				return err
+			}
+			var n datastore.Notification
+			if err := docSnap.DataTo(&n); err != nil {
+				return err
+			}
+			if n.Status != datastore.NotificationPending || n.NextAttempt.After(now) {
+				return nil
+			}
+			n.Attempts++
+			n.NextAttempt = now.Add(lease)
+			claimed = &n
+			return tx.Update(doc, []firestore.Update{
+				{Path: "attempts", Value: n.Attempts},
+				{Path: "nextAttempt", Value: n.NextAttempt},
+			})
+		},
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf(
+			"datastoredb: could not claim Notification %v: %w",
+			key,
+			classify(err),
+		)
+	}
+	return claimed, claimed != nil, nil
+}
+
+func (db *firestoreDB) UpdateNotification(
+	ctx context.Context,
+	n *datastore.Notification,
+) error {
+	_, err := db.client.Collection(schema.Outbox).Doc(n.Key).Set(ctx, n)
+	if err != nil {
+		return fmt.Errorf(
+			"datastoredb: could not update Notification %v: %w",
+			n.Key,
+			classify(err),
+		)
+	}
+	return nil
+}
+
+func (db *firestoreDB) GetDueNotifications(
+	ctx context.Context,
+	now time.Time,
+	limit int,
+) ([]*datastore.Notification, error) {
+	docs, err := db.client.Collection(
+		schema.Outbox,
+	).Where(
+		"status",
+		"==",
+		datastore.NotificationPending,
+	).Where(
+		"nextAttempt",
+		"<=",
+		now,
+	).Limit(limit).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"datastoredb: could not get due Notifications: %w",
+			classify(err),
+		)
+	}
+	due := make([]*datastore.Notification, 0, len(docs))
+	for _, doc := range docs {
+		var n datastore.Notification
+		if err := doc.DataTo(&n); err != nil {
+			return nil, fmt.Errorf(
+				"datastoredb: could not convert to Notification: %w",
+				classify(err),
+			)
+		}
+		due = append(due, &n)
+	}
+	return due, nil
+}
+
+func (db *firestoreDB) IsEventProcessed(
+	ctx context.Context,
+	key string,
+	now time.Time,
+) (bool, error) {
+	docSnap, err := db.client.Collection(
+		schema.ProcessedEvents,
+	).Doc(key).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf(
+			"datastoredb: could not get ProcessedEvent %v: %w",
+			key,
+			classify(err),
+		)
+	}
+	var event datastore.ProcessedEvent
+	if err := docSnap.DataTo(&event); err != nil {
+		return false, fmt.Errorf(
+			"datastoredb: could not convert to ProcessedEvent: %w",
+			classify(err),
+		)
+	}
+	// TTL deletion lags, so expiry is checked here too.
+	return event.Expires.After(now), nil
+}
+
+func (db *firestoreDB) MarkEventProcessed(
+	ctx context.Context,
+	event *datastore.ProcessedEvent,
+) error {
+	_, err := db.client.Collection(
+		schema.ProcessedEvents,
+	).Doc(event.Key).Set(ctx, event)
+	if err != nil {
+		return fmt.Errorf(
+			"datastoredb: could not put ProcessedEvent %v: %w",
+			event.Key,
+			classify(err),
+		)
+	}
+	return nil
+}
+
+func (db *firestoreDB) GetDeadLetter(
+	ctx context.Context,
+	id string,
+) (*datastore.DeadLetter, error) {
+	docSnap, err := db.client.Collection(
+		schema.DeadLetters,
+	).Doc(id).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"datastoredb: could not get DeadLetter %v: %w",
+			id,
+			classify(err),
+		)
+	}
+	var letter datastore.DeadLetter
+	if err := docSnap.DataTo(&letter); err != nil {
+		return nil, fmt.Errorf(
+			"datastoredb: could not convert to DeadLetter: %w",
+			classify(err),
+		)
+	}
+	return &letter, nil
+}
+
+func (db *firestoreDB) SetDeadLetter(
+	ctx context.Context,
+	letter *datastore.DeadLetter,
+) error {
+	_, err := db.client.Collection(
+		schema.DeadLetters,
+	).Doc(letter.Id).Set(ctx, letter)
+	if err != nil {
+		return fmt.Errorf(
+			"datastoredb: could not put DeadLetter %v: %w",
+			letter.Id,
+			classify(err),
+		)
+	}
+	return nil
+}
+
+func (db *firestoreDB) ListDeadLetters(
+	ctx context.Context,
+	status string,
+) ([]*datastore.DeadLetter, error) {
+	query := db.client.Collection(schema.DeadLetters).Query
+	if status != "" {
+		query = query.Where("status", "==", status)
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"datastoredb: could not get DeadLetters: %w",
+			classify(err),
+		)
+	}
+	letters := make([]*datastore.DeadLetter, 0, len(docs))
+	for _, doc := range docs {
+		var letter datastore.DeadLetter
+		if err := doc.DataTo(&letter); err != nil {
+			return nil, fmt.Errorf(
+				"datastoredb: could not convert to DeadLetter: %w",
+				classify(err),
+			)
+		}
+		letters = append(letters, &letter)
+	}
+	// Sorted here, ordering the query needs a composite index.
+	datastore.SortDeadLetters(letters)
+	return letters, nil
+}
+
+func (db *firestoreDB) AddDelivery(
+	ctx context.Context,
+	delivery *datastore.Delivery,
+) error {
+	_, _, err := db.client.Collection(
+		schema.Deliveries,
+	).Add(ctx, delivery)
+	if err != nil {
+		return fmt.Errorf(
+			"datastoredb: could not add Delivery: %w",
+			classify(err),
+		)
+	}
+	return nil
+}
+
+func (db *firestoreDB) GetDeliveriesForRequest(
+	ctx context.Context,
+	snowflake string,
+) ([]*datastore.Delivery, error) {
+	docs, err := db.client.Collection(
+		schema.Deliveries,
+	).Where(
+		"snowflake",
+		"==",
+		snowflake,
+	).OrderBy(
+		"date",
+		firestore.Asc,
+	).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"datastoredb: could not get Deliveries: %w",
+			classify(err),
+		)
+	}
+	history := make([]*datastore.Delivery, 0, len(docs))
+	for _, doc := range docs {
+		var d datastore.Delivery
+		err = doc.DataTo(&d)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"datastoredb: could not convert to Delivery: %w",
+				classify(err),
+			)
+		}
+		history = append(history, &d)
+	}
+	return history, nil
+}
+
 func buildCollectionPathWithDate(
 	userId string,
 	date time.Time,
@@ -566,7 +1413,8 @@ func buildCollectionPath(
 ) string {
 	str := strings.Builder{}
 	str.Grow(len(userId) + 20)
-	str.WriteString("MonetaryRequest/")
+	str.WriteString(schema.MonetaryRequests)
+	str.WriteByte('/')
 	str.WriteString(userId)
 	str.WriteByte('/')
 	str.WriteString(path)
@@ -591,3 +1439,218 @@ type Value struct {
 	Name       string          `json:"name"`
 	UpdateTime time.Time       `json:"updateTime"`
 }
+
+// SetDivisionReport replaces the report field of the group request,
+// which must exist.
+func (db *firestoreDB) SetDivisionReport(
+	ctx context.Context,
+	fullPath string,
+	snowflake string,
+	report *datastore.DivisionReport,
+) error {
+	_, err := db.client.Collection(
+		fullPath,
+	).Doc(snowflake).Update(ctx, []firestore.Update{
+		{Path: "report", Value: report},
+	})
+	if err != nil {
+		return fmt.Errorf(
+			"datastoredb: could not set division report on %v/%v: %w",
+			fullPath,
+			snowflake,
+			classify(err),
+		)
+	}
+	return nil
+}
+
+func (db *firestoreDB) GetDivisionReport(
+	ctx context.Context,
+	fullPath string,
+	snowflake string,
+) (*datastore.DivisionReport, error) {
+	docSnap, err := db.client.Collection(
+		fullPath,
+	).Doc(snowflake).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"datastoredb: could not get group request %v/%v: %w",
+			fullPath,
+			snowflake,
+			classify(err),
+		)
+	}
+	var group struct {
+		Report *datastore.DivisionReport `firestore:"report"`
+	}
+	if err := docSnap.DataTo(&group); err != nil {
+		return nil, fmt.Errorf(
+			"datastoredb: could not convert to DivisionReport: %w",
+			classify(err),
+		)
+	}
+	if group.Report == nil {
+		return nil, datastore.NewError(
+			datastore.ErrNotFound,
+			"datastoredb: no division report for %v/%v",
+			fullPath,
+			snowflake,
+		)
+	}
+	return group.Report, nil
+}
+
+func (db *firestoreDB) AddGroup(
+	ctx context.Context,
+	g *datastore.Group,
+) (string, error) {
+	if err := g.Validate(); err != nil {
+		return "", err
+	}
+	groups := db.client.Collection(schema.Groups)
+	doc := groups.NewDoc()
+	if g.Id != "" {
+		doc = groups.Doc(g.Id)
+	}
+	g.Id = doc.ID
+	g.Created = time.Now()
+	g.Updated = g.Created
+	g.MemberIds = g.ProfileIds()
+	_, err := doc.Create(ctx, g)
+	if err != nil {
+		return "", fmt.Errorf(
+			"datastoredb: could not add Group: %w",
+			classify(err),
+		)
+	}
+	return g.Id, nil
+}
+
+func (db *firestoreDB) GetGroup(
+	ctx context.Context,
+	groupId string,
+) (*datastore.Group, error) {
+	docSnap, err := db.client.Collection(
+		schema.Groups,
+	).Doc(groupId).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"datastoredb: could not get Group %v: %w",
+			groupId,
+			classify(err),
+		)
+	}
+	var g datastore.Group
+	if err := docSnap.DataTo(&g); err != nil {
+		return nil, fmt.Errorf(
+			"datastoredb: could not convert to Group: %w",
+			classify(err),
+		)
+	}
+	g.Id = docSnap.Ref.ID
+	return &g, nil
+}
+
+// UpdateGroup replaces the group, keeping when it was created.
+func (db *firestoreDB) UpdateGroup(
+	ctx context.Context,
+	g *datastore.Group,
+) error {
+	if err := g.Validate(); err != nil {
+		return err
+	}
+	doc := db.client.Collection(schema.Groups).Doc(g.Id)
+	err := db.client.RunTransaction(
+		ctx,
+		func(ctx context.Context, tx *firestore.Transaction) error {
+			docSnap, err := tx.Get(doc)
+			if err != nil {
+				return err
+			}
+			var old datastore.Group
+			if err := docSnap.DataTo(&old); err != nil {
+				return err
+			}
+			g.Created = old.Created
+			g.Updated = time.Now()
+			g.MemberIds = g.ProfileIds()
+			return tx.Set(doc, g)
+		},
+	)
+	if err != nil {
+		return fmt.Errorf(
+			"datastoredb: could not update Group %v: %w",
+			g.Id,
+			classify(err),
+		)
+	}
+	return nil
+}
+
+func (db *firestoreDB) DeleteGroup(
+	ctx context.Context,
+	groupId string,
+) error {
+	_, err := db.client.Collection(
+		schema.Groups,
+	).Doc(groupId).Delete(ctx, firestore.Exists)
+	if err != nil {
+		return fmt.Errorf(
+			"datastoredb: could not delete Group %v: %w",
+			groupId,
+			classify(err),
+		)
+	}
+	return nil
+}
+
+func (db *firestoreDB) ListGroups(
+	ctx context.Context,
+) ([]*datastore.Group, error) {
+	docs, err := db.client.Collection(
+		schema.Groups,
+	).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"datastoredb: could not list Groups: %w",
+			classify(err),
+		)
+	}
+	return groupsOf(docs)
+}
+
+func (db *firestoreDB) ListGroupsByMember(
+	ctx context.Context,
+	profileId string,
+) ([]*datastore.Group, error) {
+	docs, err := db.client.Collection(
+		schema.Groups,
+	).Where(
+		"memberIds",
+		"array-contains",
+		profileId,
+	).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"datastoredb: could not list Groups: %w",
+			classify(err),
+		)
+	}
+	return groupsOf(docs)
+}
+
+func groupsOf(docs []*firestore.DocumentSnapshot) ([]*datastore.Group, error) {
+	groups := make([]*datastore.Group, 0, len(docs))
+	for _, doc := range docs {
+		var g datastore.Group
+		if err := doc.DataTo(&g); err != nil {
+			return nil, fmt.Errorf(
+				"datastoredb: could not convert to Group: %w",
+				classify(err),
+			)
+		}
+		g.Id = doc.Ref.ID
+		groups = append(groups, &g)
+	}
+	return groups, nil
+}
@@ -0,0 +1,22 @@
+package firestore
+
+import (
+	"encoding/json"
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+// UnmarshallAndConvertGroupEntity decodes a Group document,
+// nil for the empty value of a deleted or not yet created one.
+func UnmarshallAndConvertGroupEntity(
+	message json.RawMessage,
+) (*datastore.Group, error) {
+	if len(message) == 0 || string(message) == "null" {
+		return nil, nil
+	}
+	var grp datastore.Group
+	err := DecodeFields(message, &grp)
+	if err != nil {
+		return nil, err
+	}
+	return &grp, nil
+}
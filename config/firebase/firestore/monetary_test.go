@@ -1,41 +1,46 @@
 package firestore
 
 import (
-	"encoding/json"
-	"log"
+	"io/ioutil"
 	"testing"
 	"time"
 )
 
 func TestTimeParsing(t *testing.T) {
-	var date time.Time
-	err := json.Unmarshal([]byte("\"2019-02-12T23:02:20.215Z\""), &date)
-	mon := monetaryRequest{
-		From: StringValue{"a"},
-		To:   StringValue{"b"},
-		Date: TimestampValue{date},
-	}
+	mon, err := UnmarshallAndConvertMonetary([]byte(`{"from":{"stringValue":"a"},"to":{"stringValue":"b"},"date":{"timestampValue":"2019-02-12T23:02:20.215Z"}}`))
 	if err != nil {
-		t.Errorf("err: %v", err)
-	} else {
-		bytes, err := json.Marshal(mon)
-		log.Printf("date: %v", date)
-		log.Printf("mon: %v", string(bytes))
-		log.Printf("err: %v", err)
+		t.Fatalf("err: %v", err)
+	}
+	date := time.Date(2019, 2, 12, 23, 2, 20, 215000000, time.UTC)
+	if mon.From != "a" || mon.To != "b" || !mon.Date.Equal(date) {
+		t.Error(mon)
 	}
-	return
 }
 
 func TestParseFromJSON(t *testing.T) {
-	ex := "{\"amountCents\":{\"integerValue\":\"52\"},\"amountUnit\":{\"integerValue\":\"432\"},\"confirmedFrom\":{\"booleanValue\":false},\"confirmedTo\":{\"booleanValue\":false},\"currency\":{\"stringValue\":\"€\"},\"date\":{\"timestampValue\":\"2019-02-13T00:21:13.036Z\"},\"desc\":{\"stringValue\":\"Woop\"},\"from\":{\"stringValue\":\"+351345345345\"},\"groupId\":{\"integerValue\":\"-1\"},\"recurrentId\":{\"integerValue\":\"-1\"},\"snowflake\":{\"stringValue\":\"3zwUD2mxrrsAs4QsDRP4\"},\"to\":{\"stringValue\":\"+351366366366\"}}"
-	var mon monetaryRequest
-	err := json.Unmarshal([]byte(ex), &mon)
+	ex, err := ioutil.ReadFile("example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mon, err := UnmarshallAndConvertMonetary(ex)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if mon.AmountUnit != 432 || mon.AmountCents != 52 ||
+		mon.Currency != "€" || mon.Desc != "Woop" ||
+		mon.From != "+351345345345" || mon.To != "+351366366366" ||
+		mon.Group != "" || mon.RecurrentId != -1 ||
+		mon.Snowflake != "3zwUD2mxrrsAs4QsDRP4" || mon.ConfirmedFrom || mon.ConfirmedTo {
+		t.Error(mon)
+	}
+}
+
+func TestGroupTos(t *testing.T) {
+	grp, err := UnmarshallAndConvertGroup([]byte(`{"tos":{"arrayValue":{"values":[{"stringValue":"+351111111111"},{"stringValue":"+351222222222"}]}},"included":{"booleanValue":true}}`))
 	if err != nil {
-		t.Errorf("err: %v", err)
-	} else {
-		bytes, err := json.Marshal(mon)
-		log.Printf("mon: %v", string(bytes))
-		log.Printf("err: %v", err)
+		t.Fatal(err)
+	}
+	if len(grp.Tos) != 2 || grp.Tos[0] != "+351111111111" || grp.Tos[1] != "+351222222222" || !grp.Included {
+		t.Error(grp.Tos)
 	}
-	return
 }
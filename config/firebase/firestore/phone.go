@@ -0,0 +1,17 @@
+package firestore
+
+import (
+	"encoding/json"
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+func UnmarshallAndConvertPhoneChange(
+	message json.RawMessage,
+) (*datastore.PhoneChange, error) {
+	var chg datastore.PhoneChange
+	err := DecodeFields(message, &chg)
+	if err != nil {
+		return nil, err
+	}
+	return &chg, nil
+}
@@ -0,0 +1,252 @@
+package firestore
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+// UnmarshalDocumentEventData decodes the protobuf encoding of
+// google.events.cloud.firestore.v1.DocumentEventData, which 2nd gen
+// functions receive, into the Event legacy functions receive.
+// Fields are rewritten in their REST JSON shape, for DecodeFields.
+func UnmarshalDocumentEventData(
+	b []byte,
+) (Event, error) {
+	var e Event
+	err := eachField(b, func(field int, r *protoField) error {
+		var err error
+		switch field {
+		case 1:
+			e.Value, err = unmarshalDocument(r.bytes)
+		case 2:
+			e.OldValue, err = unmarshalDocument(r.bytes)
+		case 3:
+			err = eachField(r.bytes, func(field int, r *protoField) error {
+				if field == 1 {
+					e.UpdateMask.FieldPaths = append(e.UpdateMask.FieldPaths, string(r.bytes))
+				}
+				return nil
+			})
+		}
+		return err
+	})
+	if err != nil {
+		return Event{}, datastore.NewError(datastore.ErrInvalidEvent, "firestore: malformed DocumentEventData: %v", err)
+	}
+	return e, nil
+}
+
+// unmarshalDocument decodes google.events.cloud.firestore.v1.Document.
+func unmarshalDocument(b []byte) (Value, error) {
+	var v Value
+	fields := make(map[string]interface{})
+	err := eachField(b, func(field int, r *protoField) error {
+		var err error
+		switch field {
+		case 1:
+			v.Name = string(r.bytes)
+		case 2:
+			err = unmarshalMapEntry(r.bytes, fields)
+		case 3:
+			v.CreateTime, err = unmarshalTimestamp(r.bytes)
+		case 4:
+			v.UpdateTime, err = unmarshalTimestamp(r.bytes)
+		}
+		return err
+	})
+	if err != nil {
+		return Value{}, err
+	}
+	v.Fields, err = json.Marshal(fields)
+	return v, err
+}
+
+// unmarshalMapEntry decodes one map<string, Value> entry into m.
+func unmarshalMapEntry(
+	b []byte,
+	m map[string]interface{},
+) error {
+	var key string
+	var val map[string]interface{}
+	err := eachField(b, func(field int, r *protoField) error {
+		var err error
+		switch field {
+		case 1:
+			key = string(r.bytes)
+		case 2:
+			val, err = unmarshalValue(r.bytes)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if val == nil {
+		return fmt.Errorf("field %v has no value", key)
+	}
+	m[key] = val
+	return nil
+}
+
+// unmarshalValue decodes google.events.cloud.firestore.v1.Value
+// into its REST JSON shape, as {"stringValue": "..."}.
+func unmarshalValue(b []byte) (map[string]interface{}, error) {
+	v := make(map[string]interface{}, 1)
+	err := eachField(b, func(field int, r *protoField) error {
+		switch field {
+		case 1:
+			v["booleanValue"] = r.varint != 0
+		case 2:
+			v["integerValue"] = strconv.FormatInt(int64(r.varint), 10)
+		case 3:
+			f := math.Float64frombits(r.varint)
+			switch {
+			case math.IsNaN(f):
+				v["doubleValue"] = "NaN"
+			case math.IsInf(f, 1):
+				v["doubleValue"] = "Infinity"
+			case math.IsInf(f, -1):
+				v["doubleValue"] = "-Infinity"
+			default:
+				v["doubleValue"] = f
+			}
+		case 5:
+			v["referenceValue"] = string(r.bytes)
+		case 6:
+			fields := make(map[string]interface{})
+			err := eachField(r.bytes, func(field int, r *protoField) error {
+				if field == 1 {
+					return unmarshalMapEntry(r.bytes, fields)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			v["mapValue"] = map[string]interface{}{"fields": fields}
+		case 8:
+			var lat, lng float64
+			err := eachField(r.bytes, func(field int, r *protoField) error {
+				switch field {
+				case 1:
+					lat = math.Float64frombits(r.varint)
+				case 2:
+					lng = math.Float64frombits(r.varint)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			v["geoPointValue"] = GeoPoint{Latitude: lat, Longitude: lng}
+		case 9:
+			values := []interface{}{}
+			err := eachField(r.bytes, func(field int, r *protoField) error {
+				if field != 1 {
+					return nil
+				}
+				e, err := unmarshalValue(r.bytes)
+				values = append(values, e)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			v["arrayValue"] = map[string]interface{}{"values": values}
+		case 10:
+			t, err := unmarshalTimestamp(r.bytes)
+			if err != nil {
+				return err
+			}
+			v["timestampValue"] = t
+		case 11:
+			v["nullValue"] = nil
+		case 17:
+			v["stringValue"] = string(r.bytes)
+		case 18:
+			v["bytesValue"] = r.bytes
+		}
+		return nil
+	})
+	return v, err
+}
+
+// unmarshalTimestamp decodes google.protobuf.Timestamp.
+func unmarshalTimestamp(b []byte) (time.Time, error) {
+	var seconds, nanos int64
+	err := eachField(b, func(field int, r *protoField) error {
+		switch field {
+		case 1:
+			seconds = int64(r.varint)
+		case 2:
+			nanos = int64(int32(r.varint))
+		}
+		return nil
+	})
+	return time.Unix(seconds, nanos).UTC(), err
+}
+
+// protoField is one field read off the protobuf wire. Varints and
+// fixed width numbers land in varint, length delimited ones in bytes.
+type protoField struct {
+	varint uint64
+	bytes  []byte
+}
+
+var errTruncated = errors.New("truncated message")
+
+// eachField calls fn with every field of the message in b, in order.
+func eachField(
+	b []byte,
+	fn func(field int, r *protoField) error,
+) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+
+		var r protoField
+		switch tag & 7 {
+		case 0:
+			r.varint, n = binary.Uvarint(b)
+			if n <= 0 {
+				return errTruncated
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return errTruncated
+			}
+			r.varint = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errTruncated
+			}
+			r.bytes = b[n : n+int(l)]
+			b = b[n+int(l):]
+		case 5:
+			if len(b) < 4 {
+				return errTruncated
+			}
+			r.varint = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %v", tag&7)
+		}
+		if err := fn(int(tag>>3), &r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package firestore
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+// Minimal protobuf encoding, enough to build DocumentEventData.
+
+func uvarint(v uint64) []byte {
+	b := make([]byte, binary.MaxVarintLen64)
+	return b[:binary.PutUvarint(b, v)]
+}
+
+func pbTag(field int, wire int) []byte {
+	return uvarint(uint64(field<<3 | wire))
+}
+
+func pbVarint(field int, v uint64) []byte {
+	return append(pbTag(field, 0), uvarint(v)...)
+}
+
+func pbDouble(field int, f float64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, math.Float64bits(f))
+	return append(pbTag(field, 1), b...)
+}
+
+func pbBytes(field int, parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return append(append(pbTag(field, 2), uvarint(uint64(len(b)))...), b...)
+}
+
+func pbString(field int, s string) []byte {
+	return pbBytes(field, []byte(s))
+}
+
+func pbEntry(key string, value []byte) []byte {
+	return pbBytes(2, pbString(1, key), pbBytes(2, value))
+}
+
+func TestUnmarshalDocumentEventData(t *testing.T) {
+	name := "projects/p/databases/(default)/documents/MonetaryRequests/a/2019-02/s1"
+	ts := pbBytes(10, pbVarint(1, 1550017273), pbVarint(2, 36000000))
+	value := pbBytes(1,
+		pbString(1, name),
+		pbEntry("from", pbString(17, "+351345345345")),
+		pbEntry("amountUnit", pbVarint(2, 432)),
+		pbEntry("confirmedTo", pbVarint(1, 1)),
+		pbEntry("date", ts),
+		pbEntry("recurrentId", pbVarint(2, math.MaxUint64)), // -1
+		pbEntry("tos", pbBytes(9, pbBytes(1, pbString(17, "x")), pbBytes(1, pbString(17, "y")))),
+		pbEntry("ratio", pbDouble(3, 0.5)),
+		pbEntry("none", pbVarint(11, 0)),
+	)
+	old := pbBytes(2,
+		pbString(1, name),
+		pbEntry("confirmedTo", pbVarint(1, 0)),
+	)
+	mask := pbBytes(3, pbString(1, "confirmedTo"))
+
+	e, err := UnmarshalDocumentEventData(append(append(value, old...), mask...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Value.Name != name || len(e.UpdateMask.FieldPaths) != 1 || e.UpdateMask.FieldPaths[0] != "confirmedTo" {
+		t.Error(e)
+	}
+
+	var prev, cur datastore.MonetaryRequest
+	changes, err := e.Changes(&prev, &cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2019, 2, 13, 0, 21, 13, 36000000, time.UTC)
+	if cur.From != "+351345345345" || cur.AmountUnit != 432 || cur.RecurrentId != -1 ||
+		!cur.ConfirmedTo || !cur.Date.Equal(date) {
+		t.Error(cur)
+	}
+	if !changes.Became("confirmedTo", true) {
+		t.Error(changes)
+	}
+
+	var grp struct {
+		Tos   []string    `firestore:"tos"`
+		Ratio float64     `firestore:"ratio"`
+		None  interface{} `firestore:"none"`
+	}
+	if err := DecodeFields(e.Value.Fields, &grp); err != nil || len(grp.Tos) != 2 || grp.Ratio != 0.5 || grp.None != nil {
+		t.Error(grp, err)
+	}
+
+	if _, err := UnmarshalDocumentEventData(value[:len(value)-1]); err == nil {
+		t.Error("decoded a truncated message")
+	}
+}
@@ -0,0 +1,290 @@
+package messaging
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Message keys in the catalogue.
+const (
+	keyRequest       = "request"
+	keyGroupRequest  = "groupRequest"
+	keyUserJoined    = "userJoined"
+	keyRefusal       = "refusal"
+	keyAcceptance    = "acceptance"
+	keyReminder      = "reminder"
+	keyScheduled     = "scheduled"
+	keyConfirmedFrom = "confirmedFrom"
+	keyConfirmedTo   = "confirmedTo"
+	keyGroupJoined   = "groupJoined"
+	keyGroupLeft     = "groupLeft"
+	keyGroupSummary  = "groupSummary"
+)
+
+// Plural categories, as named by CLDR.
+const (
+	PluralOne   = "one"
+	PluralOther = "other"
+)
+
+// DefaultLanguage ends every fallback chain.
+const DefaultLanguage = "en"
+
+// Template is the title and body of one notification,
+// both parsed with text/template over templateArgs.
+type Template struct {
+	Title string
+	Body  string
+}
+
+// Bundle holds the notification templates and number formatting
+// of a single locale.
+type Bundle struct {
+	Tag string
+	// Decimal separates units from cents.
+	Decimal string
+	// CurrencyAfter places the currency after the amount, "4,32 €".
+	CurrencyAfter bool
+	// Plural picks the CLDR category for a count.
+	Plural func(n int64) string
+
+	sources   map[string]Template
+	templates map[string]*template.Template
+}
+
+type templateArgs struct {
+	Name   string
+	Other  string
+	Amount string
+	Count  int64
+}
+
+var catalogue = map[string]*Bundle{}
+
+func init() {
+	register(
+		&Bundle{
+			Tag:     "en",
+			Decimal: ".",
+			Plural: func(n int64) string {
+				if n == 1 {
+					return PluralOne
+				}
+				return PluralOther
+			},
+		},
+		map[string]Template{
+			keyRequest: {
+				"Debt Notification",
+				"You were tagged to pay {{.Amount}} to {{.Name}}",
+			},
+			keyGroupRequest: {
+				"Debt Notification",
+				"You were tagged to pay {{.Amount}} to {{.Name}}, split between {{.Count}} {{plural .Count \"person\" \"people\"}}",
+			},
+			keyUserJoined: {
+				"User Joined Notification",
+				"{{.Name}}, A user who owes you has joined GiveMe. Remind {{.Other}} of their debt?",
+			},
+			keyRefusal: {
+				"Debtor Refused Debt Payment Request",
+				"{{.Name}} refused the debt of {{.Amount}}",
+			},
+			keyAcceptance: {
+				"Debtor Accepted Debt Payment Request",
+				"{{.Name}} accepted the debt of {{.Amount}}",
+			},
+			keyReminder: {
+				"Debt Payment Reminder",
+				"{{.Name}} wants to remind you to pay {{.Amount}}",
+			},
+			keyScheduled: {
+				"Scheduled Debt Payment",
+				"A debt was scheduled of {{.Amount}}",
+			},
+			keyConfirmedFrom: {
+				"Creditor confirmed payment",
+				"{{.Name}} received your payment of {{.Amount}}",
+			},
+			keyConfirmedTo: {
+				"Creditor confirmed payment",
+				"{{.Name}} paid a debt of {{.Amount}}",
+			},
+			keyGroupJoined: {
+				"Added to a Group",
+				"You were added to the group {{.Name}}",
+			},
+			keyGroupLeft: {
+				"Removed from a Group",
+				"You are no longer in the group {{.Name}}",
+			},
+			keyGroupSummary: {
+				"Group Summary",
+				"{{.Count}} {{plural .Count \"request\" \"requests\"}} of {{.Name}} still to settle",
+			},
+		},
+	)
+	register(
+		&Bundle{
+			Tag:           "pt",
+			Decimal:       ",",
+			CurrencyAfter: true,
+			// European Portuguese only treats exactly one as singular.
+			Plural: func(n int64) string {
+				if n == 1 {
+					return PluralOne
+				}
+				return PluralOther
+			},
+		},
+		map[string]Template{
+			keyRequest: {
+				"Notificação de Dívida",
+				"Foi marcado para pagar {{.Amount}} a {{.Name}}",
+			},
+			keyGroupRequest: {
+				"Notificação de Dívida",
+				"Foi marcado para pagar {{.Amount}} a {{.Name}}, dividido por {{.Count}} {{plural .Count \"pessoa\" \"pessoas\"}}",
+			},
+			keyUserJoined: {
+				"Novo Utilizador",
+				"{{.Name}}, um utilizador que lhe deve aderiu ao GiveMe. Lembrar {{.Other}} da dívida?",
+			},
+			keyRefusal: {
+				"Devedor Recusou o Pedido de Pagamento",
+				"{{.Name}} recusou a dívida de {{.Amount}}",
+			},
+			keyAcceptance: {
+				"Devedor Aceitou o Pedido de Pagamento",
+				"{{.Name}} aceitou a dívida de {{.Amount}}",
+			},
+			keyReminder: {
+				"Lembrete de Pagamento",
+				"{{.Name}} quer lembrá-lo de pagar {{.Amount}}",
+			},
+			keyScheduled: {
+				"Pagamento Agendado",
+				"Foi agendada uma dívida de {{.Amount}}",
+			},
+			keyConfirmedFrom: {
+				"Credor confirmou o pagamento",
+				"{{.Name}} recebeu o seu pagamento de {{.Amount}}",
+			},
+			keyConfirmedTo: {
+				"Credor confirmou o pagamento",
+				"{{.Name}} pagou uma dívida de {{.Amount}}",
+			},
+			keyGroupJoined: {
+				"Adicionado a um Grupo",
+				"Foi adicionado ao grupo {{.Name}}",
+			},
+			keyGroupLeft: {
+				"Removido de um Grupo",
+				"Já não pertence ao grupo {{.Name}}",
+			},
+			keyGroupSummary: {
+				"Resumo do Grupo",
+				"{{.Count}} {{plural .Count \"pedido\" \"pedidos\"}} de {{.Name}} por liquidar",
+			},
+		},
+	)
+	register(
+		&Bundle{
+			Tag:           "pt-BR",
+			Decimal:       ",",
+			CurrencyAfter: false,
+			// Brazilian Portuguese treats zero as singular too.
+			Plural: func(n int64) string {
+				if n == 0 || n == 1 {
+					return PluralOne
+				}
+				return PluralOther
+			},
+		},
+		nil,
+	)
+}
+
+// register parses the templates of a bundle, inheriting any message
+// it leaves out from its parent in the fallback chain.
+func register(b *Bundle, templates map[string]Template) {
+	b.sources = make(map[string]Template)
+	if parent := parentOf(b.Tag); parent != "" {
+		for key, t := range catalogue[parent].sources {
+			b.sources[key] = t
+		}
+	}
+	for key, t := range templates {
+		b.sources[key] = t
+	}
+	// Parsed per bundle so plural resolves with this bundle's rule.
+	b.templates = make(map[string]*template.Template)
+	funcs := template.FuncMap{
+		"plural": func(n int64, one string, other string) string {
+			if b.Plural(n) == PluralOne {
+				return one
+			}
+			return other
+		},
+	}
+	for key, t := range b.sources {
+		b.templates[key] = template.Must(
+			template.New(key).Funcs(funcs).Parse(t.Title + "\x00" + t.Body),
+		)
+	}
+	catalogue[b.Tag] = b
+}
+
+// parentOf returns the next tag in the fallback chain,
+// "pt-BR" to "pt" to DefaultLanguage.
+func parentOf(tag string) string {
+	if i := strings.LastIndex(tag, "-"); i > 0 {
+		return tag[:i]
+	}
+	if tag != DefaultLanguage {
+		return DefaultLanguage
+	}
+	return ""
+}
+
+// Lookup resolves a language tag through its fallback chain,
+// ending at DefaultLanguage for unknown or empty tags.
+func Lookup(language string) *Bundle {
+	for tag := language; tag != ""; tag = parentOf(tag) {
+		if b, ok := catalogue[tag]; ok {
+			return b
+		}
+	}
+	return catalogue[DefaultLanguage]
+}
+
+// FormatAmount renders an amount with the bundle's separator
+// and currency placement.
+func (b *Bundle) FormatAmount(
+	amountUnits int64,
+	amountCents int64,
+	currency string,
+) string {
+	amount := fmt.Sprintf("%d%v%02d", amountUnits, b.Decimal, amountCents)
+	if b.CurrencyAfter {
+		return amount + " " + currency
+	}
+	return currency + amount
+}
+
+// render produces the title and body of the message under key.
+func (b *Bundle) render(
+	key string,
+	args templateArgs,
+) (string, string) {
+	var buf bytes.Buffer
+	err := b.templates[key].Execute(&buf, args)
+	if err != nil {
+		// Templates are fixed at init, so this is a programming error.
+		panic(fmt.Sprintf("messaging: could not render %v in %v: %v", key, b.Tag, err))
+	}
+	parts := strings.SplitN(buf.String(), "\x00", 2)
+	return parts[0], parts[1]
+}
@@ -0,0 +1,68 @@
+package messaging
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestCatalogueGolden(t *testing.T) {
+	for tag, b := range catalogue {
+		var keys []string
+		for key := range b.templates {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var out strings.Builder
+		for _, count := range []int64{0, 1, 3} {
+			for _, key := range keys {
+				title, body := b.render(
+					key,
+					templateArgs{
+						Name:   "+351345345345",
+						Other:  "+351366366366",
+						Amount: b.FormatAmount(432, 5, "€"),
+						Count:  count,
+					},
+				)
+				fmt.Fprintf(&out, "%v[%v]\n%v\n%v\n\n", key, count, title, body)
+			}
+		}
+
+		golden := filepath.Join("testdata", tag+".golden")
+		if *update {
+			if err := ioutil.WriteFile(golden, []byte(out.String()), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != string(want) {
+			t.Errorf("%v does not match %v:\n%v", tag, golden, out.String())
+		}
+	}
+}
+
+func TestLookupFallback(t *testing.T) {
+	for language, tag := range map[string]string{
+		"pt-PT": "pt",
+		"pt-BR": "pt-BR",
+		"pt":    "pt",
+		"en-GB": "en",
+		"fr":    "en",
+		"":      "en",
+	} {
+		if b := Lookup(language); b.Tag != tag {
+			t.Error(language, b.Tag)
+		}
+	}
+}
@@ -1,217 +1,398 @@
 package messaging
 
 import (
-	"fmt"
-
 	"firebase.google.com/go/messaging"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
 )
 
+// Actions carried in the data payload, telling the client
+// which screen a notification deep-links into.
+const (
+	ActionRequest       = "request"
+	ActionUserJoined    = "userJoined"
+	ActionRefusal       = "refusal"
+	ActionAcceptance    = "acceptance"
+	ActionReminder      = "reminder"
+	ActionScheduled     = "scheduled"
+	ActionConfirmedFrom = "confirmedFrom"
+	ActionConfirmedTo   = "confirmedTo"
+	ActionGroupJoined   = "groupJoined"
+	ActionGroupLeft     = "groupLeft"
+	ActionGroupSummary  = "groupSummary"
+)
+
+const (
+	packageName = "com.giveme.pei.givemeapp"
+	color       = "#161119"
+)
+
+// Link locates the request a notification refers to,
+// as seen by the recipient.
+type Link struct {
+	// Path is the recipient's collection path, {Root}/{Uid}/{Date}.
+	Path      string
+	Snowflake string
+}
+
+// buildMessage produces a message addressed to device,
+// using the config its platform understands.
+func buildMessage(
+	device datastore.Device,
+	link Link,
+	action string,
+	title string,
+	body string,
+) *messaging.Message {
+	message := &messaging.Message{
+		Data: map[string]string{
+			"action":    action,
+			"path":      link.Path,
+			"snowflake": link.Snowflake,
+		},
+		Token: device.Token,
+	}
+	switch device.Platform {
+	case datastore.PlatformIOS:
+		message.APNS = &messaging.APNSConfig{
+			Headers: map[string]string{
+				"apns-priority": "5",
+			},
+			Payload: &messaging.APNSPayload{
+				Aps: &messaging.Aps{
+					Alert: &messaging.ApsAlert{
+						Title: title,
+						Body:  body,
+					},
+					Sound: "default",
+				},
+			},
+		}
+	case datastore.PlatformWeb:
+		message.Webpush = &messaging.WebpushConfig{
+			Notification: &messaging.WebpushNotification{
+				Title: title,
+				Body:  body,
+			},
+		}
+	default:
+		message.Android = &messaging.AndroidConfig{
+			Priority: "normal",
+			Notification: &messaging.AndroidNotification{
+				Title: title,
+				Body:  body,
+				Color: color,
+			},
+			RestrictedPackageName: packageName,
+		}
+	}
+	return message
+}
+
 func GenerateRequestNotification(
-	token string,
+	device datastore.Device,
+	link Link,
+	language string,
 	amountUnits int64,
 	amountCents int64,
 	currency string,
 	deliveredFrom string,
 ) *messaging.Message {
-	return &messaging.Message{
-		Android: &messaging.AndroidConfig{
-			Priority: "normal",
-			Notification: &messaging.AndroidNotification{
-				Title: "Debt Notification",
-				Body: fmt.Sprintf(
-					"You were tagged to pay %v.%v %v to %v",
-					amountUnits,
-					amountCents,
-					currency,
-					deliveredFrom,
-				),
-				Color: "#161119",
-			},
-			RestrictedPackageName: "com.giveme.pei.givemeapp",
+	b := Lookup(language)
+	title, body := b.render(
+		keyRequest,
+		templateArgs{
+			Amount: b.FormatAmount(amountUnits, amountCents, currency),
+			Name:   deliveredFrom,
 		},
-		Token: token,
-	}
+	)
+	return buildMessage(
+		device,
+		link,
+		ActionRequest,
+		title,
+		body,
+	)
+}
+
+// GenerateGroupRequestNotification is a request notification
+// that also tells how many members the expense was split between.
+func GenerateGroupRequestNotification(
+	device datastore.Device,
+	link Link,
+	language string,
+	amountUnits int64,
+	amountCents int64,
+	currency string,
+	deliveredFrom string,
+	members int64,
+) *messaging.Message {
+	b := Lookup(language)
+	title, body := b.render(
+		keyGroupRequest,
+		templateArgs{
+			Amount: b.FormatAmount(amountUnits, amountCents, currency),
+			Name:   deliveredFrom,
+			Count:  members,
+		},
+	)
+	return buildMessage(
+		device,
+		link,
+		ActionRequest,
+		title,
+		body,
+	)
 }
 
 func GenerateNewUserRequest(
+	device datastore.Device,
+	link Link,
+	language string,
 	toCheckRemind string,
-	token string,
 	toRemind string,
 ) *messaging.Message {
-	return &messaging.Message{
-		Android: &messaging.AndroidConfig{
-			Priority: "normal",
-			Notification: &messaging.AndroidNotification{
-				Title: "User Joined Notification",
-				Body: fmt.Sprintf(
-					"%v, A user who owes you has joined GiveMe. Remind %v of their debt?",
-					toCheckRemind,
-					toRemind,
-				),
-				Color: "#161119",
-			},
-			RestrictedPackageName: "com.giveme.pei.givemeapp",
+	b := Lookup(language)
+	title, body := b.render(
+		keyUserJoined,
+		templateArgs{
+			Name:  toCheckRemind,
+			Other: toRemind,
 		},
-		Token: token,
-	}
+	)
+	return buildMessage(
+		device,
+		link,
+		ActionUserJoined,
+		title,
+		body,
+	)
 }
 
 func GenerateRequestRefusal(
-	token string,
+	device datastore.Device,
+	link Link,
+	language string,
 	amountUnits int64,
 	amountCents int64,
 	currency string,
 	deliveredFrom string,
 ) *messaging.Message {
-	return &messaging.Message{
-		Android: &messaging.AndroidConfig{
-			Priority: "normal",
-			Notification: &messaging.AndroidNotification{
-				Title: "Debtor Refused Debt Payment Request",
-				Body: fmt.Sprintf(
-					"%v refused the debt of %v.%v %v",
-					deliveredFrom,
-					amountUnits,
-					amountCents,
-					currency,
-				),
-				Color: "#161119",
-			},
-			RestrictedPackageName: "com.giveme.pei.givemeapp",
+	b := Lookup(language)
+	title, body := b.render(
+		keyRefusal,
+		templateArgs{
+			Amount: b.FormatAmount(amountUnits, amountCents, currency),
+			Name:   deliveredFrom,
 		},
-		Token: token,
-	}
+	)
+	return buildMessage(
+		device,
+		link,
+		ActionRefusal,
+		title,
+		body,
+	)
 }
 
 func GenerateRequestAcceptance(
-	token string,
+	device datastore.Device,
+	link Link,
+	language string,
 	amountUnits int64,
 	amountCents int64,
 	currency string,
 	deliveredFrom string,
 ) *messaging.Message {
-	return &messaging.Message{
-		Android: &messaging.AndroidConfig{
-			Priority: "normal",
-			Notification: &messaging.AndroidNotification{
-				Title: "Debtor Accepted Debt Payment Request",
-				Body: fmt.Sprintf(
-					"%v accepted the debt of %v.%v %v",
-					deliveredFrom,
-					amountUnits,
-					amountCents,
-					currency,
-				),
-				Color: "#161119",
-			},
-			RestrictedPackageName: "com.giveme.pei.givemeapp",
+	b := Lookup(language)
+	title, body := b.render(
+		keyAcceptance,
+		templateArgs{
+			Amount: b.FormatAmount(amountUnits, amountCents, currency),
+			Name:   deliveredFrom,
 		},
-		Token: token,
-	}
+	)
+	return buildMessage(
+		device,
+		link,
+		ActionAcceptance,
+		title,
+		body,
+	)
 }
 
 func GenerateReminder(
-	token string,
+	device datastore.Device,
+	link Link,
+	language string,
 	amountUnits int64,
 	amountCents int64,
 	currency string,
 	deliveredFrom string,
 ) *messaging.Message {
-	return &messaging.Message{
-		Android: &messaging.AndroidConfig{
-			Priority: "normal",
-			Notification: &messaging.AndroidNotification{
-				Title: "Debt Payment Reminder",
-				Body: fmt.Sprintf(
-					"%v wants to remind you to pay %v.%v %v",
-					deliveredFrom,
-					amountUnits,
-					amountCents,
-					currency,
-				),
-				Color: "#161119",
-			},
-			RestrictedPackageName: "com.giveme.pei.givemeapp",
+	b := Lookup(language)
+	title, body := b.render(
+		keyReminder,
+		templateArgs{
+			Amount: b.FormatAmount(amountUnits, amountCents, currency),
+			Name:   deliveredFrom,
 		},
-		Token: token,
-	}
+	)
+	return buildMessage(
+		device,
+		link,
+		ActionReminder,
+		title,
+		body,
+	)
 }
 
 func GenerateScheduled(
-	token string,
+	device datastore.Device,
+	link Link,
+	language string,
 	amountUnits int64,
 	amountCents int64,
 	currency string,
 ) *messaging.Message {
-	return &messaging.Message{
-		Android: &messaging.AndroidConfig{
-			Priority: "normal",
-			Notification: &messaging.AndroidNotification{
-				Title: "Scheduled Debt Payment",
-				Body: fmt.Sprintf(
-					"A debt was scheduled of %v.%v%v",
-					amountUnits,
-					amountCents,
-					currency,
-				),
-				Color: "#161119",
-			},
-			RestrictedPackageName: "com.giveme.pei.givemeapp",
+	b := Lookup(language)
+	title, body := b.render(
+		keyScheduled,
+		templateArgs{
+			Amount: b.FormatAmount(amountUnits, amountCents, currency),
 		},
-		Token: token,
-	}
+	)
+	return buildMessage(
+		device,
+		link,
+		ActionScheduled,
+		title,
+		body,
+	)
 }
 
 func GenerateConfirmedFromNotification(
-	token string,
+	device datastore.Device,
+	link Link,
+	language string,
 	amountUnits int64,
 	amountCents int64,
 	currency string,
 	from string,
 ) *messaging.Message {
-	return &messaging.Message{
-		Android: &messaging.AndroidConfig{
-			Priority: "normal",
-			Notification: &messaging.AndroidNotification{
-				Title: "Creditor confirmed payment",
-				Body: fmt.Sprintf(
-					"%v received your payment of %v.%v%v",
-					from,
-					amountUnits,
-					amountCents,
-					currency,
-				),
-				Color: "#161119",
-			},
-			RestrictedPackageName: "com.giveme.pei.givemeapp",
+	b := Lookup(language)
+	title, body := b.render(
+		keyConfirmedFrom,
+		templateArgs{
+			Amount: b.FormatAmount(amountUnits, amountCents, currency),
+			Name:   from,
 		},
-		Token: token,
-	}
+	)
+	return buildMessage(
+		device,
+		link,
+		ActionConfirmedFrom,
+		title,
+		body,
+	)
 }
 
 func GenerateConfirmedToNotification(
-	token string,
+	device datastore.Device,
+	link Link,
+	language string,
 	amountUnits int64,
 	amountCents int64,
 	currency string,
 	to string,
 ) *messaging.Message {
-	return &messaging.Message{
-		Android: &messaging.AndroidConfig{
-			Priority: "normal",
-			Notification: &messaging.AndroidNotification{
-				Title: "Creditor confirmed payment",
-				Body: fmt.Sprintf(
-					"%v payed a debt of %v.%v%v",
-					to,
-					amountUnits,
-					amountCents,
-					currency,
-				),
-				Color: "#161119",
-			},
-			RestrictedPackageName: "com.giveme.pei.givemeapp",
+	b := Lookup(language)
+	title, body := b.render(
+		keyConfirmedTo,
+		templateArgs{
+			Amount: b.FormatAmount(amountUnits, amountCents, currency),
+			Name:   to,
 		},
-		Token: token,
-	}
+	)
+	return buildMessage(
+		device,
+		link,
+		ActionConfirmedTo,
+		title,
+		body,
+	)
+}
+
+// GenerateGroupJoined tells a member they were added to the group
+// named group, linked to by link.
+func GenerateGroupJoined(
+	device datastore.Device,
+	link Link,
+	language string,
+	group string,
+) *messaging.Message {
+	b := Lookup(language)
+	title, body := b.render(
+		keyGroupJoined,
+		templateArgs{
+			Name: group,
+		},
+	)
+	return buildMessage(
+		device,
+		link,
+		ActionGroupJoined,
+		title,
+		body,
+	)
+}
+
+// GenerateGroupLeft tells a member they were removed from the group
+// named group, linked to by link.
+func GenerateGroupLeft(
+	device datastore.Device,
+	link Link,
+	language string,
+	group string,
+) *messaging.Message {
+	b := Lookup(language)
+	title, body := b.render(
+		keyGroupLeft,
+		templateArgs{
+			Name: group,
+		},
+	)
+	return buildMessage(
+		device,
+		link,
+		ActionGroupLeft,
+		title,
+		body,
+	)
+}
+
+// GenerateGroupSummary tells a member how many of their requests
+// in the group named group are still open.
+func GenerateGroupSummary(
+	device datastore.Device,
+	link Link,
+	language string,
+	group string,
+	open int64,
+) *messaging.Message {
+	b := Lookup(language)
+	title, body := b.render(
+		keyGroupSummary,
+		templateArgs{
+			Name:  group,
+			Count: open,
+		},
+	)
+	return buildMessage(
+		device,
+		link,
+		ActionGroupSummary,
+		title,
+		body,
+	)
 }
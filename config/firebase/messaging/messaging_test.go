@@ -0,0 +1,41 @@
+package messaging
+
+import (
+	"testing"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+func TestPlatformConfig(t *testing.T) {
+	link := Link{Path: "MonetaryRequests/a/2019-02", Snowflake: "s1"}
+	for _, platform := range []string{
+		datastore.PlatformAndroid,
+		datastore.PlatformIOS,
+		datastore.PlatformWeb,
+		"",
+	} {
+		m := GenerateReminder(
+			datastore.Device{Token: "t", Platform: platform},
+			link,
+			"pt-PT",
+			1,
+			50,
+			"€",
+			"+351345345345",
+		)
+		android := m.Android != nil
+		ios := m.APNS != nil
+		web := m.Webpush != nil
+		switch {
+		case platform == datastore.PlatformIOS && (!ios || android || web),
+			platform == datastore.PlatformWeb && (!web || android || ios),
+			(platform == "" || platform == datastore.PlatformAndroid) && (!android || ios || web):
+			t.Error(platform, m)
+		}
+		if m.Data["action"] != ActionReminder ||
+			m.Data["path"] != link.Path ||
+			m.Data["snowflake"] != link.Snowflake {
+			t.Error(m.Data)
+		}
+	}
+}
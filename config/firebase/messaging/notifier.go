@@ -0,0 +1,126 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"firebase.google.com/go/messaging"
+)
+
+// Notifier delivers a single push message, returning the provider's message id,
+// or one message to many devices at once.
+type Notifier interface {
+	Send(
+		ctx context.Context,
+		message *messaging.Message,
+	) (string, error)
+	// SendMulticast sends message to each of its Tokens, at most
+	// MaxMulticastTokens, answering for each in order. An error is
+	// returned only when none could be sent.
+	SendMulticast(
+		ctx context.Context,
+		message *messaging.MulticastMessage,
+	) (*messaging.BatchResponse, error)
+}
+
+// MaxMulticastTokens is the most tokens FCM takes in one multicast.
+const MaxMulticastTokens = 500
+
+// Ensure both notifiers conform to the Notifier interface.
+var (
+	_ Notifier = &fcmNotifier{}
+	_ Notifier = &RecordingNotifier{}
+)
+
+// fcmNotifier delivers through Firebase Cloud Messaging.
+type fcmNotifier struct {
+	client *messaging.Client
+}
+
+// NewFCMNotifier creates a Notifier backed by an FCM client.
+func NewFCMNotifier(client *messaging.Client) Notifier {
+	return &fcmNotifier{
+		client: client,
+	}
+}
+
+func (n *fcmNotifier) Send(
+	ctx context.Context,
+	message *messaging.Message,
+) (string, error) {
+	return n.client.Send(ctx, message)
+}
+
+func (n *fcmNotifier) SendMulticast(
+	ctx context.Context,
+	message *messaging.MulticastMessage,
+) (*messaging.BatchResponse, error) {
+	return n.client.SendMulticast(ctx, message)
+}
+
+// RecordingNotifier is an in-memory Notifier for tests,
+// keeping every message it was asked to send.
+type RecordingNotifier struct {
+	mutex sync.Mutex
+	Sent  []*messaging.Message
+	// Fail, when set, decides the error returned for a message.
+	Fail func(message *messaging.Message) error
+}
+
+func (n *RecordingNotifier) Send(
+	ctx context.Context,
+	message *messaging.Message,
+) (string, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.Fail != nil {
+		if err := n.Fail(message); err != nil {
+			return "", err
+		}
+	}
+	n.Sent = append(n.Sent, message)
+	return "fake/" + message.Token, nil
+}
+
+// SendMulticast records one message per token,
+// each failing or not by Fail.
+func (n *RecordingNotifier) SendMulticast(
+	ctx context.Context,
+	message *messaging.MulticastMessage,
+) (*messaging.BatchResponse, error) {
+	if len(message.Tokens) == 0 || len(message.Tokens) > MaxMulticastTokens {
+		return nil, fmt.Errorf("messaging: multicast to %v tokens", len(message.Tokens))
+	}
+	batch := &messaging.BatchResponse{}
+	for _, token := range message.Tokens {
+		id, err := n.Send(ctx, &messaging.Message{
+			Data:         message.Data,
+			Notification: message.Notification,
+			Android:      message.Android,
+			Webpush:      message.Webpush,
+			APNS:         message.APNS,
+			Token:        token,
+		})
+		if err != nil {
+			batch.FailureCount++
+		} else {
+			batch.SuccessCount++
+		}
+		batch.Responses = append(batch.Responses, &messaging.SendResponse{
+			Success:   err == nil,
+			MessageID: id,
+			Error:     err,
+		})
+	}
+	return batch, nil
+}
+
+// Messages returns a snapshot of the messages sent so far.
+func (n *RecordingNotifier) Messages() []*messaging.Message {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return append([]*messaging.Message(nil), n.Sent...)
+}
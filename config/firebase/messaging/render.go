@@ -0,0 +1,69 @@
+package messaging
+
+import (
+	"fmt"
+
+	"firebase.google.com/go/messaging"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+// Render builds the message an outbox notification stands for,
+// addressed to device in the recipient's language.
+func Render(
+	n *datastore.Notification,
+	device datastore.Device,
+	language string,
+) (*messaging.Message, error) {
+	link := Link{Path: n.Path, Snowflake: n.Snowflake}
+	switch n.Action {
+	case ActionRequest:
+		if n.Members > 0 {
+			return GenerateGroupRequestNotification(
+				device, link, language,
+				n.AmountUnit, n.AmountCents, n.Currency, n.Name, n.Members,
+			), nil
+		}
+		return GenerateRequestNotification(
+			device, link, language,
+			n.AmountUnit, n.AmountCents, n.Currency, n.Name,
+		), nil
+	case ActionRefusal:
+		return GenerateRequestRefusal(
+			device, link, language,
+			n.AmountUnit, n.AmountCents, n.Currency, n.Name,
+		), nil
+	case ActionAcceptance:
+		return GenerateRequestAcceptance(
+			device, link, language,
+			n.AmountUnit, n.AmountCents, n.Currency, n.Name,
+		), nil
+	case ActionReminder:
+		return GenerateReminder(
+			device, link, language,
+			n.AmountUnit, n.AmountCents, n.Currency, n.Name,
+		), nil
+	case ActionScheduled:
+		return GenerateScheduled(
+			device, link, language,
+			n.AmountUnit, n.AmountCents, n.Currency,
+		), nil
+	case ActionConfirmedFrom:
+		return GenerateConfirmedFromNotification(
+			device, link, language,
+			n.AmountUnit, n.AmountCents, n.Currency, n.Name,
+		), nil
+	case ActionConfirmedTo:
+		return GenerateConfirmedToNotification(
+			device, link, language,
+			n.AmountUnit, n.AmountCents, n.Currency, n.Name,
+		), nil
+	case ActionGroupJoined:
+		return GenerateGroupJoined(device, link, language, n.Name), nil
+	case ActionGroupLeft:
+		return GenerateGroupLeft(device, link, language, n.Name), nil
+	case ActionGroupSummary:
+		return GenerateGroupSummary(device, link, language, n.Name, n.Members), nil
+	}
+	return nil, fmt.Errorf("messaging: cannot render action %v", n.Action)
+}
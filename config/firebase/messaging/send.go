@@ -0,0 +1,160 @@
+package messaging
+
+import (
+	"context"
+	"time"
+
+	"firebase.google.com/go/messaging"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/logging"
+)
+
+// SendToDevices sends the message built by build to devices of profile,
+// recording each attempt in the delivery log. Messages only differ
+// between devices by token and platform, so devices of a platform
+// share one multicast, of up to MaxMulticastTokens.
+// The tokens done with, reached or pruned, are returned, with the
+// last delivery error once every device was attempted.
+func SendToDevices(
+	ctx context.Context,
+	notifier Notifier,
+	db datastore.GiveMeDatabase,
+	profile *datastore.Profile,
+	devices []datastore.Device,
+	build func(device datastore.Device) (*messaging.Message, error),
+) ([]string, error) {
+	var platforms []string
+	byPlatform := make(map[string][]datastore.Device)
+	for _, device := range devices {
+		if _, ok := byPlatform[device.Platform]; !ok {
+			platforms = append(platforms, device.Platform)
+		}
+		byPlatform[device.Platform] = append(byPlatform[device.Platform], device)
+	}
+
+	var sent []string
+	var lastErr error
+	for _, platform := range platforms {
+		devices := byPlatform[platform]
+		message, err := build(devices[0])
+		if err != nil {
+			return sent, err
+		}
+		for len(devices) > 0 {
+			batch := devices
+			if len(batch) > MaxMulticastTokens {
+				batch = batch[:MaxMulticastTokens]
+			}
+			devices = devices[len(batch):]
+
+			reached, err := sendMulticast(ctx, notifier, db, profile, batch, message)
+			sent = append(sent, reached...)
+			if err != nil {
+				lastErr = err
+			}
+		}
+	}
+	return sent, lastErr
+}
+
+// sendMulticast sends message to the devices of one batch,
+// returning the tokens done with and the last error of the others.
+func sendMulticast(
+	ctx context.Context,
+	notifier Notifier,
+	db datastore.GiveMeDatabase,
+	profile *datastore.Profile,
+	devices []datastore.Device,
+	message *messaging.Message,
+) ([]string, error) {
+	multicast := &messaging.MulticastMessage{
+		Data:         message.Data,
+		Notification: message.Notification,
+		Android:      message.Android,
+		Webpush:      message.Webpush,
+		APNS:         message.APNS,
+	}
+	for _, device := range devices {
+		multicast.Tokens = append(multicast.Tokens, device.Token)
+	}
+	batch, err := notifier.SendMulticast(ctx, multicast)
+
+	var sent []string
+	var lastErr error
+	for i, device := range devices {
+		var id string
+		failure := err
+		if err == nil {
+			id, failure = batch.Responses[i].MessageID, batch.Responses[i].Error
+		}
+		if err := record(ctx, db, profile, device, message, id, failure); err != nil {
+			lastErr = err
+			continue
+		}
+		sent = append(sent, device.Token)
+	}
+	return sent, lastErr
+}
+
+// SendToDevice sends message to one device of profile and records
+// the attempt in the delivery log.
+func SendToDevice(
+	ctx context.Context,
+	notifier Notifier,
+	db datastore.GiveMeDatabase,
+	profile *datastore.Profile,
+	device datastore.Device,
+	message *messaging.Message,
+) error {
+	id, err := notifier.Send(ctx, message)
+	return record(ctx, db, profile, device, message, id, err)
+}
+
+// record logs the attempt of message to device, sent as id unless
+// err. A token FCM reports as unregistered is pruned from the profile
+// and not reported as an error, since retrying it can never succeed.
+func record(
+	ctx context.Context,
+	db datastore.GiveMeDatabase,
+	profile *datastore.Profile,
+	device datastore.Device,
+	message *messaging.Message,
+	id string,
+	err error,
+) error {
+	delivery := &datastore.Delivery{
+		Recipient: profile.Id,
+		Token:     device.Token,
+		Type:      message.Data["action"],
+		Status:    datastore.DeliverySent,
+		MessageId: id,
+		Path:      message.Data["path"],
+		Snowflake: message.Data["snowflake"],
+		Date:      time.Now(),
+		Trace:     logging.TraceId(ctx),
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+		delivery.Status = datastore.DeliveryFailed
+		if messaging.IsRegistrationTokenNotRegistered(err) {
+			delivery.Status = datastore.DeliveryUnregistered
+			if err := db.RemoveDeviceToken(ctx, profile.Id, device.Token); err != nil {
+				logging.Error(ctx, "Could not prune unregistered device", "error", err)
+			}
+			err = nil
+		}
+	}
+	logging.Info(
+		ctx,
+		"Push attempted",
+		"action", delivery.Type,
+		"snowflake", delivery.Snowflake,
+		"status", delivery.Status,
+		"messageId", id,
+	)
+	if err := db.AddDelivery(ctx, delivery); err != nil {
+		logging.Error(ctx, "Could not log delivery", "error", err)
+	}
+	return err
+}
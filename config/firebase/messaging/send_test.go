@@ -0,0 +1,111 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/messaging"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+func TestSendToDevicesLogsDeliveries(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	profile := &datastore.Profile{UID: datastore.UID{Id: "a"}}
+	db.AddProfile(ctx, profile)
+	db.RegisterDevice(ctx, "a", datastore.Device{Token: "phone", LastSeen: time.Now()})
+	db.RegisterDevice(ctx, "a", datastore.Device{Token: "tablet", LastSeen: time.Now()})
+	profile, _ = db.GetProfile(ctx, "a")
+
+	notifier := &RecordingNotifier{
+		Fail: func(message *messaging.Message) error {
+			if message.Token == "tablet" {
+				return errors.New("unavailable")
+			}
+			return nil
+		},
+	}
+	link := Link{Path: "MonetaryRequests/a/2019-02", Snowflake: "s1"}
+	sent, err := SendToDevices(
+		ctx,
+		notifier,
+		db,
+		profile,
+		profile.ActiveDevices(time.Now()),
+		func(device datastore.Device) (*messaging.Message, error) {
+			return GenerateReminder(device, link, "en", 1, 50, "€", "+351345345345"), nil
+		},
+	)
+	if err == nil || len(notifier.Messages()) != 1 || len(sent) != 1 || sent[0] != "phone" {
+		t.Error(err, sent, notifier.Messages())
+	}
+
+	history, err := db.GetDeliveriesForRequest(ctx, "s1")
+	if err != nil || len(history) != 2 {
+		t.Fatal(history, err)
+	}
+	if history[0].Status != datastore.DeliverySent ||
+		history[0].MessageId != "fake/phone" ||
+		history[1].Status != datastore.DeliveryFailed ||
+		history[1].Type != ActionReminder {
+		t.Error(history[0], history[1])
+	}
+}
+
+// multicasts counts the multicasts sent, and their tokens.
+type multicasts struct {
+	RecordingNotifier
+	Tokens [][]string
+}
+
+func (n *multicasts) SendMulticast(
+	ctx context.Context,
+	message *messaging.MulticastMessage,
+) (*messaging.BatchResponse, error) {
+	n.Tokens = append(n.Tokens, message.Tokens)
+	return n.RecordingNotifier.SendMulticast(ctx, message)
+}
+
+func TestSendToDevicesMulticastsByPlatform(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	profile := &datastore.Profile{UID: datastore.UID{Id: "a"}}
+	db.AddProfile(ctx, profile)
+
+	var devices []datastore.Device
+	for i := 0; i < MaxMulticastTokens+1; i++ {
+		devices = append(devices, datastore.Device{Token: fmt.Sprintf("android-%v", i), Platform: datastore.PlatformAndroid})
+	}
+	devices = append(devices, datastore.Device{Token: "iphone", Platform: datastore.PlatformIOS})
+
+	notifier := &multicasts{}
+	link := Link{Path: "MonetaryRequests/a/2019-02", Snowflake: "s1"}
+	sent, err := SendToDevices(
+		ctx,
+		notifier,
+		db,
+		profile,
+		devices,
+		func(device datastore.Device) (*messaging.Message, error) {
+			return GenerateReminder(device, link, "en", 1, 50, "€", "+351345345345"), nil
+		},
+	)
+	if err != nil || len(sent) != len(devices) {
+		t.Fatal(err, len(sent))
+	}
+	if len(notifier.Tokens) != 3 ||
+		len(notifier.Tokens[0]) != MaxMulticastTokens ||
+		len(notifier.Tokens[1]) != 1 ||
+		notifier.Tokens[2][0] != "iphone" {
+		t.Errorf("%v multicasts", len(notifier.Tokens))
+	}
+	for _, m := range notifier.Messages() {
+		if (m.Token == "iphone") != (m.APNS != nil) {
+			t.Errorf("%+v", m)
+		}
+	}
+}
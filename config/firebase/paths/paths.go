@@ -2,88 +2,131 @@ package paths
 
 import (
 	"strings"
-)
-
-func ExtractAndReplaceMethodIdAndDatePath(
-	id string,
-	networkPath string,
-) string {
-
-	// Use the debtor id to split the path
-	// so it gets the path next to the creditor ID
-	// to be replaced by the debtor ID, so it inserts on the correct collection.
-
-	//Split at gcpstuff in [0] and full db path in [1] -> {Root}/{Uid}/{Date}/{Snowflake}.
-	//Extract everything but snowflake.
-	splits := strings.Split(strings.Split(networkPath, "/documents/")[1], "/")[:3]
-	//Split by collection and extract [1] which should be fromId.
-	fromId := splits[1]
 
-	dbPath := strings.Replace(strings.Join(splits, "/"), fromId, id, 1)
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/schema"
+)
 
-	return dbPath
+// RequestPath is a request document, {Root}/{UserId}/{Month}/{Snowflake}.
+// Snowflake is empty when it names the month collection.
+type RequestPath struct {
+	Root      string
+	UserId    string
+	Month     string
+	Snowflake string
 }
 
-func ExtractAndReplaceMethodIdAndDatePathWithSnowflake(
-	id string,
+// Parse reads a request path either as the full resource name
+// carried by events, or as a path relative to the database root.
+// Only the request roots of schema are request paths.
+func Parse(
 	networkPath string,
-) (string, string) {
-
-	// Use the debtor id to split the path
-	// so it gets the path next to the creditor ID
-	// to be replaced by the debtor ID, so it inserts on the correct collection.
-
-	//Split at gcpstuff in [0] and full db path in [1] -> {Root}/{Uid}/{Date}/{Snowflake}.
-	path := strings.Split(networkPath, "/documents/")[1]
-	//Split by collection and extract [1] which should be fromId.
-	pathSplits := strings.Split(path, "/")
-	fromId := pathSplits[1]
-	//Extract [3] which is document unique id.
-	docId := pathSplits[3]
-	//Extract everything but snowflake.
-	dbPath := strings.Replace(strings.Join(pathSplits[:3], "/"), fromId, id, 1)
-
-	return docId, dbPath
+) (RequestPath, error) {
+	splits := strings.Split(relative(networkPath), "/")
+	if len(splits) != 3 && len(splits) != 4 {
+		return RequestPath{}, datastore.NewError(datastore.ErrInvalidEvent, "paths: malformed request path %q", networkPath)
+	}
+	for _, s := range splits {
+		if s == "" {
+			return RequestPath{}, datastore.NewError(datastore.ErrInvalidEvent, "paths: empty segment in request path %q", networkPath)
+		}
+	}
+
+	switch splits[0] {
+	case schema.MonetaryRequests, schema.GroupRequests, schema.LegacyMonetaryRequests:
+	default:
+		return RequestPath{}, datastore.NewError(datastore.ErrInvalidEvent, "paths: %q is not under a request root", networkPath)
+	}
+
+	p := RequestPath{
+		Root:   splits[0],
+		UserId: splits[1],
+		Month:  splits[2],
+	}
+	if len(splits) == 4 {
+		p.Snowflake = splits[3]
+	}
+	return p, nil
 }
 
-func ExtractMethodIdAndDatePath(
-	networkPath string,
-) string {
-
-	// Use the debtor id to split the path
-	// so it gets the path next to the creditor ID
-	// to be replaced by the debtor ID, so it inserts on the correct collection.
+// Collection is the month collection, {Root}/{UserId}/{Month}.
+func (p RequestPath) Collection() string {
+	return p.Root + "/" + p.UserId + "/" + p.Month
+}
 
-	//Split at gcpstuff in [0] and full db path in [1] -> {Root}/{Uid}/{Date}/{Snowflake}.
-	path := strings.Split(networkPath, "/documents/")[1]
-	//Split by collection and extract [1] which should be fromId.
-	splits := strings.Split(path, "/")[:3]
+// String is the document path, or the collection path
+// when there is no snowflake.
+func (p RequestPath) String() string {
+	if p.Snowflake == "" {
+		return p.Collection()
+	}
+	return p.Collection() + "/" + p.Snowflake
+}
 
-	//Extract everything but snowflake.
-	dbPath := strings.Join(splits, "/")
+// WithOwner is the same request under another user,
+// as the debtor's copy of a creditor's request.
+func (p RequestPath) WithOwner(
+	userId string,
+) RequestPath {
+	p.UserId = userId
+	return p
+}
 
-	return dbPath
+// WithSnowflake is another document in the same collection.
+func (p RequestPath) WithSnowflake(
+	snowflake string,
+) RequestPath {
+	p.Snowflake = snowflake
+	return p
 }
 
-func ExtractMethodIdAndDatePathWithSnowflake(
-	networkPath string,
-) (string, string) {
+// AsMonetary moves a group request over to the monetary root,
+// where its members' requests are written.
+func (p RequestPath) AsMonetary() (RequestPath, error) {
+	if p.Root != schema.GroupRequests {
+		return RequestPath{}, datastore.NewError(datastore.ErrInvalidEvent, "paths: %v is not a group request", p)
+	}
+	p.Root = schema.MonetaryRequests
+	return p, nil
+}
 
-	// Use the debtor id to split the path
-	// so it gets the path next to the creditor ID
-	// to be replaced by the debtor ID, so it inserts on the correct collection.
+// DevicePath is a device document, Devices/{UserId}/Tokens/{Token}.
+type DevicePath struct {
+	UserId string
+	Token  string
+}
 
-	//Split at gcpstuff in [0] and full db path in [1] -> {Root}/{Uid}/{Date}/{Snowflake}.
-	path := strings.Split(networkPath, "/documents/")[1]
-	splits := strings.Split(path, "/")
+// ParseDevice reads a device path as Parse reads request paths.
+func ParseDevice(
+	networkPath string,
+) (DevicePath, error) {
+	splits := strings.Split(relative(networkPath), "/")
+	if len(splits) != 4 || splits[0] != schema.Devices || splits[2] != schema.DeviceTokens ||
+		splits[1] == "" || splits[3] == "" {
+		return DevicePath{}, datastore.NewError(datastore.ErrInvalidEvent, "paths: malformed device path %q", networkPath)
+	}
+	return DevicePath{UserId: splits[1], Token: splits[3]}, nil
+}
 
-	dbPath := strings.Join(splits[:3], "/")
+// String is the document path.
+func (p DevicePath) String() string {
+	return schema.Devices + "/" + p.UserId + "/" + schema.DeviceTokens + "/" + p.Token
+}
 
-	return splits[3], dbPath
+// relative is networkPath relative to the database root.
+func relative(
+	networkPath string,
+) string {
+	//Split at gcpstuff before /documents/ and full db path after.
+	if i := strings.Index(networkPath, "/documents/"); i >= 0 {
+		return networkPath[i+len("/documents/"):]
+	}
+	return networkPath
 }
 
-func TransformGroupIntoMonetary(
-	groupPath string,
+func ExtractDocumentId(
+	networkPath string,
 ) string {
-	return strings.Replace(groupPath, "GroupRequests", "MonetaryRequests", 1)
+	//Document id is the last segment -> {Root}/.../{DocId}.
+	return networkPath[strings.LastIndex(networkPath, "/")+1:]
 }
@@ -1,59 +1,128 @@
 package paths
 
 import (
+	"strings"
 	"testing"
 )
 
 func TestPathConstruction(t *testing.T) {
-	ex := "/documents/MonetaryRequests/XUtvJm2jMae6CVwa33MVbYN2iZH2/2019-02/g3aRogfhNIKwcwTxkGwF"
-	ex2 := "/documents/GroupRequests/XUtvJm2jMae6CVwa33MVbYN2iZH2/2019-02/g3aRogfhNIKwcwTxkGwF"
+	ex := "projects/giveme/databases/(default)/documents/MonetaryRequests/XUtvJm2jMae6CVwa33MVbYN2iZH2/2019-02/g3aRogfhNIKwcwTxkGwF"
+	ex2 := "projects/giveme/databases/(default)/documents/GroupRequests/XUtvJm2jMae6CVwa33MVbYN2iZH2/2019-02/g3aRogfhNIKwcwTxkGwF"
 	id := "AGd1wTq8VTRdxUlokeVcwOjx7Ce2"
 
-	str := ExtractAndReplaceMethodIdAndDatePath(
-		id,
-		ex,
-	)
+	p, err := Parse(ex)
 
-	if str != "MonetaryRequests/AGd1wTq8VTRdxUlokeVcwOjx7Ce2/2019-02" {
+	if err != nil || p.Snowflake != "g3aRogfhNIKwcwTxkGwF" {
+		t.Fatal(p, err)
+	}
+
+	if str := p.Collection(); str != "MonetaryRequests/XUtvJm2jMae6CVwa33MVbYN2iZH2/2019-02" {
 		t.Error(str)
 	}
 
-	str = ExtractMethodIdAndDatePath(ex)
+	if str := p.WithOwner(id).Collection(); str != "MonetaryRequests/AGd1wTq8VTRdxUlokeVcwOjx7Ce2/2019-02" {
+		t.Error(str)
+	}
 
-	if str != "MonetaryRequests/XUtvJm2jMae6CVwa33MVbYN2iZH2/2019-02" {
+	if str := p.WithOwner(id).String(); str != "MonetaryRequests/AGd1wTq8VTRdxUlokeVcwOjx7Ce2/2019-02/g3aRogfhNIKwcwTxkGwF" {
 		t.Error(str)
 	}
 
-	snf, str := ExtractAndReplaceMethodIdAndDatePathWithSnowflake(
-		id,
-		ex,
-	)
+	if _, err := p.AsMonetary(); err == nil {
+		t.Error("monetary request moved to monetary root")
+	}
 
-	if str != "MonetaryRequests/AGd1wTq8VTRdxUlokeVcwOjx7Ce2/2019-02" || snf != "g3aRogfhNIKwcwTxkGwF" {
-		t.Error(str, snf)
+	g, err := Parse(ex2)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	snf, str = ExtractMethodIdAndDatePathWithSnowflake(ex)
+	m, err := g.AsMonetary()
 
-	if str != "MonetaryRequests/XUtvJm2jMae6CVwa33MVbYN2iZH2/2019-02" || snf != "g3aRogfhNIKwcwTxkGwF" {
-		t.Error(str)
+	if err != nil || "projects/giveme/databases/(default)/documents/"+m.String() != ex {
+		t.Error(m, err)
 	}
 
-	str = TransformGroupIntoMonetary(ex2)
-
-	if str != ex {
+	if str := g.WithOwner(id).Collection(); str != "GroupRequests/AGd1wTq8VTRdxUlokeVcwOjx7Ce2/2019-02" {
 		t.Error(str)
 	}
 
-	str = ExtractAndReplaceMethodIdAndDatePath(id, ex2)
+	if str := ExtractDocumentId(ex); str != "g3aRogfhNIKwcwTxkGwF" {
+		t.Error(str)
+	}
+}
 
-	if str != "GroupRequests/AGd1wTq8VTRdxUlokeVcwOjx7Ce2/2019-02" {
+func TestWithOwnerMatchingSegment(t *testing.T) {
+	// The uid also appears as the month, it must not be replaced there.
+	p, err := Parse("MonetaryRequests/2019-02/2019-02/s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str := p.WithOwner("b").String(); str != "MonetaryRequests/b/2019-02/s" {
 		t.Error(str)
 	}
+}
 
-	str = TransformGroupIntoMonetary(str)
+func TestParseMalformed(t *testing.T) {
+	for _, path := range []string{
+		"",
+		"/documents/",
+		"projects/giveme/databases/(default)/documents/Profiles/a",
+		"MonetaryRequests/a",
+		"MonetaryRequests//2019-02/s",
+		"MonetaryRequests/a/2019-02/s/extra",
+		"Groups/trip/2019-02/s",
+		"projects/giveme/databases/(default)/documents/Devices/a/Tokens/t",
+	} {
+		if p, err := Parse(path); err == nil {
+			t.Error(path, p)
+		}
+	}
+}
 
-	if str != "MonetaryRequests/AGd1wTq8VTRdxUlokeVcwOjx7Ce2/2019-02" {
+func TestParseDevice(t *testing.T) {
+	p, err := ParseDevice("projects/giveme/databases/(default)/documents/Devices/a/Tokens/t")
+	if err != nil || p != (DevicePath{UserId: "a", Token: "t"}) {
+		t.Fatal(p, err)
+	}
+	if str := p.String(); str != "Devices/a/Tokens/t" {
 		t.Error(str)
 	}
+
+	for _, path := range []string{
+		"",
+		"Devices/a",
+		"Devices//Tokens/t",
+		"Devices/a/Tokens/",
+		"Devices/a/Others/t",
+		"Devices/a/Tokens/t/extra",
+		"MonetaryRequests/a/2019-02/s",
+	} {
+		if p, err := ParseDevice(path); err == nil {
+			t.Error(path, p)
+		}
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add("projects/giveme/databases/(default)/documents/MonetaryRequests/a/2019-02/s")
+	f.Add("GroupRequests/a/2019-02")
+	f.Add("/documents//a//")
+	f.Fuzz(func(t *testing.T, path string) {
+		p, err := Parse(path)
+		if err != nil {
+			return
+		}
+		if !strings.HasSuffix(path, p.String()) {
+			t.Errorf("%q parsed as %q", path, p.String())
+		}
+		q, err := Parse(p.String())
+		if err != nil || q != p {
+			t.Errorf("%q did not round trip: %v, %v", p.String(), q, err)
+		}
+		w := p.WithOwner("uid")
+		if w.Root != p.Root || w.Month != p.Month || w.Snowflake != p.Snowflake {
+			t.Errorf("WithOwner changed more than the owner: %v", w)
+		}
+	})
 }
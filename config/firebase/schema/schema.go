@@ -0,0 +1,26 @@
+// Package schema names the collections of the database, so trigger
+// paths and datastore writes cannot disagree on them.
+package schema
+
+const (
+	Profiles        = "Profiles"
+	Blocked         = "Blocked"
+	Outbox          = "Outbox"
+	ProcessedEvents = "ProcessedEvents"
+	Deliveries      = "Deliveries"
+	DeadLetters     = "DeadLetters"
+	Groups          = "Groups"
+
+	// Devices are laid out as Devices/{uid}/Tokens/{token},
+	// written by clients as they register for pushes.
+	Devices      = "Devices"
+	DeviceTokens = "Tokens"
+
+	// Request collections are laid out as {Root}/{uid}/{YYYY-MM}/{snowflake}.
+	MonetaryRequests = "MonetaryRequests"
+	GroupRequests    = "GroupRequests"
+
+	// LegacyMonetaryRequests is where debtor copies used to be written,
+	// apart from the creditor copies the clients write.
+	LegacyMonetaryRequests = "MonetaryRequest"
+)
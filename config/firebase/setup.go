@@ -2,44 +2,53 @@ package firebase
 
 import (
 	"context"
+	"fmt"
+
 	"firebase.google.com/go"
-	"firebase.google.com/go/messaging"
+	"firebase.google.com/go/auth"
 	"github.com/Seriyin/GiveMeBackend/config/datastore"
 	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
-	"log"
-)
-
-var (
-	app *firebase.App
+	gmessaging "github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
 )
 
-func init() {
-	var err error
-	app, err = firebase.NewApp(
-		context.Background(),
-		nil,
-	)
+// NewApp connects to Firebase with the credentials of the environment.
+func NewApp(ctx context.Context) (*firebase.App, error) {
+	app, err := firebase.NewApp(ctx, nil)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("firebase: could not create app: %v", err)
 	}
+	return app, nil
 }
 
-func GetDB() datastore.GiveMeDatabase {
-	db, err := app.Firestore(context.Background())
+func NewDB(
+	ctx context.Context,
+	app *firebase.App,
+) (datastore.GiveMeDatabase, error) {
+	db, err := app.Firestore(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("firebase: could not create firestore client: %v", err)
 	}
-	fdb, err := firestore.NewFirestoreDB(db)
+	return firestore.NewFirestoreDB(db)
+}
+
+func NewNotifier(
+	ctx context.Context,
+	app *firebase.App,
+) (gmessaging.Notifier, error) {
+	mes, err := app.Messaging(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("firebase: could not create messaging client: %v", err)
 	}
-	return fdb
+	return gmessaging.NewFCMNotifier(mes), nil
 }
 
-func GetMessaging() *messaging.Client {
-	mes, err := app.Messaging(context.Background())
+func NewAuth(
+	ctx context.Context,
+	app *firebase.App,
+) (*auth.Client, error) {
+	cl, err := app.Auth(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("firebase: could not create auth client: %v", err)
 	}
-	return mes
+	return cl, nil
 }
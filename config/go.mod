@@ -2,10 +2,10 @@ module github.com/Seriyin/GiveMeBackend/config
 
 require (
 	cloud.google.com/go v0.36.0
-	firebase.google.com/go v3.6.0+incompatible
+	firebase.google.com/go v3.13.0+incompatible
 	github.com/gorilla/sessions v1.1.3
 	go.opencensus.io v0.19.0 // indirect
 	golang.org/x/net v0.0.0-20181220203305-927f97764cc3 // indirect
 	google.golang.org/api v0.1.0
-	google.golang.org/grpc v1.18.0 // indirect
+	google.golang.org/grpc v1.18.0
 )
@@ -0,0 +1,59 @@
+// Package idempotency skips trigger events a handler already applied.
+// Cloud Functions deliver events at least once, so retries would
+// otherwise re-apply writes.
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/logging"
+)
+
+// DefaultTTL outlasts the retry window of background functions.
+const DefaultTTL = 7 * 24 * time.Hour
+
+// Once runs fn unless the event in ctx was already processed by handler,
+// marking it processed when fn succeeds. Failed runs stay unmarked,
+// so the platform's retry applies them again.
+// Without event metadata, as in local runs, fn always runs.
+func Once(
+	ctx context.Context,
+	db datastore.GiveMeDatabase,
+	handler string,
+	ttl time.Duration,
+	fn func(ctx context.Context) error,
+) error {
+	meta, err := metadata.FromContext(ctx)
+	if err != nil || meta.EventID == "" {
+		logging.Debug(ctx, "No event id, running unguarded")
+		return fn(ctx)
+	}
+
+	key := handler + ":" + meta.EventID
+	now := time.Now()
+	done, err := db.IsEventProcessed(ctx, key, now)
+	if err != nil {
+		return err
+	}
+	if done {
+		logging.Info(ctx, "Skipping duplicate event", "key", key)
+		return nil
+	}
+
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	return db.MarkEventProcessed(
+		ctx,
+		&datastore.ProcessedEvent{
+			Key:     key,
+			Handler: handler,
+			Date:    now,
+			Expires: now.Add(ttl),
+		},
+	)
+}
@@ -0,0 +1,52 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/functions/metadata"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+func TestOnceSkipsDuplicates(t *testing.T) {
+	db := datastore.NewMemoryDB()
+	ctx := metadata.NewContext(
+		context.Background(),
+		&metadata.Metadata{EventID: "70172329041928"},
+	)
+	runs := 0
+	fail := true
+	fn := func(ctx context.Context) error {
+		runs++
+		if fail {
+			return errors.New("unavailable")
+		}
+		return nil
+	}
+
+	// Failed runs are retried.
+	if err := Once(ctx, db, "request", DefaultTTL, fn); err == nil {
+		t.Error("expected failure")
+	}
+	fail = false
+	Once(ctx, db, "request", DefaultTTL, fn)
+	Once(ctx, db, "request", DefaultTTL, fn)
+	if runs != 2 {
+		t.Error(runs)
+	}
+
+	// Another handler of the same event is tracked apart.
+	Once(ctx, db, "confirm", DefaultTTL, fn)
+	if runs != 3 {
+		t.Error(runs)
+	}
+
+	// An expired marker no longer protects.
+	Once(ctx, db, "division", -1, fn)
+	Once(ctx, db, "division", -1, fn)
+	if runs != 5 {
+		t.Error(runs)
+	}
+}
@@ -0,0 +1,229 @@
+// Package ledger sums up the requests divided among a group: what was
+// spent, what each member paid for others and was charged, and what
+// is still to settle.
+//
+// Requests name their parties by phone number, members are matched to
+// them by the phone numbers of their profiles, past ones included.
+// Amounts are kept in cents per currency, a group may spend in several.
+package ledger
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+// Settlement statuses of a request.
+const (
+	// StatusOpen is a request the debtor has not paid.
+	StatusOpen = "open"
+	// StatusPaid is a request the debtor paid and the creditor
+	// has yet to confirm.
+	StatusPaid = "paid"
+	// StatusSettled is a request the creditor confirmed paid.
+	StatusSettled = "settled"
+)
+
+// Amounts are cents by currency.
+type Amounts map[string]int64
+
+func (a Amounts) add(mon *datastore.MonetaryRequest) {
+	a[mon.Currency] += mon.AmountUnit*100 + mon.AmountCents
+}
+
+// Balance is where one member of the group stands.
+type Balance struct {
+	// Member is the profile id of the member, their phone number
+	// if they have no profile.
+	Member string `json:"member"`
+	// Former members still party to requests of the group.
+	Former bool `json:"former,omitempty"`
+	// Paid is what others were charged for what the member paid.
+	Paid Amounts `json:"paid"`
+	// Owed is what the member was charged.
+	Owed Amounts `json:"owed"`
+	// Receivable is the part of Paid not yet settled.
+	Receivable Amounts `json:"receivable"`
+	// Payable is the part of Owed not yet settled.
+	Payable Amounts `json:"payable"`
+	// Open counts the requests of the member not yet settled,
+	// either way.
+	Open int64 `json:"open"`
+}
+
+// Entry is one request of the group and how far it is settled.
+type Entry struct {
+	Snowflake   string    `json:"snowflake"`
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	Desc        string    `json:"desc"`
+	Date        time.Time `json:"date"`
+	AmountUnit  int64     `json:"amountUnit"`
+	AmountCents int64     `json:"amountCents"`
+	Currency    string    `json:"currency"`
+	Status      string    `json:"status"`
+}
+
+// Ledger is the statement of a group.
+type Ledger struct {
+	Group string `json:"group"`
+	Name  string `json:"name"`
+	// Spent is what members were charged, the shares creditors
+	// kept for themselves aside.
+	Spent Amounts `json:"spent"`
+	// Members are the balances of current members in the order
+	// of the group, then of former ones.
+	Members []*Balance `json:"members"`
+	// Outstanding are the requests not yet settled, oldest first.
+	Outstanding []*Entry `json:"outstanding"`
+	Requests    int      `json:"requests"`
+	// Settled is whether every request of the group is.
+	Settled bool      `json:"settled"`
+	Date    time.Time `json:"date"`
+}
+
+// Member finds the balance of the member known by key.
+func (l *Ledger) Member(key string) *Balance {
+	for _, b := range l.Members {
+		if b.Member == key {
+			return b
+		}
+	}
+	return nil
+}
+
+// progress orders the statuses a request moves through.
+var progress = map[string]int{StatusOpen: 0, StatusPaid: 1, StatusSettled: 2}
+
+// Status is how far mon is settled.
+func Status(mon *datastore.MonetaryRequest) string {
+	switch {
+	case mon.ConfirmedFrom:
+		return StatusSettled
+	case mon.ConfirmedTo:
+		return StatusPaid
+	}
+	return StatusOpen
+}
+
+// Compute builds the ledger of the group groupId from the requests
+// stored under its members. Both copies of a request are read as one.
+func Compute(
+	ctx context.Context,
+	db datastore.GiveMeDatabase,
+	groupId string,
+) (*Ledger, error) {
+	g, err := db.GetGroup(ctx, groupId)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Ledger{
+		Group:       g.Id,
+		Name:        g.Name,
+		Spent:       Amounts{},
+		Outstanding: []*Entry{},
+		Settled:     true,
+		Date:        time.Now(),
+	}
+	byPhone := make(map[string]*Balance)
+	for _, m := range g.Members {
+		b := newBalance(m.Key())
+		l.Members = append(l.Members, b)
+		if m.Phone != "" {
+			byPhone[m.Phone] = b
+		}
+	}
+
+	requests := make(map[string]*datastore.MonetaryRequest)
+	for _, id := range g.ProfileIds() {
+		profile, err := db.GetProfile(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		b := l.Member(id)
+		for _, phone := range append([]string{profile.Phone}, profile.PreviousPhones...) {
+			if phone != "" {
+				byPhone[phone] = b
+			}
+		}
+		mts, err := db.GetMonetaryRequestsFromGroup(ctx, id, g.Id)
+		if err != nil {
+			return nil, err
+		}
+		for _, mon := range mts {
+			// Copies drifting apart are read as the further settled.
+			if old, ok := requests[mon.Snowflake]; !ok || progress[Status(mon)] > progress[Status(old)] {
+				requests[mon.Snowflake] = mon
+			}
+		}
+	}
+
+	// Parties no longer in the group are known by phone.
+	balance := func(phone string) *Balance {
+		b, ok := byPhone[phone]
+		if !ok {
+			b = newBalance(phone)
+			b.Former = true
+			byPhone[phone] = b
+			l.Members = append(l.Members, b)
+		}
+		return b
+	}
+	for _, mon := range sorted(requests) {
+		l.Requests++
+		l.Spent.add(mon)
+		creditor, debtor := balance(mon.From), balance(mon.To)
+		creditor.Paid.add(mon)
+		debtor.Owed.add(mon)
+
+		status := Status(mon)
+		if status == StatusSettled {
+			continue
+		}
+		l.Settled = false
+		creditor.Receivable.add(mon)
+		debtor.Payable.add(mon)
+		creditor.Open++
+		debtor.Open++
+		l.Outstanding = append(l.Outstanding, &Entry{
+			Snowflake:   mon.Snowflake,
+			From:        mon.From,
+			To:          mon.To,
+			Desc:        mon.Desc,
+			Date:        mon.Date,
+			AmountUnit:  mon.AmountUnit,
+			AmountCents: mon.AmountCents,
+			Currency:    mon.Currency,
+			Status:      status,
+		})
+	}
+	return l, nil
+}
+
+func newBalance(member string) *Balance {
+	return &Balance{
+		Member:     member,
+		Paid:       Amounts{},
+		Owed:       Amounts{},
+		Receivable: Amounts{},
+		Payable:    Amounts{},
+	}
+}
+
+// sorted lists requests oldest first, by snowflake on the same date.
+func sorted(requests map[string]*datastore.MonetaryRequest) []*datastore.MonetaryRequest {
+	mts := make([]*datastore.MonetaryRequest, 0, len(requests))
+	for _, mon := range requests {
+		mts = append(mts, mon)
+	}
+	sort.Slice(mts, func(i, j int) bool {
+		if !mts[i].Date.Equal(mts[j].Date) {
+			return mts[i].Date.Before(mts[j].Date)
+		}
+		return mts[i].Snowflake < mts[j].Snowflake
+	})
+	return mts
+}
@@ -0,0 +1,87 @@
+package ledger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/datastore/datastoretest"
+)
+
+func TestCompute(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	datastoretest.AddProfiles(t, ctx, db,
+		datastore.UID{Id: "a", Phone: "+351111111111", PreviousPhones: []string{"+351100000000"}},
+		datastore.UID{Id: "b", Phone: "+351222222222"},
+	)
+	_, err := db.AddGroup(ctx, &datastore.Group{
+		Id:   "trip",
+		Name: "Trip",
+		Members: []datastore.GroupMember{
+			{ProfileId: "a", Role: datastore.RoleAdmin},
+			{ProfileId: "b", Role: datastore.RoleMember},
+			{Phone: "+351333333333", Role: datastore.RoleMember},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2019, 2, 13, 0, 0, 0, 0, time.UTC)
+	request := func(snowflake string, from string, to string, months int) *datastore.MonetaryRequest {
+		return &datastore.MonetaryRequest{
+			From:        from,
+			To:          to,
+			Date:        date.AddDate(0, months, 0),
+			AmountUnit:  3,
+			AmountCents: 50,
+			Currency:    "€",
+			Snowflake:   snowflake,
+			Group:       "trip",
+		}
+	}
+	// Paid by a, before changing number, in February.
+	db.SetMirroredMonetaryRequest(ctx, request("s1", "+351100000000", "+351222222222", 0),
+		"MonetaryRequests/a/2019-02", "MonetaryRequests/b/2019-02", nil)
+	// Charged to c, who has no profile, so the creditor's copy alone.
+	db.SetMonetaryRequestByFullPath(ctx, request("s2", "+351111111111", "+351333333333", 0),
+		"MonetaryRequests/a/2019-02")
+	// Paid by b in March, and settled.
+	settled := request("s3", "+351222222222", "+351111111111", 1)
+	settled.ConfirmedFrom, settled.ConfirmedTo = true, true
+	db.SetMirroredMonetaryRequest(ctx, settled,
+		"MonetaryRequests/b/2019-03", "MonetaryRequests/a/2019-03", nil)
+	// Paid by a to someone who left, in another group too.
+	db.SetMonetaryRequestByFullPath(ctx, request("s4", "+351111111111", "+351444444444", 1),
+		"MonetaryRequests/a/2019-03")
+	other := request("s5", "+351111111111", "+351222222222", 0)
+	other.Group = "other"
+	db.SetMonetaryRequestByFullPath(ctx, other, "MonetaryRequests/a/2019-02")
+
+	l, err := Compute(ctx, db, "trip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Requests != 4 || l.Spent["€"] != 1400 || l.Settled {
+		t.Errorf("%+v", l)
+	}
+	if len(l.Outstanding) != 3 || l.Outstanding[0].Snowflake != "s1" || l.Outstanding[2].Snowflake != "s4" {
+		t.Errorf("%+v", l.Outstanding)
+	}
+
+	a, b, c, former := l.Member("a"), l.Member("b"), l.Member("+351333333333"), l.Member("+351444444444")
+	if a == nil || b == nil || c == nil || former == nil || !former.Former || len(l.Members) != 4 {
+		t.Fatalf("%+v", l.Members)
+	}
+	if a.Paid["€"] != 1050 || a.Receivable["€"] != 1050 || a.Owed["€"] != 350 || a.Payable["€"] != 0 || a.Open != 3 {
+		t.Errorf("a: %+v", a)
+	}
+	if b.Paid["€"] != 350 || b.Receivable["€"] != 0 || b.Payable["€"] != 350 || b.Open != 1 {
+		t.Errorf("b: %+v", b)
+	}
+	if c.Payable["€"] != 350 || c.Open != 1 {
+		t.Errorf("c: %+v", c)
+	}
+}
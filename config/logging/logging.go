@@ -0,0 +1,269 @@
+// Package logging writes structured JSON logs Cloud Logging reads
+// severity and trace from, correlated through the context: the event,
+// handler, document path and users being worked on, and one trace id
+// from the trigger down to the datastore and notifier calls.
+// User ids and phone numbers are logged redacted.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+)
+
+// Severities, as Cloud Logging names them.
+const (
+	severityDebug   = "DEBUG"
+	severityInfo    = "INFO"
+	severityWarning = "WARNING"
+	severityError   = "ERROR"
+)
+
+// traceKey is the field Cloud Logging correlates traces by.
+const traceKey = "logging.googleapis.com/trace"
+
+var output = struct {
+	sync.Mutex
+	w io.Writer
+}{w: os.Stdout}
+
+// SetOutput sets where entries are written, stdout by default.
+func SetOutput(w io.Writer) {
+	output.Lock()
+	defer output.Unlock()
+	output.w = w
+}
+
+type contextKey struct{}
+
+// fields are what the context correlates entries by.
+type fields struct {
+	trace   string
+	eventId string
+	handler string
+	path    string
+	users   []string
+}
+
+func fromContext(ctx context.Context) fields {
+	if f, ok := ctx.Value(contextKey{}).(fields); ok {
+		return f
+	}
+	return fields{}
+}
+
+func (f fields) into(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKey{}, f)
+}
+
+// WithTrace sets the trace id of ctx, a 32 digit hexadecimal string.
+func WithTrace(
+	ctx context.Context,
+	trace string,
+) context.Context {
+	f := fromContext(ctx)
+	f.trace = trace
+	return f.into(ctx)
+}
+
+// TraceId is the trace id of ctx, empty when none was set.
+func TraceId(ctx context.Context) string {
+	return fromContext(ctx).trace
+}
+
+// ForEvent starts the entries of handler working on the document
+// at path, with the event id in the metadata of ctx. Without a trace
+// id yet, one is derived from the event id, so retries of an event
+// share a trace, or made up when there is no event id either.
+func ForEvent(
+	ctx context.Context,
+	handler string,
+	path string,
+) context.Context {
+	f := fromContext(ctx)
+	f.handler = handler
+	f.path = RedactPath(path)
+	if meta, err := metadata.FromContext(ctx); err == nil {
+		f.eventId = meta.EventID
+	}
+	if f.trace == "" {
+		f.trace = newTrace(f.eventId)
+	}
+	return f.into(ctx)
+}
+
+// WithUsers adds users ctx works on behalf of, redacted.
+func WithUsers(
+	ctx context.Context,
+	ids ...string,
+) context.Context {
+	f := fromContext(ctx)
+	users := append([]string(nil), f.users...)
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		r := Redact(id)
+		seen := false
+		for _, u := range users {
+			seen = seen || u == r
+		}
+		if !seen {
+			users = append(users, r)
+		}
+	}
+	f.users = users
+	return f.into(ctx)
+}
+
+// Redact stands in for a user id or a phone number in logs,
+// the same one for the same value, so entries still correlate.
+func Redact(s string) string {
+	if s == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(s))
+	return "r-" + hex.EncodeToString(sum[:6])
+}
+
+// RedactPath redacts the user id of a document path, the id
+// of the top level document every root of the schema is keyed by.
+func RedactPath(path string) string {
+	if i := strings.Index(path, "/documents/"); i >= 0 {
+		path = path[i+len("/documents/"):]
+	}
+	segments := strings.Split(path, "/")
+	if len(segments) > 1 {
+		segments[1] = Redact(segments[1])
+	}
+	return strings.Join(segments, "/")
+}
+
+// TraceFromHeader reads the trace id of an HTTP request, from the
+// W3C traceparent header or the older X-Cloud-Trace-Context.
+func TraceFromHeader(h http.Header) string {
+	// traceparent: 00-{trace}-{span}-{flags}
+	if parts := strings.Split(h.Get("Traceparent"), "-"); len(parts) == 4 && isTrace(parts[1]) {
+		return parts[1]
+	}
+	// X-Cloud-Trace-Context: {trace}/{span};o={flags}
+	trace := strings.SplitN(h.Get("X-Cloud-Trace-Context"), "/", 2)[0]
+	if isTrace(trace) {
+		return strings.ToLower(trace)
+	}
+	return ""
+}
+
+func isTrace(s string) bool {
+	if len(s) != 32 || s == strings.Repeat("0", 32) {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func newTrace(eventId string) string {
+	if eventId != "" {
+		sum := sha256.Sum256([]byte(eventId))
+		return hex.EncodeToString(sum[:16])
+	}
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Debug logs msg with the key and value pairs in kv.
+func Debug(ctx context.Context, msg string, kv ...interface{}) {
+	write(ctx, severityDebug, msg, kv)
+}
+
+// Info logs msg with the key and value pairs in kv.
+func Info(ctx context.Context, msg string, kv ...interface{}) {
+	write(ctx, severityInfo, msg, kv)
+}
+
+// Warning logs msg with the key and value pairs in kv.
+func Warning(ctx context.Context, msg string, kv ...interface{}) {
+	write(ctx, severityWarning, msg, kv)
+}
+
+// Error logs msg with the key and value pairs in kv.
+func Error(ctx context.Context, msg string, kv ...interface{}) {
+	write(ctx, severityError, msg, kv)
+}
+
+func write(
+	ctx context.Context,
+	severity string,
+	msg string,
+	kv []interface{},
+) {
+	entry := make(map[string]interface{}, len(kv)/2+8)
+	for i := 0; i < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		var v interface{} = "(missing)"
+		if i+1 < len(kv) {
+			v = kv[i+1]
+		}
+		switch x := v.(type) {
+		case error:
+			v = x.Error()
+		case fmt.Stringer:
+			v = x.String()
+		}
+		entry[key] = v
+	}
+
+	f := fromContext(ctx)
+	if f.trace != "" {
+		entry[traceKey] = f.trace
+		if project := project(); project != "" {
+			entry[traceKey] = "projects/" + project + "/traces/" + f.trace
+		}
+	}
+	if f.eventId != "" {
+		entry["eventId"] = f.eventId
+	}
+	if f.handler != "" {
+		entry["handler"] = f.handler
+	}
+	if f.path != "" {
+		entry["path"] = f.path
+	}
+	if len(f.users) > 0 {
+		entry["users"] = f.users
+	}
+	entry["severity"] = severity
+	entry["message"] = msg
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{
+			"severity": severityError,
+			"message":  fmt.Sprintf("logging: could not encode %q: %v", msg, err),
+		})
+	}
+	output.Lock()
+	defer output.Unlock()
+	output.w.Write(append(b, '\n'))
+}
+
+// project is the project traces belong to, as the runtime sets it.
+func project() string {
+	if p := os.Getenv("GOOGLE_CLOUD_PROJECT"); p != "" {
+		return p
+	}
+	return os.Getenv("GCP_PROJECT")
+}
@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/functions/metadata"
+)
+
+func TestEntriesCarryTheContext(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	defer SetOutput(os.Stdout)
+	os.Setenv("GOOGLE_CLOUD_PROJECT", "p")
+	defer os.Unsetenv("GOOGLE_CLOUD_PROJECT")
+
+	ctx := metadata.NewContext(
+		context.Background(),
+		&metadata.Metadata{EventID: "e1"},
+	)
+	ctx = ForEvent(ctx, "request", "projects/p/databases/(default)/documents/MonetaryRequests/a/2019-02/s1")
+	ctx = WithUsers(ctx, "a", "b", "a")
+	Warning(ctx, "Retrying", "attempt", 2, "error", errors.New("unavailable"))
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatal(out.String(), err)
+	}
+	trace := TraceId(ctx)
+	if len(trace) != 32 || trace != TraceId(ForEvent(metadata.NewContext(context.Background(), &metadata.Metadata{EventID: "e1"}), "request", "")) {
+		t.Errorf("trace %q is not derived from the event id", trace)
+	}
+	want := map[string]interface{}{
+		"severity": "WARNING",
+		"message":  "Retrying",
+		traceKey:   "projects/p/traces/" + trace,
+		"eventId":  "e1",
+		"handler":  "request",
+		"path":     "MonetaryRequests/" + Redact("a") + "/2019-02/s1",
+		"attempt":  float64(2),
+		"error":    "unavailable",
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("%v: %v, want %v", k, entry[k], v)
+		}
+	}
+	if users, _ := entry["users"].([]interface{}); len(users) != 2 || users[0] != Redact("a") {
+		t.Errorf("users %v", entry["users"])
+	}
+	if strings.Contains(out.String(), `"a"`) {
+		t.Errorf("user id logged unredacted: %v", out.String())
+	}
+}
+
+func TestTraceFromHeader(t *testing.T) {
+	for _, c := range []struct {
+		key, value, want string
+	}{
+		{"Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"X-Cloud-Trace-Context", "4BF92F3577B34DA6A3CE929D0E0E4736/1;o=1", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"Traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", ""},
+		{"X-Cloud-Trace-Context", "short/1", ""},
+	} {
+		h := http.Header{}
+		h.Set(c.key, c.value)
+		if got := TraceFromHeader(h); got != c.want {
+			t.Errorf("%v: %q, want %q", c.value, got, c.want)
+		}
+	}
+}
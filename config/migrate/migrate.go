@@ -0,0 +1,74 @@
+// Package migrate moves request copies written under a stale
+// collection root over to the canonical one.
+package migrate
+
+import (
+	"context"
+	"log"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/paths"
+)
+
+// Report lists what a Run moved, or would move when dry.
+// Conflicts are copies whose destination is already taken,
+// left in place for the consistency checker to look at.
+type Report struct {
+	From      string   `json:"from"`
+	To        string   `json:"to"`
+	Moved     []string `json:"moved"`
+	Conflicts []string `json:"conflicts"`
+	Failed    []string `json:"failed"`
+}
+
+// Run moves every copy under the from root to the same
+// {uid}/{month}/{snowflake} under the to root. Moves are
+// one by one, so an interrupted Run is resumed by running it again.
+func Run(
+	ctx context.Context,
+	db datastore.GiveMeDatabase,
+	from string,
+	to string,
+	dry bool,
+) (*Report, error) {
+	report := &Report{From: from, To: to}
+	owners, err := db.ListMonetaryRequestOwners(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	for _, owner := range owners {
+		stored, err := db.ListMonetaryRequests(ctx, from, owner)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range stored {
+			src, err := paths.Parse(c.Path)
+			if err != nil {
+				return nil, err
+			}
+			src = src.WithSnowflake(c.Request.Snowflake)
+			dst := src
+			dst.Root = to
+
+			if dry {
+				report.Moved = append(report.Moved, src.String())
+				continue
+			}
+			moved, err := db.MoveMonetaryRequest(
+				ctx,
+				src.Collection(),
+				dst.Collection(),
+				src.Snowflake,
+			)
+			if err != nil {
+				log.Print(err)
+				report.Failed = append(report.Failed, src.String())
+			} else if moved {
+				report.Moved = append(report.Moved, src.String())
+			} else {
+				report.Conflicts = append(report.Conflicts, src.String())
+			}
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,50 @@
+package migrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/schema"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	legacy := schema.LegacyMonetaryRequests + "/b/2019-02"
+	canonical := schema.MonetaryRequests + "/b/2019-02"
+	db.SetMonetaryRequestByFullPath(ctx, &datastore.MonetaryRequest{AmountUnit: 1, Snowflake: "s1"}, legacy)
+	db.SetMonetaryRequestByFullPath(ctx, &datastore.MonetaryRequest{AmountUnit: 1, Snowflake: "s2"}, legacy)
+	db.SetMonetaryRequestByFullPath(ctx, &datastore.MonetaryRequest{AmountUnit: 2, Snowflake: "s2"}, canonical)
+
+	report, err := Run(ctx, db, schema.LegacyMonetaryRequests, schema.MonetaryRequests, true)
+	if err != nil || len(report.Moved) != 2 {
+		t.Fatal(report, err)
+	}
+	if _, err := db.GetMonetaryRequestWithDateString(ctx, "b", "2019-02", "s1"); err == nil {
+		t.Error("dry run moved s1")
+	}
+
+	report, err = Run(ctx, db, schema.LegacyMonetaryRequests, schema.MonetaryRequests, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Moved) != 1 || report.Moved[0] != legacy+"/s1" {
+		t.Error(report.Moved)
+	}
+	if len(report.Conflicts) != 1 || report.Conflicts[0] != legacy+"/s2" {
+		t.Error(report.Conflicts)
+	}
+	if mon, err := db.GetMonetaryRequestWithDateString(ctx, "b", "2019-02", "s1"); err != nil || mon.AmountUnit != 1 {
+		t.Error(mon, err)
+	}
+	if mon, _ := db.GetMonetaryRequestWithDateString(ctx, "b", "2019-02", "s2"); mon.AmountUnit != 2 {
+		t.Error("conflict overwrote the canonical copy")
+	}
+
+	// Only the conflict is left behind.
+	report, _ = Run(ctx, db, schema.LegacyMonetaryRequests, schema.MonetaryRequests, false)
+	if len(report.Moved) != 0 || len(report.Conflicts) != 1 {
+		t.Error(report)
+	}
+}
@@ -0,0 +1,259 @@
+// Package outbox delivers notifications enqueued alongside data changes,
+// retrying with exponential backoff until they are sent or dead.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	fcm "firebase.google.com/go/messaging"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/schema"
+	"github.com/Seriyin/GiveMeBackend/config/logging"
+)
+
+// Key derives the idempotency key of a notification. The same action on
+// the same request for the same recipient always maps to one outbox entry.
+func Key(
+	action string,
+	snowflake string,
+	recipient string,
+) string {
+	// Keys double as document ids, which cannot hold a slash.
+	return strings.Replace(
+		action+":"+snowflake+":"+recipient,
+		"/",
+		"_",
+		-1,
+	)
+}
+
+// New prepares a pending notification about transfer for recipient,
+// naming the counterparty as name. It carries the trace of ctx,
+// so its delivery logs under the change that enqueued it.
+func New(
+	ctx context.Context,
+	action string,
+	recipient string,
+	transfer *datastore.MonetaryRequest,
+	link messaging.Link,
+	name string,
+) *datastore.Notification {
+	now := time.Now()
+	return &datastore.Notification{
+		Key:         Key(action, link.Snowflake, recipient),
+		Recipient:   recipient,
+		Action:      action,
+		Path:        link.Path,
+		Snowflake:   link.Snowflake,
+		AmountUnit:  transfer.AmountUnit,
+		AmountCents: transfer.AmountCents,
+		Currency:    transfer.Currency,
+		Name:        name,
+		Status:      datastore.NotificationPending,
+		NextAttempt: now,
+		Created:     now,
+		Trace:       logging.TraceId(ctx),
+	}
+}
+
+// NewMembership prepares a pending notification telling recipient
+// they joined or left g, by the change of g made at version. Each
+// change of membership is its own notification, so members leaving
+// and joining again hear of both.
+func NewMembership(
+	ctx context.Context,
+	action string,
+	recipient string,
+	g *datastore.Group,
+	version time.Time,
+) *datastore.Notification {
+	now := time.Now()
+	return &datastore.Notification{
+		Key: Key(
+			action,
+			g.Id+"@"+strconv.FormatInt(version.UnixNano(), 10),
+			recipient,
+		),
+		Recipient:   recipient,
+		Action:      action,
+		Path:        schema.Groups,
+		Snowflake:   g.Id,
+		Name:        g.Name,
+		Members:     int64(len(g.Members)),
+		Status:      datastore.NotificationPending,
+		NextAttempt: now,
+		Created:     now,
+		Trace:       logging.TraceId(ctx),
+	}
+}
+
+// NewSummary prepares a pending notification telling recipient
+// open of their requests in g are still to settle, as of the day
+// of period. One is enqueued per day at most, however often the
+// summary runs.
+func NewSummary(
+	ctx context.Context,
+	recipient string,
+	g *datastore.Group,
+	open int64,
+	period time.Time,
+) *datastore.Notification {
+	now := time.Now()
+	return &datastore.Notification{
+		Key: Key(
+			messaging.ActionGroupSummary,
+			g.Id+"@"+period.UTC().Format("2006-01-02"),
+			recipient,
+		),
+		Recipient: recipient,
+		Action:    messaging.ActionGroupSummary,
+		Path:      schema.Groups,
+		Snowflake: g.Id,
+		Name:      g.Name,
+		// Members carries the count the message renders.
+		Members:     open,
+		Status:      datastore.NotificationPending,
+		NextAttempt: now,
+		Created:     now,
+		Trace:       logging.TraceId(ctx),
+	}
+}
+
+// Dispatcher delivers outbox notifications.
+type Dispatcher struct {
+	DB       datastore.GiveMeDatabase
+	Notifier messaging.Notifier
+	// MaxAttempts before a notification is marked dead.
+	MaxAttempts int64
+	// BaseDelay doubles on every failed attempt, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Lease keeps other dispatchers off a notification being delivered.
+	Lease time.Duration
+	// Now is overridable for tests.
+	Now func() time.Time
+}
+
+// NewDispatcher creates a Dispatcher with the default retry policy.
+func NewDispatcher(
+	db datastore.GiveMeDatabase,
+	notifier messaging.Notifier,
+) *Dispatcher {
+	return &Dispatcher{
+		DB:          db,
+		Notifier:    notifier,
+		MaxAttempts: 8,
+		BaseDelay:   30 * time.Second,
+		MaxDelay:    time.Hour,
+		Lease:       time.Minute,
+		Now:         time.Now,
+	}
+}
+
+// Backoff is the wait after the given number of failed attempts.
+func (d *Dispatcher) Backoff(attempts int64) time.Duration {
+	delay := d.BaseDelay
+	for i := int64(1); i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxDelay {
+		return d.MaxDelay
+	}
+	return delay
+}
+
+// Dispatch attempts delivery of the notification under key,
+// if it is pending and due. Devices reached by an earlier attempt
+// are skipped, so a retry never pushes to them twice.
+func (d *Dispatcher) Dispatch(
+	ctx context.Context,
+	key string,
+) error {
+	now := d.Now()
+	n, ok, err := d.DB.ClaimNotification(ctx, key, now, d.Lease)
+	if err != nil || !ok {
+		return err
+	}
+	if n.Trace != "" {
+		ctx = logging.WithTrace(ctx, n.Trace)
+	}
+	ctx = logging.WithUsers(ctx, n.Recipient)
+
+	err = d.deliver(ctx, n, now)
+	if err == nil {
+		n.Status = datastore.NotificationSent
+		n.LastError = ""
+	} else {
+		n.LastError = err.Error()
+		if n.Attempts >= d.MaxAttempts {
+			n.Status = datastore.NotificationDead
+			logging.Error(ctx, "Notification dead", "action", n.Action, "snowflake", n.Snowflake, "attempts", n.Attempts, "error", err)
+		} else {
+			logging.Warning(ctx, "Notification failed, retrying", "action", n.Action, "snowflake", n.Snowflake, "attempts", n.Attempts, "error", err)
+			n.NextAttempt = now.Add(d.Backoff(n.Attempts))
+		}
+	}
+	return d.DB.UpdateNotification(ctx, n)
+}
+
+func (d *Dispatcher) deliver(
+	ctx context.Context,
+	n *datastore.Notification,
+	now time.Time,
+) error {
+	profile, err := d.DB.GetProfile(ctx, n.Recipient)
+	if err != nil {
+		return err
+	}
+	sent := make(map[string]bool)
+	for _, token := range n.SentTokens {
+		sent[token] = true
+	}
+	var devices []datastore.Device
+	for _, device := range profile.ActiveDevices(now) {
+		if !sent[device.Token] {
+			devices = append(devices, device)
+		}
+	}
+	// Every device of the recipient is reached by one multicast.
+	reached, err := messaging.SendToDevices(
+		ctx,
+		d.Notifier,
+		d.DB,
+		profile,
+		devices,
+		func(device datastore.Device) (*fcm.Message, error) {
+			return messaging.Render(n, device, profile.Language)
+		},
+	)
+	n.SentTokens = append(n.SentTokens, reached...)
+	return err
+}
+
+// DispatchDue attempts every notification due now, up to limit.
+func (d *Dispatcher) DispatchDue(
+	ctx context.Context,
+	limit int,
+) error {
+	due, err := d.DB.GetDueNotifications(ctx, d.Now(), limit)
+	if err != nil {
+		return err
+	}
+	var failed int
+	for _, n := range due {
+		if err := d.Dispatch(ctx, n.Key); err != nil {
+			logging.Error(ctx, "Could not update notification", "action", n.Action, "snowflake", n.Snowflake, "error", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("outbox: %v of %v notifications could not be updated", failed, len(due))
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	fcm "firebase.google.com/go/messaging"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
+	"github.com/Seriyin/GiveMeBackend/config/logging"
+)
+
+func TestDispatchRetriesWithoutDuplicates(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	now := time.Date(2019, 2, 13, 0, 0, 0, 0, time.UTC)
+	db.AddProfile(ctx, &datastore.Profile{UID: datastore.UID{Id: "b"}})
+	db.RegisterDevice(ctx, "b", datastore.Device{Token: "phone", LastSeen: now})
+	db.RegisterDevice(ctx, "b", datastore.Device{Token: "tablet", LastSeen: now})
+
+	tabletDown := true
+	notifier := &messaging.RecordingNotifier{
+		Fail: func(m *fcm.Message) error {
+			if tabletDown && m.Token == "tablet" {
+				return errors.New("unavailable")
+			}
+			return nil
+		},
+	}
+	d := NewDispatcher(db, notifier)
+	d.Now = func() time.Time { return now }
+
+	transfer := &datastore.MonetaryRequest{
+		From:       "+351345345345",
+		To:         "+351366366366",
+		AmountUnit: 4,
+		Currency:   "€",
+		Snowflake:  "s1",
+	}
+	link := messaging.Link{Path: "MonetaryRequests/b/2019-02", Snowflake: "s1"}
+	// The trace of the enqueuing event carries on to the deliveries.
+	trace := "4bf92f3577b34da6a3ce929d0e0e4736"
+	n := New(logging.WithTrace(ctx, trace), messaging.ActionRequest, "b", transfer, link, transfer.From)
+	n.NextAttempt = now
+	// Enqueueing twice, as a replayed event would, keeps one entry.
+	for i := 0; i < 2; i++ {
+		db.SetMonetaryRequestByFullPathWithOutbox(ctx, transfer, link.Path, []*datastore.Notification{n})
+	}
+
+	if err := d.DispatchDue(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.Messages()) != 1 {
+		t.Fatal(notifier.Messages())
+	}
+
+	// Not due until the backoff elapses.
+	d.DispatchDue(ctx, 10)
+	if len(notifier.Messages()) != 1 {
+		t.Fatal(notifier.Messages())
+	}
+
+	tabletDown = false
+	now = now.Add(d.Backoff(1))
+	d.DispatchDue(ctx, 10)
+	sent := notifier.Messages()
+	if len(sent) != 2 || sent[1].Token != "tablet" {
+		t.Fatal(sent)
+	}
+
+	due, _ := db.GetDueNotifications(ctx, now.Add(time.Hour), 10)
+	if len(due) != 0 {
+		t.Error(due)
+	}
+	deliveries, _ := db.GetDeliveriesForRequest(ctx, "s1")
+	for _, d := range deliveries {
+		if d.Trace != trace {
+			t.Errorf("%+v", d)
+		}
+	}
+	if len(deliveries) == 0 {
+		t.Error("no deliveries recorded")
+	}
+}
+
+func TestDispatchDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	now := time.Date(2019, 2, 13, 0, 0, 0, 0, time.UTC)
+	db.AddProfile(ctx, &datastore.Profile{UID: datastore.UID{Id: "b", Token: "legacy"}})
+	notifier := &messaging.RecordingNotifier{
+		Fail: func(m *fcm.Message) error { return errors.New("unavailable") },
+	}
+	d := NewDispatcher(db, notifier)
+	d.MaxAttempts = 3
+	d.Now = func() time.Time { return now }
+
+	transfer := &datastore.MonetaryRequest{Snowflake: "s1"}
+	n := New(ctx, messaging.ActionReminder, "b", transfer, messaging.Link{Snowflake: "s1"}, "a")
+	n.NextAttempt = now
+	db.SetMonetaryRequestByFullPathWithOutbox(ctx, transfer, "MonetaryRequests/b/2019-02", []*datastore.Notification{n})
+
+	for i := 0; i < 5; i++ {
+		d.Dispatch(ctx, n.Key)
+		now = now.Add(d.MaxDelay)
+	}
+	due, _ := db.GetDueNotifications(ctx, now, 10)
+	if len(due) != 0 {
+		t.Error(due)
+	}
+	if claimed, ok, _ := db.ClaimNotification(ctx, n.Key, now, d.Lease); ok {
+		t.Error(claimed)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(nil, nil)
+	if d.Backoff(1) != d.BaseDelay || d.Backoff(2) != 2*d.BaseDelay || d.Backoff(20) != d.MaxDelay {
+		t.Error(d.Backoff(1), d.Backoff(2), d.Backoff(20))
+	}
+}
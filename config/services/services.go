@@ -0,0 +1,182 @@
+// Package services builds the clients the functions depend on,
+// lazily and once per Container, so importing a function reaches
+// nothing and failing to reach Firebase is an error, not an exit.
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+
+	fb "firebase.google.com/go"
+	"firebase.google.com/go/auth"
+
+	"github.com/Seriyin/GiveMeBackend/config/cache"
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
+	"github.com/Seriyin/GiveMeBackend/config/telemetry"
+)
+
+// LocalEnv, when set in the environment, makes ConfigFromEnv local.
+const LocalEnv = "GIVEME_LOCAL"
+
+// ErrLocal is returned for services with no local stand-in.
+var ErrLocal = errors.New("services: not available locally")
+
+// Users looks up Firebase Auth users and verifies the ID tokens
+// they sign in with.
+type Users interface {
+	GetUser(ctx context.Context, uid string) (*auth.UserRecord, error)
+	VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error)
+}
+
+// Config selects what a Container builds.
+type Config struct {
+	// Local uses an in-memory database and a recording notifier.
+	Local bool
+	// DB, Notifier and Users, when set, are used as they are.
+	// Those built for Firebase are traced through telemetry,
+	// and the database caches profiles.
+	DB       datastore.GiveMeDatabase
+	Notifier messaging.Notifier
+	Users    Users
+}
+
+// ConfigFromEnv is the Config of the deployed functions.
+func ConfigFromEnv() Config {
+	return Config{Local: os.Getenv(LocalEnv) != ""}
+}
+
+// Container hands out the services of its Config, building each on
+// first use. A failed build is retried on the next use.
+type Container struct {
+	config Config
+
+	mutex sync.Mutex
+	app   *fb.App
+}
+
+// New creates a Container building nothing until asked.
+func New(config Config) *Container {
+	return &Container{config: config}
+}
+
+var defaultContainer = struct {
+	sync.Mutex
+	c *Container
+}{}
+
+// Default is the Container the function entry points use,
+// configured from the environment unless SetDefault replaced it.
+// Creating it also starts exporting telemetry, if the environment
+// names an OTLP endpoint.
+func Default() *Container {
+	defaultContainer.Lock()
+	defer defaultContainer.Unlock()
+
+	if defaultContainer.c == nil {
+		if e := telemetry.ExporterFromEnv(); e != nil {
+			telemetry.SetExporter(e)
+		}
+		defaultContainer.c = New(ConfigFromEnv())
+	}
+	return defaultContainer.c
+}
+
+// SetDefault replaces the Default container, for hosts such as
+// the dev server. Call it before any function runs.
+func SetDefault(c *Container) {
+	defaultContainer.Lock()
+	defer defaultContainer.Unlock()
+
+	defaultContainer.c = c
+}
+
+// getApp connects to Firebase, caller must hold the mutex.
+func (c *Container) getApp(ctx context.Context) (*fb.App, error) {
+	if c.app == nil {
+		app, err := firebase.NewApp(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.app = app
+	}
+	return c.app, nil
+}
+
+// DB is the database, in memory when local.
+func (c *Container) DB() (datastore.GiveMeDatabase, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.config.DB == nil {
+		if c.config.Local {
+			c.config.DB = datastore.NewMemoryDB()
+		} else {
+			ctx := context.Background()
+			app, err := c.getApp(ctx)
+			if err != nil {
+				return nil, err
+			}
+			db, err := firebase.NewDB(ctx, app)
+			if err != nil {
+				return nil, err
+			}
+			c.config.DB = cache.New(
+				telemetry.Database(db),
+				cache.DefaultSize,
+				cache.DefaultTTL,
+			)
+		}
+	}
+	return c.config.DB, nil
+}
+
+// Notifier sends pushes, recording them instead when local.
+func (c *Container) Notifier() (messaging.Notifier, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.config.Notifier == nil {
+		if c.config.Local {
+			c.config.Notifier = &messaging.RecordingNotifier{}
+		} else {
+			ctx := context.Background()
+			app, err := c.getApp(ctx)
+			if err != nil {
+				return nil, err
+			}
+			n, err := firebase.NewNotifier(ctx, app)
+			if err != nil {
+				return nil, err
+			}
+			c.config.Notifier = telemetry.Notifier(n)
+		}
+	}
+	return c.config.Notifier, nil
+}
+
+// Users looks up Firebase Auth users, never available locally.
+func (c *Container) Users() (Users, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.config.Users == nil {
+		if c.config.Local {
+			return nil, ErrLocal
+		}
+		ctx := context.Background()
+		app, err := c.getApp(ctx)
+		if err != nil {
+			return nil, err
+		}
+		users, err := firebase.NewAuth(ctx, app)
+		if err != nil {
+			return nil, err
+		}
+		c.config.Users = users
+	}
+	return c.config.Users, nil
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
+)
+
+func TestLocal(t *testing.T) {
+	c := New(Config{Local: true})
+	db, err := c.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := c.DB(); again != db {
+		t.Error("built the database twice")
+	}
+	if n, err := c.Notifier(); err != nil {
+		t.Error(err)
+	} else if _, ok := n.(*messaging.RecordingNotifier); !ok {
+		t.Errorf("%T", n)
+	}
+	if _, err := c.Users(); err != ErrLocal {
+		t.Error(err)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	db := datastore.NewMemoryDB()
+	notifier := &messaging.RecordingNotifier{}
+	SetDefault(New(Config{DB: db, Notifier: notifier}))
+	defer SetDefault(nil)
+
+	if got, _ := Default().DB(); got != db {
+		t.Error(got)
+	}
+	if got, _ := Default().Notifier(); got != notifier {
+		t.Error(got)
+	}
+}
@@ -0,0 +1,594 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+// Ensure the decorator conforms to the GiveMeDatabase interface.
+var _ datastore.GiveMeDatabase = &tracedDB{}
+
+// tracedDB traces and times every method of the database it wraps.
+type tracedDB struct {
+	db datastore.GiveMeDatabase
+}
+
+// Database wraps db, whatever its backend, so every call is a span
+// of the calling trace timed into Latency.
+func Database(db datastore.GiveMeDatabase) datastore.GiveMeDatabase {
+	return &tracedDB{db: db}
+}
+
+// start starts the span of method, returning what ends it.
+func (db *tracedDB) start(
+	ctx context.Context,
+	method string,
+) (context.Context, func(err error)) {
+	name := "datastore." + method
+	start := time.Now()
+	ctx, span := Start(ctx, name)
+	return ctx, func(err error) {
+		span.End(err)
+		Latency.Since(ctx, start, Attr("method", name), Attr("outcome", Outcome(err)))
+	}
+}
+
+// Outcome names the kind of err, as datastore classifies it,
+// so latencies of lookups finding nothing stand apart from failures.
+func Outcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, datastore.ErrNotFound):
+		return "not_found"
+	case errors.Is(err, datastore.ErrAlreadyExists):
+		return "already_exists"
+	case errors.Is(err, datastore.ErrConflict):
+		return "conflict"
+	case errors.Is(err, datastore.ErrInvalidEvent):
+		return "invalid"
+	case errors.Is(err, datastore.ErrUnavailable):
+		return "unavailable"
+	case errors.Is(err, datastore.ErrInternal):
+		return "internal"
+	}
+	return "error"
+}
+
+func (db *tracedDB) Close() error {
+	return db.db.Close()
+}
+
+func (db *tracedDB) IsBlocked(
+	ctx context.Context,
+	userId string,
+	blocked string,
+) (_ bool, err error) {
+	ctx, end := db.start(ctx, "IsBlocked")
+	defer func() { end(err) }()
+	return db.db.IsBlocked(ctx, userId, blocked)
+}
+
+func (db *tracedDB) GetProfile(
+	ctx context.Context,
+	userId string,
+) (_ *datastore.Profile, err error) {
+	ctx, end := db.start(ctx, "GetProfile")
+	defer func() { end(err) }()
+	return db.db.GetProfile(ctx, userId)
+}
+
+func (db *tracedDB) GetProfileByPhoneNumber(
+	ctx context.Context,
+	phoneNumber string,
+) (_ *datastore.Profile, err error) {
+	ctx, end := db.start(ctx, "GetProfileByPhoneNumber")
+	defer func() { end(err) }()
+	return db.db.GetProfileByPhoneNumber(ctx, phoneNumber)
+}
+
+func (db *tracedDB) GetProfileIdByPhoneNumber(
+	ctx context.Context,
+	phoneNumber string,
+) (_ string, err error) {
+	ctx, end := db.start(ctx, "GetProfileIdByPhoneNumber")
+	defer func() { end(err) }()
+	return db.db.GetProfileIdByPhoneNumber(ctx, phoneNumber)
+}
+
+func (db *tracedDB) GetProfilesByPhoneNumbers(
+	ctx context.Context,
+	phoneNumbers []string,
+) (_ map[string]*datastore.Profile, err error) {
+	ctx, end := db.start(ctx, "GetProfilesByPhoneNumbers")
+	defer func() { end(err) }()
+	return db.db.GetProfilesByPhoneNumbers(ctx, phoneNumbers)
+}
+
+func (db *tracedDB) AddProfile(
+	ctx context.Context,
+	p *datastore.Profile,
+) (_ string, err error) {
+	ctx, end := db.start(ctx, "AddProfile")
+	defer func() { end(err) }()
+	return db.db.AddProfile(ctx, p)
+}
+
+func (db *tracedDB) DeleteProfile(
+	ctx context.Context,
+	userId string,
+) (err error) {
+	ctx, end := db.start(ctx, "DeleteProfile")
+	defer func() { end(err) }()
+	return db.db.DeleteProfile(ctx, userId)
+}
+
+func (db *tracedDB) UpdateProfile(
+	ctx context.Context,
+	p *datastore.Profile,
+) (err error) {
+	ctx, end := db.start(ctx, "UpdateProfile")
+	defer func() { end(err) }()
+	return db.db.UpdateProfile(ctx, p)
+}
+
+func (db *tracedDB) RegenProfile(
+	ctx context.Context,
+	p *datastore.Profile,
+) (err error) {
+	ctx, end := db.start(ctx, "RegenProfile")
+	defer func() { end(err) }()
+	return db.db.RegenProfile(ctx, p)
+}
+
+func (db *tracedDB) RegisterDevice(
+	ctx context.Context,
+	userId string,
+	device datastore.Device,
+) (err error) {
+	ctx, end := db.start(ctx, "RegisterDevice")
+	defer func() { end(err) }()
+	return db.db.RegisterDevice(ctx, userId, device)
+}
+
+func (db *tracedDB) RemoveDeviceToken(
+	ctx context.Context,
+	userId string,
+	token string,
+) (err error) {
+	ctx, end := db.start(ctx, "RemoveDeviceToken")
+	defer func() { end(err) }()
+	return db.db.RemoveDeviceToken(ctx, userId, token)
+}
+
+func (db *tracedDB) AddMonetaryRequest(
+	ctx context.Context,
+	userId string,
+	transfer *datastore.MonetaryRequest,
+	path string,
+) (_ string, err error) {
+	ctx, end := db.start(ctx, "AddMonetaryRequest")
+	defer func() { end(err) }()
+	return db.db.AddMonetaryRequest(ctx, userId, transfer, path)
+}
+
+func (db *tracedDB) AddMonetaryRequestByFullPath(
+	ctx context.Context,
+	transfer *datastore.MonetaryRequest,
+	fullPath string,
+) (_ string, err error) {
+	ctx, end := db.start(ctx, "AddMonetaryRequestByFullPath")
+	defer func() { end(err) }()
+	return db.db.AddMonetaryRequestByFullPath(ctx, transfer, fullPath)
+}
+
+func (db *tracedDB) GetMonetaryRequestWithDate(
+	ctx context.Context,
+	userId string,
+	date time.Time,
+	snowflake string,
+) (_ *datastore.MonetaryRequest, err error) {
+	ctx, end := db.start(ctx, "GetMonetaryRequestWithDate")
+	defer func() { end(err) }()
+	return db.db.GetMonetaryRequestWithDate(ctx, userId, date, snowflake)
+}
+
+func (db *tracedDB) GetMonetaryRequestWithDateString(
+	ctx context.Context,
+	userId string,
+	date string,
+	snowflake string,
+) (_ *datastore.MonetaryRequest, err error) {
+	ctx, end := db.start(ctx, "GetMonetaryRequestWithDateString")
+	defer func() { end(err) }()
+	return db.db.GetMonetaryRequestWithDateString(ctx, userId, date, snowflake)
+}
+
+func (db *tracedDB) GetMonetaryRequestsDate(
+	ctx context.Context,
+	userId string,
+	dateBefore time.Time,
+) (_ []*datastore.MonetaryRequest, err error) {
+	ctx, end := db.start(ctx, "GetMonetaryRequestsDate")
+	defer func() { end(err) }()
+	return db.db.GetMonetaryRequestsDate(ctx, userId, dateBefore)
+}
+
+func (db *tracedDB) GetMonetaryRequestsInterval(
+	ctx context.Context,
+	userId string,
+	dateAfter time.Time,
+	dateBefore time.Time,
+) (_ []*datastore.MonetaryRequest, err error) {
+	ctx, end := db.start(ctx, "GetMonetaryRequestsInterval")
+	defer func() { end(err) }()
+	return db.db.GetMonetaryRequestsInterval(ctx, userId, dateAfter, dateBefore)
+}
+
+func (db *tracedDB) GetMonetaryRequestsFromGroup(
+	ctx context.Context,
+	userId string,
+	groupId string,
+) (_ []*datastore.MonetaryRequest, err error) {
+	ctx, end := db.start(ctx, "GetMonetaryRequestsFromGroup")
+	defer func() { end(err) }()
+	return db.db.GetMonetaryRequestsFromGroup(ctx, userId, groupId)
+}
+
+func (db *tracedDB) GetMonetaryRequestsRecurrent(
+	ctx context.Context,
+	userId string,
+	recurrentId int64,
+) (_ []*datastore.MonetaryRequest, err error) {
+	ctx, end := db.start(ctx, "GetMonetaryRequestsRecurrent")
+	defer func() { end(err) }()
+	return db.db.GetMonetaryRequestsRecurrent(ctx, userId, recurrentId)
+}
+
+func (db *tracedDB) SetMonetaryRequest(
+	ctx context.Context,
+	userId string,
+	transfer *datastore.MonetaryRequest,
+	path string,
+) (_ string, err error) {
+	ctx, end := db.start(ctx, "SetMonetaryRequest")
+	defer func() { end(err) }()
+	return db.db.SetMonetaryRequest(ctx, userId, transfer, path)
+}
+
+func (db *tracedDB) SetMonetaryRequestByFullPath(
+	ctx context.Context,
+	transfer *datastore.MonetaryRequest,
+	fullPath string,
+) (_ string, err error) {
+	ctx, end := db.start(ctx, "SetMonetaryRequestByFullPath")
+	defer func() { end(err) }()
+	return db.db.SetMonetaryRequestByFullPath(ctx, transfer, fullPath)
+}
+
+func (db *tracedDB) SetMonetaryRequests(
+	ctx context.Context,
+	userId string,
+	transfer []*datastore.MonetaryRequest,
+	path string,
+) (err error) {
+	ctx, end := db.start(ctx, "SetMonetaryRequests")
+	defer func() { end(err) }()
+	return db.db.SetMonetaryRequests(ctx, userId, transfer, path)
+}
+
+func (db *tracedDB) SetMonetaryRequestsByFullPath(
+	ctx context.Context,
+	transfer []*datastore.MonetaryRequest,
+	fullPath string,
+) (err error) {
+	ctx, end := db.start(ctx, "SetMonetaryRequestsByFullPath")
+	defer func() { end(err) }()
+	return db.db.SetMonetaryRequestsByFullPath(ctx, transfer, fullPath)
+}
+
+func (db *tracedDB) UpdateMonetaryRequestConfirmed(
+	ctx context.Context,
+	userId string,
+	confirmedFrom bool,
+	confirmedTo bool,
+	path string,
+	snowflake string,
+) (err error) {
+	ctx, end := db.start(ctx, "UpdateMonetaryRequestConfirmed")
+	defer func() { end(err) }()
+	return db.db.UpdateMonetaryRequestConfirmed(ctx, userId, confirmedFrom, confirmedTo, path, snowflake)
+}
+
+func (db *tracedDB) UpdateMonetaryRequestConfirmedByFullPath(
+	ctx context.Context,
+	confirmedFrom bool,
+	confirmedTo bool,
+	fullPath string,
+	snowflake string,
+) (err error) {
+	ctx, end := db.start(ctx, "UpdateMonetaryRequestConfirmedByFullPath")
+	defer func() { end(err) }()
+	return db.db.UpdateMonetaryRequestConfirmedByFullPath(ctx, confirmedFrom, confirmedTo, fullPath, snowflake)
+}
+
+func (db *tracedDB) SetMonetaryRequestByFullPathWithOutbox(
+	ctx context.Context,
+	transfer *datastore.MonetaryRequest,
+	fullPath string,
+	outbox []*datastore.Notification,
+) (_ string, err error) {
+	ctx, end := db.start(ctx, "SetMonetaryRequestByFullPathWithOutbox")
+	defer func() { end(err) }()
+	return db.db.SetMonetaryRequestByFullPathWithOutbox(ctx, transfer, fullPath, outbox)
+}
+
+func (db *tracedDB) UpdateMonetaryRequestConfirmedByFullPathWithOutbox(
+	ctx context.Context,
+	confirmedFrom bool,
+	confirmedTo bool,
+	fullPath string,
+	snowflake string,
+	outbox []*datastore.Notification,
+) (err error) {
+	ctx, end := db.start(ctx, "UpdateMonetaryRequestConfirmedByFullPathWithOutbox")
+	defer func() { end(err) }()
+	return db.db.UpdateMonetaryRequestConfirmedByFullPathWithOutbox(ctx, confirmedFrom, confirmedTo, fullPath, snowflake, outbox)
+}
+
+func (db *tracedDB) ListMonetaryRequestOwners(
+	ctx context.Context,
+	root string,
+) (_ []string, err error) {
+	ctx, end := db.start(ctx, "ListMonetaryRequestOwners")
+	defer func() { end(err) }()
+	return db.db.ListMonetaryRequestOwners(ctx, root)
+}
+
+func (db *tracedDB) ListMonetaryRequests(
+	ctx context.Context,
+	root string,
+	userId string,
+) (_ []*datastore.StoredMonetaryRequest, err error) {
+	ctx, end := db.start(ctx, "ListMonetaryRequests")
+	defer func() { end(err) }()
+	return db.db.ListMonetaryRequests(ctx, root, userId)
+}
+
+func (db *tracedDB) DeleteMonetaryRequestByFullPath(
+	ctx context.Context,
+	fullPath string,
+	snowflake string,
+) (err error) {
+	ctx, end := db.start(ctx, "DeleteMonetaryRequestByFullPath")
+	defer func() { end(err) }()
+	return db.db.DeleteMonetaryRequestByFullPath(ctx, fullPath, snowflake)
+}
+
+func (db *tracedDB) MoveMonetaryRequest(
+	ctx context.Context,
+	fromPath string,
+	toPath string,
+	snowflake string,
+) (_ bool, err error) {
+	ctx, end := db.start(ctx, "MoveMonetaryRequest")
+	defer func() { end(err) }()
+	return db.db.MoveMonetaryRequest(ctx, fromPath, toPath, snowflake)
+}
+
+func (db *tracedDB) SetMirroredMonetaryRequest(
+	ctx context.Context,
+	transfer *datastore.MonetaryRequest,
+	creditorPath string,
+	debtorPath string,
+	outbox []*datastore.Notification,
+) (err error) {
+	ctx, end := db.start(ctx, "SetMirroredMonetaryRequest")
+	defer func() { end(err) }()
+	return db.db.SetMirroredMonetaryRequest(ctx, transfer, creditorPath, debtorPath, outbox)
+}
+
+func (db *tracedDB) ConfirmMirroredMonetaryRequest(
+	ctx context.Context,
+	confirmedFrom bool,
+	confirmedTo bool,
+	creditorPath string,
+	debtorPath string,
+	snowflake string,
+	outbox []*datastore.Notification,
+) (err error) {
+	ctx, end := db.start(ctx, "ConfirmMirroredMonetaryRequest")
+	defer func() { end(err) }()
+	return db.db.ConfirmMirroredMonetaryRequest(ctx, confirmedFrom, confirmedTo, creditorPath, debtorPath, snowflake, outbox)
+}
+
+func (db *tracedDB) SetDivisionReport(
+	ctx context.Context,
+	fullPath string,
+	snowflake string,
+	report *datastore.DivisionReport,
+) (err error) {
+	ctx, end := db.start(ctx, "SetDivisionReport")
+	defer func() { end(err) }()
+	return db.db.SetDivisionReport(ctx, fullPath, snowflake, report)
+}
+
+func (db *tracedDB) GetDivisionReport(
+	ctx context.Context,
+	fullPath string,
+	snowflake string,
+) (_ *datastore.DivisionReport, err error) {
+	ctx, end := db.start(ctx, "GetDivisionReport")
+	defer func() { end(err) }()
+	return db.db.GetDivisionReport(ctx, fullPath, snowflake)
+}
+
+func (db *tracedDB) AddGroup(
+	ctx context.Context,
+	g *datastore.Group,
+) (_ string, err error) {
+	ctx, end := db.start(ctx, "AddGroup")
+	defer func() { end(err) }()
+	return db.db.AddGroup(ctx, g)
+}
+
+func (db *tracedDB) GetGroup(
+	ctx context.Context,
+	groupId string,
+) (_ *datastore.Group, err error) {
+	ctx, end := db.start(ctx, "GetGroup")
+	defer func() { end(err) }()
+	return db.db.GetGroup(ctx, groupId)
+}
+
+func (db *tracedDB) UpdateGroup(
+	ctx context.Context,
+	g *datastore.Group,
+) (err error) {
+	ctx, end := db.start(ctx, "UpdateGroup")
+	defer func() { end(err) }()
+	return db.db.UpdateGroup(ctx, g)
+}
+
+func (db *tracedDB) DeleteGroup(
+	ctx context.Context,
+	groupId string,
+) (err error) {
+	ctx, end := db.start(ctx, "DeleteGroup")
+	defer func() { end(err) }()
+	return db.db.DeleteGroup(ctx, groupId)
+}
+
+func (db *tracedDB) ListGroups(
+	ctx context.Context,
+) (_ []*datastore.Group, err error) {
+	ctx, end := db.start(ctx, "ListGroups")
+	defer func() { end(err) }()
+	return db.db.ListGroups(ctx)
+}
+
+func (db *tracedDB) ListGroupsByMember(
+	ctx context.Context,
+	profileId string,
+) (_ []*datastore.Group, err error) {
+	ctx, end := db.start(ctx, "ListGroupsByMember")
+	defer func() { end(err) }()
+	return db.db.ListGroupsByMember(ctx, profileId)
+}
+
+func (db *tracedDB) AddNotifications(
+	ctx context.Context,
+	outbox []*datastore.Notification,
+) (err error) {
+	ctx, end := db.start(ctx, "AddNotifications")
+	defer func() { end(err) }()
+	return db.db.AddNotifications(ctx, outbox)
+}
+
+func (db *tracedDB) ClaimNotification(
+	ctx context.Context,
+	key string,
+	now time.Time,
+	lease time.Duration,
+) (_ *datastore.Notification, _ bool, err error) {
+	ctx, end := db.start(ctx, "ClaimNotification")
+	defer func() { end(err) }()
+	return db.db.ClaimNotification(ctx, key, now, lease)
+}
+
+func (db *tracedDB) UpdateNotification(
+	ctx context.Context,
+	n *datastore.Notification,
+) (err error) {
+	ctx, end := db.start(ctx, "UpdateNotification")
+	defer func() { end(err) }()
+	return db.db.UpdateNotification(ctx, n)
+}
+
+func (db *tracedDB) GetDueNotifications(
+	ctx context.Context,
+	now time.Time,
+	limit int,
+) (_ []*datastore.Notification, err error) {
+	ctx, end := db.start(ctx, "GetDueNotifications")
+	defer func() { end(err) }()
+	return db.db.GetDueNotifications(ctx, now, limit)
+}
+
+func (db *tracedDB) IsEventProcessed(
+	ctx context.Context,
+	key string,
+	now time.Time,
+) (_ bool, err error) {
+	ctx, end := db.start(ctx, "IsEventProcessed")
+	defer func() { end(err) }()
+	return db.db.IsEventProcessed(ctx, key, now)
+}
+
+func (db *tracedDB) MarkEventProcessed(
+	ctx context.Context,
+	event *datastore.ProcessedEvent,
+) (err error) {
+	ctx, end := db.start(ctx, "MarkEventProcessed")
+	defer func() { end(err) }()
+	return db.db.MarkEventProcessed(ctx, event)
+}
+
+func (db *tracedDB) GetDeadLetter(
+	ctx context.Context,
+	id string,
+) (_ *datastore.DeadLetter, err error) {
+	ctx, end := db.start(ctx, "GetDeadLetter")
+	defer func() { end(err) }()
+	return db.db.GetDeadLetter(ctx, id)
+}
+
+func (db *tracedDB) SetDeadLetter(
+	ctx context.Context,
+	letter *datastore.DeadLetter,
+) (err error) {
+	ctx, end := db.start(ctx, "SetDeadLetter")
+	defer func() { end(err) }()
+	return db.db.SetDeadLetter(ctx, letter)
+}
+
+func (db *tracedDB) ListDeadLetters(
+	ctx context.Context,
+	status string,
+) (_ []*datastore.DeadLetter, err error) {
+	ctx, end := db.start(ctx, "ListDeadLetters")
+	defer func() { end(err) }()
+	return db.db.ListDeadLetters(ctx, status)
+}
+
+func (db *tracedDB) AddDelivery(
+	ctx context.Context,
+	delivery *datastore.Delivery,
+) (err error) {
+	ctx, end := db.start(ctx, "AddDelivery")
+	defer func() { end(err) }()
+	return db.db.AddDelivery(ctx, delivery)
+}
+
+func (db *tracedDB) GetDeliveriesForRequest(
+	ctx context.Context,
+	snowflake string,
+) (_ []*datastore.Delivery, err error) {
+	ctx, end := db.start(ctx, "GetDeliveriesForRequest")
+	defer func() { end(err) }()
+	return db.db.GetDeliveriesForRequest(ctx, snowflake)
+}
+
+func (db *tracedDB) ReplacePhoneNumberInRequests(
+	ctx context.Context,
+	userId string,
+	oldPhone string,
+	newPhone string,
+) (_ []*datastore.MonetaryRequest, err error) {
+	ctx, end := db.start(ctx, "ReplacePhoneNumberInRequests")
+	defer func() { end(err) }()
+	return db.db.ReplacePhoneNumberInRequests(ctx, userId, oldPhone, newPhone)
+}
@@ -0,0 +1,229 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics of the backend.
+var (
+	RequestsCreated = NewCounter(
+		"giveme.requests.created",
+		"Requests written for their debtors.",
+		"{request}",
+	)
+	Confirmations = NewCounter(
+		"giveme.confirmations",
+		"Confirmations applied to requests.",
+		"{confirmation}",
+	)
+	DivisionFanOut = NewHistogram(
+		"giveme.division.fanout",
+		"Members a group request is divided among.",
+		"{member}",
+		[]float64{1, 2, 3, 5, 8, 13, 21, 50},
+	)
+	NotificationFailures = NewCounter(
+		"giveme.notifications.failed",
+		"Pushes the messaging service did not accept.",
+		"{notification}",
+	)
+	// Latency is timed per method, of handlers, of the datastore
+	// and of the notifier.
+	Latency = NewHistogram(
+		"giveme.method.latency",
+		"Latency of handlers, datastore and notifier methods.",
+		"ms",
+		[]float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000},
+	)
+)
+
+// Metric is a snapshot of a counter or a histogram, cumulative
+// since Start, one Point per set of attributes recorded with.
+type Metric struct {
+	Name        string
+	Description string
+	Unit        string
+	// Histogram tells histograms, with their Bounds, from counters.
+	Histogram bool
+	Bounds    []float64
+	Start     time.Time
+	Time      time.Time
+	Points    []*Point
+}
+
+// Point is the aggregate of a metric for one set of attributes.
+type Point struct {
+	Attributes []Attribute
+	// Value is the total of a counter.
+	Value int64
+	// Count, Sum and Buckets aggregate a histogram, Buckets[i]
+	// counting the values up to Bounds[i], the last one the rest.
+	Count   int64
+	Sum     float64
+	Buckets []int64
+}
+
+// Point finds the point recorded with exactly attrs, nil if none was.
+func (m *Metric) Point(attrs ...Attribute) *Point {
+	key := attributesKey(attrs)
+	for _, p := range m.Points {
+		if attributesKey(p.Attributes) == key {
+			return p
+		}
+	}
+	return nil
+}
+
+var metrics = struct {
+	sync.Mutex
+	start       time.Time
+	instruments []*instrument
+}{start: time.Now()}
+
+// instrument aggregates a metric as it is recorded.
+type instrument struct {
+	metric Metric
+	points map[string]*Point
+}
+
+func register(metric Metric) *instrument {
+	metrics.Lock()
+	defer metrics.Unlock()
+	i := &instrument{metric: metric, points: map[string]*Point{}}
+	metrics.instruments = append(metrics.instruments, i)
+	return i
+}
+
+// point is the point of attrs, caller must hold the metrics lock.
+func (i *instrument) point(attrs []Attribute) *Point {
+	key := attributesKey(attrs)
+	p, ok := i.points[key]
+	if !ok {
+		p = &Point{Attributes: sortedAttributes(attrs)}
+		if i.metric.Histogram {
+			p.Buckets = make([]int64, len(i.metric.Bounds)+1)
+		}
+		i.points[key] = p
+	}
+	return p
+}
+
+// Counter is a monotonic sum.
+type Counter struct {
+	i *instrument
+}
+
+// NewCounter registers a counter, to be exported with every other.
+func NewCounter(
+	name string,
+	description string,
+	unit string,
+) *Counter {
+	return &Counter{i: register(Metric{
+		Name:        name,
+		Description: description,
+		Unit:        unit,
+	})}
+}
+
+// Add adds n, which must not be negative, to the count of attrs.
+func (c *Counter) Add(
+	ctx context.Context,
+	n int64,
+	attrs ...Attribute,
+) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	c.i.point(attrs).Value += n
+}
+
+// Histogram counts values into buckets.
+type Histogram struct {
+	i *instrument
+}
+
+// NewHistogram registers a histogram with the upper bounds of its
+// buckets, in increasing order, to be exported with every other metric.
+func NewHistogram(
+	name string,
+	description string,
+	unit string,
+	bounds []float64,
+) *Histogram {
+	return &Histogram{i: register(Metric{
+		Name:        name,
+		Description: description,
+		Unit:        unit,
+		Histogram:   true,
+		Bounds:      bounds,
+	})}
+}
+
+// Record counts v for attrs.
+func (h *Histogram) Record(
+	ctx context.Context,
+	v float64,
+	attrs ...Attribute,
+) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	p := h.i.point(attrs)
+	p.Count++
+	p.Sum += v
+	p.Buckets[sort.SearchFloat64s(h.i.metric.Bounds, v)]++
+}
+
+// Since records the milliseconds elapsed since start.
+func (h *Histogram) Since(
+	ctx context.Context,
+	start time.Time,
+	attrs ...Attribute,
+) {
+	h.Record(ctx, float64(time.Since(start))/float64(time.Millisecond), attrs...)
+}
+
+// Snapshot copies every metric recorded so far.
+func Snapshot() []*Metric {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	now := time.Now()
+	snapshot := make([]*Metric, 0, len(metrics.instruments))
+	for _, i := range metrics.instruments {
+		m := i.metric
+		m.Start = metrics.start
+		m.Time = now
+		m.Points = make([]*Point, 0, len(i.points))
+		for _, p := range i.points {
+			copied := *p
+			copied.Buckets = append([]int64(nil), p.Buckets...)
+			m.Points = append(m.Points, &copied)
+		}
+		sort.Slice(m.Points, func(a, b int) bool {
+			return attributesKey(m.Points[a].Attributes) < attributesKey(m.Points[b].Attributes)
+		})
+		snapshot = append(snapshot, &m)
+	}
+	return snapshot
+}
+
+func sortedAttributes(attrs []Attribute) []Attribute {
+	sorted := append([]Attribute(nil), attrs...)
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a].Key < sorted[b].Key
+	})
+	return sorted
+}
+
+func attributesKey(attrs []Attribute) string {
+	var key strings.Builder
+	for _, a := range sortedAttributes(attrs) {
+		fmt.Fprintf(&key, "%s=%v\x00", a.Key, a.Value)
+	}
+	return key.String()
+}
@@ -0,0 +1,74 @@
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	fcm "firebase.google.com/go/messaging"
+
+	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
+)
+
+// tracedNotifier traces, times and counts the failures
+// of the sends of the notifier it wraps.
+type tracedNotifier struct {
+	n messaging.Notifier
+}
+
+// Notifier wraps n so every send is a span of the calling trace,
+// timed into Latency and counted into NotificationFailures if it fails.
+func Notifier(n messaging.Notifier) messaging.Notifier {
+	return &tracedNotifier{n: n}
+}
+
+func (n *tracedNotifier) Send(
+	ctx context.Context,
+	message *fcm.Message,
+) (string, error) {
+	const name = "notifier.Send"
+	action := message.Data["action"]
+	start := time.Now()
+	ctx, span := Start(ctx, name, Attr("action", action))
+
+	id, err := n.n.Send(ctx, message)
+	span.End(err)
+	Latency.Since(ctx, start, Attr("method", name), Attr("outcome", Outcome(err)))
+	if err != nil {
+		NotificationFailures.Add(
+			ctx,
+			1,
+			Attr("action", action),
+			Attr("unregistered", fcm.IsRegistrationTokenNotRegistered(err)),
+		)
+	}
+	return id, err
+}
+
+func (n *tracedNotifier) SendMulticast(
+	ctx context.Context,
+	message *fcm.MulticastMessage,
+) (*fcm.BatchResponse, error) {
+	const name = "notifier.SendMulticast"
+	action := message.Data["action"]
+	start := time.Now()
+	ctx, span := Start(ctx, name, Attr("action", action), Attr("tokens", len(message.Tokens)))
+
+	batch, err := n.n.SendMulticast(ctx, message)
+	span.End(err)
+	Latency.Since(ctx, start, Attr("method", name), Attr("outcome", Outcome(err)))
+	if err != nil {
+		NotificationFailures.Add(ctx, int64(len(message.Tokens)), Attr("action", action), Attr("unregistered", false))
+		return batch, err
+	}
+	for _, r := range batch.Responses {
+		if r.Error != nil {
+			NotificationFailures.Add(
+				ctx,
+				1,
+				Attr("action", action),
+				Attr("unregistered", fcm.IsRegistrationTokenNotRegistered(r.Error)),
+			)
+		}
+	}
+	return batch, nil
+}
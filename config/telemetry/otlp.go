@@ -0,0 +1,281 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment the OTLP exporter is configured from,
+// as every OpenTelemetry SDK reads it.
+const (
+	EndpointEnv    = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	HeadersEnv     = "OTEL_EXPORTER_OTLP_HEADERS"
+	ServiceNameEnv = "OTEL_SERVICE_NAME"
+)
+
+// scope names the instrumentation in what is exported.
+const scope = "github.com/Seriyin/GiveMeBackend/config/telemetry"
+
+// OTLPExporter exports to an OpenTelemetry collector over OTLP/HTTP,
+// in its JSON encoding.
+type OTLPExporter struct {
+	// Endpoint is the base URL, /v1/traces and /v1/metrics are
+	// posted to under it.
+	Endpoint string
+	// Headers are sent with every export, for authentication.
+	Headers map[string]string
+	// Resource describes what is being observed,
+	// service.name at least.
+	Resource []Attribute
+	Client   *http.Client
+}
+
+// NewOTLPExporter exports to endpoint as the service named service,
+// this process being one instance of it.
+func NewOTLPExporter(
+	endpoint string,
+	service string,
+) *OTLPExporter {
+	return &OTLPExporter{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Headers:  map[string]string{},
+		Resource: []Attribute{
+			Attr("service.name", service),
+			Attr("service.instance.id", newId(8)),
+		},
+		Client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// ExporterFromEnv is the OTLPExporter the environment configures,
+// nil if it sets no endpoint.
+func ExporterFromEnv() *OTLPExporter {
+	endpoint := os.Getenv(EndpointEnv)
+	if endpoint == "" {
+		return nil
+	}
+	service := os.Getenv(ServiceNameEnv)
+	for _, env := range []string{"K_SERVICE", "FUNCTION_TARGET"} {
+		if service == "" {
+			service = os.Getenv(env)
+		}
+	}
+	if service == "" {
+		service = "givemebackend"
+	}
+	e := NewOTLPExporter(endpoint, service)
+	// Headers are key=value pairs separated by commas, values escaped.
+	for _, pair := range strings.Split(os.Getenv(HeadersEnv), ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value, err := url.QueryUnescape(strings.TrimSpace(kv[1]))
+		if err != nil {
+			value = strings.TrimSpace(kv[1])
+		}
+		e.Headers[strings.TrimSpace(kv[0])] = value
+	}
+	return e
+}
+
+func (e *OTLPExporter) ExportSpans(
+	ctx context.Context,
+	spans []*Span,
+) error {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceId:           s.TraceId,
+			SpanId:            s.SpanId,
+			ParentSpanId:      s.ParentId,
+			Name:              s.Name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: nanos(s.StartTime),
+			EndTimeUnixNano:   nanos(s.EndTime),
+			Attributes:        encodeAttributes(s.Attributes),
+			Status:            otlpStatus{Code: statusOk},
+		}
+		if s.Error != "" {
+			span.Status = otlpStatus{Code: statusError, Message: s.Error}
+		}
+		encoded = append(encoded, span)
+	}
+	return e.post(ctx, "/v1/traces", map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": encodeAttributes(e.Resource),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": scope},
+				"spans": encoded,
+			}},
+		}},
+	})
+}
+
+func (e *OTLPExporter) ExportMetrics(
+	ctx context.Context,
+	metrics []*Metric,
+) error {
+	encoded := make([]map[string]interface{}, 0, len(metrics))
+	for _, m := range metrics {
+		if len(m.Points) == 0 {
+			continue
+		}
+		points := make([]map[string]interface{}, 0, len(m.Points))
+		for _, p := range m.Points {
+			point := map[string]interface{}{
+				"attributes":        encodeAttributes(p.Attributes),
+				"startTimeUnixNano": nanos(m.Start),
+				"timeUnixNano":      nanos(m.Time),
+			}
+			if m.Histogram {
+				buckets := make([]string, len(p.Buckets))
+				for i, b := range p.Buckets {
+					buckets[i] = strconv.FormatInt(b, 10)
+				}
+				point["count"] = strconv.FormatInt(p.Count, 10)
+				point["sum"] = p.Sum
+				point["bucketCounts"] = buckets
+				point["explicitBounds"] = m.Bounds
+			} else {
+				point["asInt"] = strconv.FormatInt(p.Value, 10)
+			}
+			points = append(points, point)
+		}
+		metric := map[string]interface{}{
+			"name":        m.Name,
+			"description": m.Description,
+			"unit":        m.Unit,
+		}
+		if m.Histogram {
+			metric["histogram"] = map[string]interface{}{
+				"dataPoints":             points,
+				"aggregationTemporality": temporalityCumulative,
+			}
+		} else {
+			metric["sum"] = map[string]interface{}{
+				"dataPoints":             points,
+				"aggregationTemporality": temporalityCumulative,
+				"isMonotonic":            true,
+			}
+		}
+		encoded = append(encoded, metric)
+	}
+	if len(encoded) == 0 {
+		return nil
+	}
+	return e.post(ctx, "/v1/metrics", map[string]interface{}{
+		"resourceMetrics": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": encodeAttributes(e.Resource),
+			},
+			"scopeMetrics": []interface{}{map[string]interface{}{
+				"scope":   map[string]string{"name": scope},
+				"metrics": encoded,
+			}},
+		}},
+	})
+}
+
+func (e *OTLPExporter) post(
+	ctx context.Context,
+	path string,
+	body interface{},
+) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("telemetry: could not encode export: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, e.Endpoint+path, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("telemetry: %v", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("telemetry: could not export to %v: %v", path, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("telemetry: exporting to %v: %v", path, resp.Status)
+	}
+	return nil
+}
+
+// OTLP enumerations and messages, as the JSON encoding spells them.
+const (
+	spanKindInternal      = 1
+	statusOk              = 1
+	statusError           = 2
+	temporalityCumulative = 2
+)
+
+type otlpSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	ParentSpanId      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func encodeAttributes(attrs []Attribute) []otlpAttribute {
+	encoded := make([]otlpAttribute, 0, len(attrs))
+	for _, a := range attrs {
+		var value map[string]interface{}
+		switch v := a.Value.(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": v}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		encoded = append(encoded, otlpAttribute{Key: a.Key, Value: value})
+	}
+	return encoded
+}
+
+func nanos(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
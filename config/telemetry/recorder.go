@@ -0,0 +1,74 @@
+package telemetry
+
+import (
+	"context"
+	"sync"
+)
+
+// Ensure both exporters conform to the Exporter interface.
+var (
+	_ Exporter = &Recorder{}
+	_ Exporter = &OTLPExporter{}
+)
+
+// Recorder is an in-process Exporter for tests,
+// keeping every span and the last metrics it was handed.
+type Recorder struct {
+	mutex   sync.Mutex
+	spans   []*Span
+	metrics []*Metric
+}
+
+func (r *Recorder) ExportSpans(
+	ctx context.Context,
+	spans []*Span,
+) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func (r *Recorder) ExportMetrics(
+	ctx context.Context,
+	metrics []*Metric,
+) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.metrics = metrics
+	return nil
+}
+
+// Spans returns a snapshot of the spans exported so far.
+func (r *Recorder) Spans() []*Span {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]*Span(nil), r.spans...)
+}
+
+// Span finds the first span exported named name, nil if none was.
+func (r *Recorder) Span(name string) *Span {
+	for _, s := range r.Spans() {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Metric finds the metric named name in the last export,
+// nil if there was none.
+func (r *Recorder) Metric(name string) *Metric {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, m := range r.metrics {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
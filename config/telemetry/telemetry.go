@@ -0,0 +1,157 @@
+// Package telemetry traces handlers, datastore calls and notification
+// sends, and keeps the metrics of the backend, exporting both to an
+// OpenTelemetry collector over OTLP/HTTP.
+//
+// Spans share the trace id logging correlates entries by, so traces
+// and logs of an event join up. Nothing is exported until an Exporter
+// is set, and then only on Flush: functions flush once per event,
+// as they may be frozen as soon as they return.
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/Seriyin/GiveMeBackend/config/logging"
+)
+
+// maxSpans bounds the spans buffered between flushes,
+// later ones are dropped.
+const maxSpans = 2048
+
+// Attribute describes a span or a metric point.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr makes an Attribute, value being a string, a bool,
+// an integer or a float.
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span is one timed operation of a trace.
+type Span struct {
+	Name       string
+	TraceId    string
+	SpanId     string
+	ParentId   string
+	StartTime  time.Time
+	EndTime    time.Time
+	Attributes []Attribute
+	// Error is the error the operation ended in, if any.
+	Error string
+
+	ended bool
+}
+
+// Exporter ships finished spans and metric snapshots.
+type Exporter interface {
+	ExportSpans(ctx context.Context, spans []*Span) error
+	ExportMetrics(ctx context.Context, metrics []*Metric) error
+}
+
+var state = struct {
+	sync.Mutex
+	exporter Exporter
+	spans    []*Span
+}{}
+
+// SetExporter sets where Flush exports to, nil to stop exporting.
+func SetExporter(e Exporter) {
+	state.Lock()
+	defer state.Unlock()
+	state.exporter = e
+	state.spans = nil
+}
+
+type spanKey struct{}
+
+// Start starts a span named name as a child of the span of ctx,
+// in the trace of ctx or a new one. The returned context carries
+// the span, and the trace for logging, until End is called.
+func Start(
+	ctx context.Context,
+	name string,
+	attrs ...Attribute,
+) (context.Context, *Span) {
+	span := &Span{
+		Name:       name,
+		TraceId:    logging.TraceId(ctx),
+		SpanId:     newId(8),
+		StartTime:  time.Now(),
+		Attributes: attrs,
+	}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok {
+		span.ParentId = parent.SpanId
+	}
+	if span.TraceId == "" {
+		span.TraceId = newId(16)
+		ctx = logging.WithTrace(ctx, span.TraceId)
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// End ends the span, failed if err is not nil,
+// and buffers it for the next Flush. Ending twice does nothing.
+func (s *Span) End(err error) {
+	state.Lock()
+	defer state.Unlock()
+	if s.ended {
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	if err != nil {
+		s.Error = err.Error()
+	}
+	if state.exporter != nil && len(state.spans) < maxSpans {
+		state.spans = append(state.spans, s)
+	}
+}
+
+// Handle runs h as the span named name, timed into Latency.
+func Handle(
+	ctx context.Context,
+	name string,
+	h func(ctx context.Context) error,
+) error {
+	start := time.Now()
+	ctx, span := Start(ctx, name)
+	err := h(ctx)
+	span.End(err)
+	Latency.Since(ctx, start, Attr("method", name), Attr("outcome", Outcome(err)))
+	return err
+}
+
+// Flush exports the spans ended since the last Flush and
+// a snapshot of every metric. Failures are logged, not returned,
+// telemetry never failing the work it observes.
+func Flush(ctx context.Context) {
+	state.Lock()
+	exporter, spans := state.exporter, state.spans
+	state.spans = nil
+	state.Unlock()
+	if exporter == nil {
+		return
+	}
+
+	if len(spans) > 0 {
+		if err := exporter.ExportSpans(ctx, spans); err != nil {
+			logging.Warning(ctx, "Could not export spans", "spans", len(spans), "error", err)
+		}
+	}
+	if err := exporter.ExportMetrics(ctx, Snapshot()); err != nil {
+		logging.Warning(ctx, "Could not export metrics", "error", err)
+	}
+}
+
+func newId(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
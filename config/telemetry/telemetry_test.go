@@ -0,0 +1,129 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	fcm "firebase.google.com/go/messaging"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
+	"github.com/Seriyin/GiveMeBackend/config/logging"
+)
+
+func TestSpansAndMetrics(t *testing.T) {
+	recorder := &Recorder{}
+	SetExporter(recorder)
+	defer SetExporter(nil)
+
+	ctx := logging.WithTrace(context.Background(), "4bf92f3577b34da6a3ce929d0e0e4736")
+	db := Database(datastore.NewMemoryDB())
+	notifier := Notifier(&messaging.RecordingNotifier{
+		Fail: func(m *fcm.Message) error { return errors.New("unavailable") },
+	})
+	err := Handle(ctx, "handler.request", func(ctx context.Context) error {
+		if _, err := db.GetProfile(ctx, "a"); !errors.Is(err, datastore.ErrNotFound) {
+			t.Error(err)
+		}
+		_, err := notifier.Send(ctx, &fcm.Message{Data: map[string]string{"action": "request"}})
+		return err
+	})
+	if err == nil {
+		t.Fatal("send did not fail")
+	}
+	Flush(ctx)
+
+	handler := recorder.Span("handler.request")
+	get := recorder.Span("datastore.GetProfile")
+	send := recorder.Span("notifier.Send")
+	if handler == nil || get == nil || send == nil {
+		t.Fatalf("%+v", recorder.Spans())
+	}
+	if handler.TraceId != logging.TraceId(ctx) || get.TraceId != handler.TraceId {
+		t.Error("spans left the trace of the context", handler.TraceId, get.TraceId)
+	}
+	if get.ParentId != handler.SpanId || send.ParentId != handler.SpanId || handler.ParentId != "" {
+		t.Error("spans are not children of the handler", get.ParentId, send.ParentId, handler.SpanId)
+	}
+	if handler.Error != "unavailable" || get.Error == "" || handler.EndTime.Before(handler.StartTime) {
+		t.Errorf("%+v", handler)
+	}
+
+	latency := recorder.Metric(Latency.i.metric.Name)
+	p := latency.Point(Attr("method", "datastore.GetProfile"), Attr("outcome", "not_found"))
+	if p == nil || p.Count != 1 || len(p.Buckets) != len(latency.Bounds)+1 {
+		t.Errorf("%+v", latency.Points)
+	}
+	failures := recorder.Metric(NotificationFailures.i.metric.Name)
+	if p := failures.Point(Attr("action", "request"), Attr("unregistered", false)); p == nil || p.Value != 1 {
+		t.Errorf("%+v", failures.Points)
+	}
+
+	// Flushing again exports the spans no second time.
+	Flush(ctx)
+	if len(recorder.Spans()) != 3 {
+		t.Error(len(recorder.Spans()))
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	bodies := map[string]map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer k" || r.Header.Get("Content-Type") != "application/json" {
+			t.Error(r.Header)
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		var body map[string]interface{}
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Error(err)
+		}
+		bodies[r.URL.Path] = body
+	}))
+	defer server.Close()
+
+	e := NewOTLPExporter(server.URL+"/", "request")
+	e.Headers["Authorization"] = "Bearer k"
+	SetExporter(e)
+	defer SetExporter(nil)
+
+	ctx := context.Background()
+	counter := NewCounter("test.sent", "Sent in tests.", "{message}")
+	counter.Add(ctx, 2, Attr("action", "request"))
+	_, span := Start(ctx, "handler.request", Attr("attempt", 2))
+	span.End(errors.New("unavailable"))
+	Flush(ctx)
+
+	traces, metrics := bodies["/v1/traces"], bodies["/v1/metrics"]
+	if traces == nil || metrics == nil {
+		t.Fatal(bodies)
+	}
+	resource := traces["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	spans := resource["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	exported := spans[0].(map[string]interface{})
+	if exported["traceId"] != span.TraceId || exported["name"] != "handler.request" {
+		t.Errorf("%+v", exported)
+	}
+	if status := exported["status"].(map[string]interface{}); status["code"] != float64(statusError) || status["message"] != "unavailable" {
+		t.Errorf("%+v", status)
+	}
+
+	var sent map[string]interface{}
+	scope := metrics["resourceMetrics"].([]interface{})[0].(map[string]interface{})["scopeMetrics"].([]interface{})[0]
+	for _, m := range scope.(map[string]interface{})["metrics"].([]interface{}) {
+		if m.(map[string]interface{})["name"] == "test.sent" {
+			sent = m.(map[string]interface{})
+		}
+	}
+	if sent == nil {
+		t.Fatal(metrics)
+	}
+	point := sent["sum"].(map[string]interface{})["dataPoints"].([]interface{})[0].(map[string]interface{})
+	if point["asInt"] != "2" {
+		t.Errorf("%+v", point)
+	}
+}
@@ -0,0 +1,238 @@
+// Package trigger runs the Firestore handlers of the functions
+// whichever way they are invoked: as 1st gen background functions,
+// as 2nd gen functions receiving CloudEvents over HTTP, or from
+// a Pub/Sub message carrying the event as a command.
+package trigger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+	"github.com/Seriyin/GiveMeBackend/config/logging"
+	"github.com/Seriyin/GiveMeBackend/config/telemetry"
+)
+
+// CloudEvent types handled by Serve.
+const (
+	// FirestoreEventPrefix prefixes the created, updated,
+	// deleted and written document events.
+	FirestoreEventPrefix = "google.cloud.firestore.document.v1."
+	PubSubPublished      = "google.cloud.pubsub.topic.v1.messagePublished"
+)
+
+// Handler is the logic of a Firestore triggered function,
+// in the shape of a 1st gen background function.
+type Handler func(ctx context.Context, e firestore.Event) error
+
+// PubSubMessage is the payload of a Pub/Sub event.
+// Its data is a command, a firestore.Event as JSON.
+type PubSubMessage struct {
+	Data       []byte            `json:"data"`
+	Attributes map[string]string `json:"attributes"`
+	MessageId  string            `json:"messageId"`
+}
+
+// Rejecter keeps payload, received by a function that could not
+// decode an event from it, failing with err.
+type Rejecter func(ctx context.Context, payload []byte, err error) error
+
+// FromPubSub runs h on the command carried by m.
+// For 1st gen Pub/Sub functions, ctx already holds the event metadata.
+// Commands that do not decode are handed to reject and acknowledged,
+// unless reject fails.
+func FromPubSub(
+	ctx context.Context,
+	m PubSubMessage,
+	h Handler,
+	reject Rejecter,
+) error {
+	e, err := decodeCommand(m.Data)
+	if err != nil {
+		logging.Error(ctx, "Could not decode command", "error", err)
+		return reject(ctx, m.Data, err)
+	}
+	return Ack(ctx, h(ctx, e))
+}
+
+// Ack is what a function returns once its handler failed with err:
+// nil when delivering the event again cannot help, acknowledging it,
+// and err itself otherwise, so the platform retries.
+func Ack(
+	ctx context.Context,
+	err error,
+) error {
+	if err != nil && !datastore.Retryable(err) {
+		if errors.Is(err, datastore.ErrInternal) {
+			logging.Error(ctx, "Acknowledging failed event, a bug retries cannot fix", "error", err)
+		} else {
+			logging.Warning(ctx, "Acknowledging failed event, retries cannot help", "error", err)
+		}
+		return nil
+	}
+	return err
+}
+
+// Run runs fn as the whole of the deployed function name, for
+// those keeping no dead letters: failures retrying cannot fix are
+// acknowledged, not retried. The run is traced, and telemetry
+// flushed once it is over.
+func Run(
+	ctx context.Context,
+	name string,
+	fn func(ctx context.Context) error,
+) error {
+	defer telemetry.Flush(ctx)
+	return Ack(ctx, telemetry.Handle(ctx, "handler."+name, fn))
+}
+
+// Serve runs h on the CloudEvent in r, in binary or structured mode.
+// Retryable failures of h answer 500, so the event is redelivered,
+// the others are acknowledged as successes are. Requests that do not
+// decode are handed to reject and acknowledged too, redelivering them
+// cannot help, unless reject fails.
+func Serve(
+	w http.ResponseWriter,
+	r *http.Request,
+	h Handler,
+	reject Rejecter,
+) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logging.Error(r.Context(), "Could not read CloudEvent", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	ctx, e, err := Decode(r)
+	if err != nil {
+		logging.Error(r.Context(), "Could not decode CloudEvent", "error", err)
+		err = reject(r.Context(), body, err)
+	} else {
+		err = Ack(ctx, h(ctx, e))
+	}
+	if err != nil {
+		logging.Error(r.Context(), "Handler failed, event to be redelivered", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// cloudEvent holds the CloudEvents v1.0 attributes in use.
+type cloudEvent struct {
+	Id              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+	DataBase64      []byte          `json:"data_base64"`
+}
+
+// Decode reads the CloudEvent in r into a firestore.Event, returning
+// a context carrying its id as the event metadata, for idempotency,
+// and the trace of r, for logging.
+func Decode(
+	r *http.Request,
+) (context.Context, firestore.Event, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, firestore.Event{}, fmt.Errorf("trigger: could not read body: %v", err)
+	}
+
+	var ce cloudEvent
+	var data []byte
+	contentType := mediaType(r.Header.Get("Content-Type"))
+	if contentType == "application/cloudevents+json" {
+		if err := json.Unmarshal(body, &ce); err != nil {
+			return nil, firestore.Event{}, datastore.NewError(datastore.ErrInvalidEvent, "trigger: malformed structured CloudEvent: %v", err)
+		}
+		data = ce.DataBase64
+		if data == nil {
+			data = ce.Data
+		}
+	} else if id := r.Header.Get("Ce-Id"); id != "" {
+		ce = cloudEvent{
+			Id:              id,
+			Source:          r.Header.Get("Ce-Source"),
+			Type:            r.Header.Get("Ce-Type"),
+			Subject:         r.Header.Get("Ce-Subject"),
+			DataContentType: contentType,
+		}
+		ce.Time, _ = time.Parse(time.RFC3339Nano, r.Header.Get("Ce-Time"))
+		data = body
+	} else {
+		return nil, firestore.Event{}, datastore.NewError(datastore.ErrInvalidEvent, "trigger: request is not a CloudEvent")
+	}
+
+	var e firestore.Event
+	switch {
+	case strings.HasPrefix(ce.Type, FirestoreEventPrefix):
+		if mediaType(ce.DataContentType) == "application/protobuf" {
+			e, err = firestore.UnmarshalDocumentEventData(data)
+		} else {
+			// The JSON encoding of DocumentEventData is the legacy event.
+			err = json.Unmarshal(data, &e)
+		}
+	case ce.Type == PubSubPublished:
+		var published struct {
+			Message PubSubMessage `json:"message"`
+		}
+		err = json.Unmarshal(data, &published)
+		if err == nil {
+			e, err = decodeCommand(published.Message.Data)
+		}
+	default:
+		err = fmt.Errorf("unsupported type %q", ce.Type)
+	}
+	if err != nil {
+		return nil, firestore.Event{}, datastore.NewError(datastore.ErrInvalidEvent, "trigger: CloudEvent %v: %v", ce.Id, err)
+	}
+
+	ctx := metadata.NewContext(r.Context(), &metadata.Metadata{
+		EventID:   ce.Id,
+		Timestamp: ce.Time,
+		EventType: ce.Type,
+		Resource: &metadata.Resource{
+			Service: ce.Source,
+			Name:    ce.Subject,
+		},
+	})
+	if trace := logging.TraceFromHeader(r.Header); trace != "" {
+		ctx = logging.WithTrace(ctx, trace)
+	}
+	return ctx, e, nil
+}
+
+func decodeCommand(data []byte) (firestore.Event, error) {
+	var e firestore.Event
+	if err := json.Unmarshal(data, &e); err != nil {
+		return e, datastore.NewError(datastore.ErrInvalidEvent, "trigger: malformed command: %v", err)
+	}
+	if e.Value.Name == "" {
+		return e, datastore.NewError(datastore.ErrInvalidEvent, "trigger: command names no document")
+	}
+	return e, nil
+}
+
+func mediaType(contentType string) string {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return t
+}
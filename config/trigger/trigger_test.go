@@ -0,0 +1,171 @@
+package trigger
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cloud.google.com/go/functions/metadata"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+)
+
+const name = "projects/p/databases/(default)/documents/MonetaryRequests/a/2019-02/s1"
+
+const event = `{"value":{"name":"` + name + `","fields":{"confirmedTo":{"booleanValue":true}}},"updateMask":{"fieldPaths":["confirmedTo"]}}`
+
+// recorder is a Handler keeping what it was called with.
+type recorder struct {
+	id  string
+	e   firestore.Event
+	err error
+}
+
+func (r *recorder) handle(ctx context.Context, e firestore.Event) error {
+	if m, err := metadata.FromContext(ctx); err == nil {
+		r.id = m.EventID
+	}
+	r.e = e
+	return r.err
+}
+
+// rejected is a Rejecter keeping what it was handed.
+type rejected struct {
+	payload []byte
+	err     error
+	fail    error
+}
+
+func (r *rejected) reject(ctx context.Context, payload []byte, err error) error {
+	r.payload, r.err = payload, err
+	return r.fail
+}
+
+func TestServe(t *testing.T) {
+	pubsub := `{"message":{"data":"` + base64.StdEncoding.EncodeToString([]byte(event)) + `"},"subscription":"s"}`
+	for mode, req := range map[string]func() *http.Request{
+		"binary": func() *http.Request {
+			r := httptest.NewRequest("POST", "/", bytes.NewBufferString(event))
+			r.Header.Set("Content-Type", "application/json; charset=utf-8")
+			r.Header.Set("Ce-Id", "e1")
+			r.Header.Set("Ce-Type", FirestoreEventPrefix+"updated")
+			return r
+		},
+		"structured": func() *http.Request {
+			r := httptest.NewRequest("POST", "/", bytes.NewBufferString(
+				`{"specversion":"1.0","id":"e1","type":"`+FirestoreEventPrefix+`written","datacontenttype":"application/json","data":`+event+`}`,
+			))
+			r.Header.Set("Content-Type", "application/cloudevents+json")
+			return r
+		},
+		"pubsub": func() *http.Request {
+			r := httptest.NewRequest("POST", "/", bytes.NewBufferString(pubsub))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Ce-Id", "e1")
+			r.Header.Set("Ce-Type", PubSubPublished)
+			return r
+		},
+	} {
+		var rec recorder
+		var rej rejected
+		w := httptest.NewRecorder()
+		Serve(w, req(), rec.handle, rej.reject)
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%v: %v %v", mode, w.Code, w.Body)
+		}
+		if rec.id != "e1" || rec.e.Value.Name != name || len(rec.e.UpdateMask.FieldPaths) != 1 {
+			t.Errorf("%v: %+v", mode, rec)
+		}
+		if rej.err != nil {
+			t.Errorf("%v: rejected %v", mode, rej.err)
+		}
+	}
+}
+
+func TestServeFailures(t *testing.T) {
+	var rej rejected
+	rec := recorder{err: errors.New("transient")}
+	r := httptest.NewRequest("POST", "/", bytes.NewBufferString(event))
+	r.Header.Set("Ce-Id", "e1")
+	r.Header.Set("Ce-Type", FirestoreEventPrefix+"updated")
+	w := httptest.NewRecorder()
+	Serve(w, r, rec.handle, rej.reject)
+	if w.Code != http.StatusInternalServerError {
+		t.Error(w.Code)
+	}
+
+	// Permanent failures are acknowledged, not redelivered.
+	rec = recorder{err: fmt.Errorf("request: %w", datastore.NewError(datastore.ErrNotFound, "no debtor"))}
+	r = httptest.NewRequest("POST", "/", bytes.NewBufferString(event))
+	r.Header.Set("Ce-Id", "e1")
+	r.Header.Set("Ce-Type", FirestoreEventPrefix+"updated")
+	w = httptest.NewRecorder()
+	Serve(w, r, rec.handle, rej.reject)
+	if w.Code != http.StatusNoContent {
+		t.Error(w.Code)
+	}
+}
+
+func TestServeRejects(t *testing.T) {
+	for _, r := range []func() *http.Request{
+		func() *http.Request {
+			return httptest.NewRequest("POST", "/", bytes.NewBufferString(event))
+		},
+		func() *http.Request {
+			r := httptest.NewRequest("POST", "/", bytes.NewBufferString(event))
+			r.Header.Set("Ce-Id", "e1")
+			r.Header.Set("Ce-Type", "google.cloud.storage.object.v1.finalized")
+			return r
+		},
+		func() *http.Request {
+			r := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"specversion":`))
+			r.Header.Set("Content-Type", "application/cloudevents+json")
+			return r
+		},
+	} {
+		// Kept once and acknowledged, never run.
+		var rec recorder
+		var rej rejected
+		w := httptest.NewRecorder()
+		Serve(w, r(), rec.handle, rej.reject)
+		if w.Code != http.StatusNoContent || rec.e.Value.Name != "" {
+			t.Error(w.Code, rec)
+		}
+		if !errors.Is(rej.err, datastore.ErrInvalidEvent) || len(rej.payload) == 0 {
+			t.Errorf("%+v", rej)
+		}
+
+		// Redelivered when it cannot be kept.
+		rej = rejected{fail: errors.New("transient")}
+		w = httptest.NewRecorder()
+		Serve(w, r(), rec.handle, rej.reject)
+		if w.Code != http.StatusInternalServerError {
+			t.Error(w.Code)
+		}
+	}
+}
+
+func TestFromPubSub(t *testing.T) {
+	var rec recorder
+	var rej rejected
+	if err := FromPubSub(context.Background(), PubSubMessage{Data: []byte(event)}, rec.handle, rej.reject); err != nil || rec.e.Value.Name != name {
+		t.Error(rec, err)
+	}
+	rec = recorder{}
+	if err := FromPubSub(context.Background(), PubSubMessage{Data: []byte(`{}`)}, rec.handle, rej.reject); err != nil || rec.e.Value.Name != "" {
+		t.Error("ran a command naming no document")
+	}
+	if !errors.Is(rej.err, datastore.ErrInvalidEvent) || string(rej.payload) != `{}` {
+		t.Errorf("%+v", rej)
+	}
+	rec = recorder{err: errors.New("transient")}
+	if err := FromPubSub(context.Background(), PubSubMessage{Data: []byte(event)}, rec.handle, rej.reject); err != rec.err {
+		t.Error(err)
+	}
+}
@@ -2,30 +2,82 @@ package confirm
 
 import (
 	"context"
-	"log"
 
 	"github.com/Seriyin/GiveMeBackend/config/datastore"
-	"github.com/Seriyin/GiveMeBackend/config/firebase"
+	"github.com/Seriyin/GiveMeBackend/config/deadletter"
 	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
 	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
 	"github.com/Seriyin/GiveMeBackend/config/firebase/paths"
+	"github.com/Seriyin/GiveMeBackend/config/idempotency"
+	"github.com/Seriyin/GiveMeBackend/config/logging"
+	"github.com/Seriyin/GiveMeBackend/config/outbox"
+	"github.com/Seriyin/GiveMeBackend/config/services"
+	"github.com/Seriyin/GiveMeBackend/config/telemetry"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
 )
 
-var db = firebase.GetDB()
-var mesClient = firebase.GetMessaging()
+// Handler confirms both copies of a request together.
+type Handler struct {
+	DB datastore.GiveMeDatabase
+}
+
+// NewHandler builds a Handler over the services of c.
+func NewHandler(c *services.Container) (*Handler, error) {
+	db, err := c.DB()
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{DB: db}, nil
+}
 
-func Confirm(
+// NewTrigger builds the handler Confirm runs over the services of c.
+func NewTrigger(c *services.Container) (trigger.Handler, error) {
+	h, err := NewHandler(c)
+	if err != nil {
+		return nil, err
+	}
+	return h.Confirm, nil
+}
+
+// Confirm is the deployed entry point, over the default services.
+var Confirm = deadletter.Entry("confirm", NewTrigger)
+
+func (h *Handler) Confirm(
 	ctx context.Context,
 	e firestore.Event,
 ) error {
-	monetaryT, err :=
-		firestore.UnmarshallAndConvertMonetary(e.Value.Fields) // Json object to Monetary Structure
+	ctx = logging.ForEvent(ctx, "confirm", e.Value.Name)
+	return idempotency.Once(
+		ctx,
+		h.DB,
+		"confirm",
+		idempotency.DefaultTTL,
+		func(ctx context.Context) error {
+			return h.confirm(ctx, e)
+		},
+	)
+}
 
+func (h *Handler) confirm(
+	ctx context.Context,
+	e firestore.Event,
+) error {
+	var old datastore.MonetaryRequest
+	monetaryT := &datastore.MonetaryRequest{}
+	changes, err := e.Changes(&old, monetaryT) // Json objects to Monetary Structures
 	if err != nil {
 		return err
 	}
+	// The creditor confirming sets both flags, so confirmedTo turning
+	// true after confirmedFrom is that confirmation's mirror.
+	fromConfirmed := changes.Became("confirmedFrom", true)
+	toConfirmed := changes.Became("confirmedTo", true) && !old.ConfirmedFrom
+	if !fromConfirmed && !toConfirmed {
+		logging.Debug(ctx, "No confirmation changed", "changed", changes.Fields())
+		return nil
+	}
 
-	profile, err := db.GetProfileByPhoneNumber(
+	profile, err := h.DB.GetProfileByPhoneNumber(
 		ctx,
 		monetaryT.To,
 	)
@@ -33,95 +85,76 @@ func Confirm(
 		return err
 	}
 
-	snowflake, dbPath :=
-		paths.ExtractAndReplaceMethodIdAndDatePathWithSnowflake(
-			profile.Id,
-			e.Value.Name,
-		)
-
-	for _, a := range e.UpdateMask.FieldPaths {
-		if a == "confirmedFrom" {
-
-			err = db.UpdateMonetaryRequestConfirmedByFullPath(
-				ctx,
-				true, //ConfirmedFrom
-				true, //ConfirmedTo
-				dbPath,
-				snowflake,
-			)
-			if err != nil {
-				return err
-			}
-
-			err = produceAndSendFromNotification(
-				ctx,
-				profile,
-				monetaryT,
-			)
-			return err
-		} else if a == "confirmedTo" {
-			err = db.UpdateMonetaryRequestConfirmedByFullPath(
-				ctx,
-				false, //ConfirmedFrom
-				true,  //ConfirmedTo
-				dbPath,
-				snowflake,
-			)
-			if err != nil {
-				return err
-			}
-
-			err = produceAndSendToNotification(
-				ctx,
-				profile,
-				monetaryT,
-			)
-			return err
-		}
-	}
-	return err
-}
-
-func produceAndSendFromNotification(
-	ctx context.Context,
-	profile *datastore.Profile,
-	transfer *datastore.MonetaryRequest,
-) error {
-	//generate notification message
-	token := profile.Token
-	message := messaging.GenerateConfirmedFromNotification(
-		token,
-		transfer.AmountUnit,
-		transfer.AmountCents,
-		transfer.Currency,
-		transfer.From,
+	// Either party may confirm, so the event may be on either copy.
+	creditorId, err := h.DB.GetProfileIdByPhoneNumber(
+		ctx,
+		monetaryT.From,
 	)
-
-	str, err := mesClient.Send(ctx, message)
 	if err != nil {
-		log.Print(str)
+		return err
 	}
-	return err
-}
 
-func produceAndSendToNotification(
-	ctx context.Context,
-	profile *datastore.Profile,
-	transfer *datastore.MonetaryRequest,
-) error {
-	//generate notification message
-	token := profile.Token
-	message := messaging.GenerateConfirmedToNotification(
-		token,
-		transfer.AmountUnit,
-		transfer.AmountCents,
-		transfer.Currency,
-		transfer.To,
+	path, err := paths.Parse(e.Value.Name)
+	if err != nil {
+		return err
+	}
+	ctx = logging.WithUsers(ctx, creditorId, profile.Id)
+	snowflake := path.Snowflake
+	dbPath := path.WithOwner(profile.Id).Collection()
+	creditorPath := path.WithOwner(creditorId).Collection()
+	logging.Info(
+		ctx,
+		"Confirming request",
+		"snowflake", snowflake,
+		"byCreditor", fromConfirmed,
 	)
 
-	str, err := mesClient.Send(ctx, message)
+	// Only false to true transitions confirm, so rewrites of
+	// an already confirmed request, as by the mirror, do nothing.
+	if fromConfirmed {
+		// Both copies move together, so they cannot drift apart.
+		err = h.DB.ConfirmMirroredMonetaryRequest(
+			ctx,
+			true, //ConfirmedFrom
+			true, //ConfirmedTo
+			creditorPath,
+			dbPath,
+			snowflake,
+			[]*datastore.Notification{
+				outbox.New(
+					ctx,
+					messaging.ActionConfirmedFrom,
+					profile.Id,
+					monetaryT,
+					messaging.Link{Path: dbPath, Snowflake: snowflake},
+					monetaryT.From,
+				),
+			},
+		)
+	} else if toConfirmed {
+		// Both copies move together, so they cannot drift apart.
+		err = h.DB.ConfirmMirroredMonetaryRequest(
+			ctx,
+			false, //ConfirmedFrom
+			true,  //ConfirmedTo
+			creditorPath,
+			dbPath,
+			snowflake,
+			[]*datastore.Notification{
+				outbox.New(
+					ctx,
+					messaging.ActionConfirmedTo,
+					profile.Id,
+					monetaryT,
+					messaging.Link{Path: dbPath, Snowflake: snowflake},
+					monetaryT.To,
+				),
+			},
+		)
+	}
 	if err != nil {
-		log.Print(str)
+		return err
 	}
-	return err
+	telemetry.Confirmations.Add(ctx, 1, telemetry.Attr("byCreditor", fromConfirmed))
+	return nil
 }
@@ -0,0 +1,188 @@
+package confirm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/datastore/datastoretest"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/schema"
+)
+
+// setup stores both copies of a request from a to b.
+func setup(t *testing.T) (context.Context, datastore.GiveMeDatabase) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	datastoretest.AddProfiles(t, ctx, db,
+		datastore.UID{Id: "a", Phone: "+351111111111"},
+		datastore.UID{Id: "b", Phone: "+351222222222"},
+	)
+	err := db.SetMirroredMonetaryRequest(ctx, &datastore.MonetaryRequest{
+		From:        "+351111111111",
+		To:          "+351222222222",
+		Date:        time.Date(2019, 2, 13, 0, 0, 0, 0, time.UTC),
+		AmountUnit:  5,
+		Currency:    "€",
+		Snowflake:   "s1",
+		RecurrentId: -1,
+	}, "MonetaryRequests/a/2019-02", "MonetaryRequests/b/2019-02", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ctx, db
+}
+
+// event is an update of the copy of owner, from the old to the new flags.
+func event(
+	owner string,
+	oldFrom bool,
+	oldTo bool,
+	from bool,
+	to bool,
+) firestore.Event {
+	fields := func(from bool, to bool) []byte {
+		return []byte(fmt.Sprintf(`{
+			"from": {"stringValue": "+351111111111"},
+			"to": {"stringValue": "+351222222222"},
+			"amountUnit": {"integerValue": "5"},
+			"currency": {"stringValue": "€"},
+			"confirmedFrom": {"booleanValue": %v},
+			"confirmedTo": {"booleanValue": %v}
+		}`, from, to))
+	}
+	var e firestore.Event
+	e.OldValue.Fields = fields(oldFrom, oldTo)
+	e.Value.Name = "projects/p/databases/(default)/documents/MonetaryRequests/" + owner + "/2019-02/s1"
+	e.Value.Fields = fields(from, to)
+	return e
+}
+
+// confirmations are the flags of both copies, the creditor's first.
+func confirmations(
+	t *testing.T,
+	ctx context.Context,
+	db datastore.GiveMeDatabase,
+) [2][2]bool {
+	var flags [2][2]bool
+	for i, owner := range []string{"a", "b"} {
+		stored, err := db.ListMonetaryRequests(ctx, schema.MonetaryRequests, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stored) != 1 {
+			t.Fatalf("%v: %+v", owner, stored)
+		}
+		flags[i] = [2]bool{stored[0].Request.ConfirmedFrom, stored[0].Request.ConfirmedTo}
+	}
+	return flags
+}
+
+func TestConfirmsEitherCopy(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		owner string
+		from  bool
+		to    bool
+		want  [2]bool
+	}{
+		{"creditor on own copy", "a", true, false, [2]bool{true, true}},
+		{"creditor on debtor's copy", "b", true, false, [2]bool{true, true}},
+		{"debtor on own copy", "b", false, true, [2]bool{false, true}},
+		{"debtor on creditor's copy", "a", false, true, [2]bool{false, true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, db := setup(t)
+			h := &Handler{DB: db}
+			if err := h.Confirm(ctx, event(tc.owner, false, false, tc.from, tc.to)); err != nil {
+				t.Fatal(err)
+			}
+			if got := confirmations(t, ctx, db); got != [2][2]bool{tc.want, tc.want} {
+				t.Errorf("%v", got)
+			}
+		})
+	}
+}
+
+// actions are those of the notifications queued, sorted.
+func actions(
+	t *testing.T,
+	ctx context.Context,
+	db datastore.GiveMeDatabase,
+) []string {
+	due, err := db.GetDueNotifications(ctx, time.Now().Add(time.Hour), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, n := range due {
+		actions = append(actions, n.Action)
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+func TestNotifiesOncePerTransition(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		events []firestore.Event
+		want   []string
+	}{
+		{
+			"unrelated change",
+			[]firestore.Event{event("a", false, false, false, false)},
+			nil,
+		},
+		{
+			// The mirrored writes of both flags come back as events
+			// on both copies, which must not notify again.
+			"creditor confirms",
+			[]firestore.Event{
+				event("a", false, false, true, false),
+				event("a", true, false, true, true),
+				event("b", false, false, true, true),
+			},
+			[]string{messaging.ActionConfirmedFrom},
+		},
+		{
+			"debtor confirms",
+			[]firestore.Event{
+				event("b", false, false, false, true),
+				event("a", false, false, false, true),
+			},
+			[]string{messaging.ActionConfirmedTo},
+		},
+		{
+			"creditor confirms after debtor",
+			[]firestore.Event{
+				event("b", false, false, false, true),
+				event("a", false, true, true, true),
+				event("b", false, true, true, true),
+			},
+			[]string{messaging.ActionConfirmedFrom, messaging.ActionConfirmedTo},
+		},
+		{
+			"debtor unconfirms",
+			[]firestore.Event{event("b", false, true, false, false)},
+			nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, db := setup(t)
+			h := &Handler{DB: db}
+			for _, e := range tc.events {
+				if err := h.Confirm(ctx, e); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := actions(t, ctx, db); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package confirm
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Seriyin/GiveMeBackend/config/deadletter"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
+)
+
+// ConfirmHTTP is the entry point of Confirm on 2nd gen runtimes.
+func ConfirmHTTP(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	trigger.Serve(w, r, Confirm, deadletter.Reject("confirm"))
+}
+
+// ConfirmPubSub is the entry point of Confirm for commands sent through Pub/Sub.
+func ConfirmPubSub(
+	ctx context.Context,
+	m trigger.PubSubMessage,
+) error {
+	return trigger.FromPubSub(ctx, m, Confirm, deadletter.Reject("confirm"))
+}
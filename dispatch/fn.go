@@ -0,0 +1,89 @@
+package dispatch
+
+import (
+	"context"
+
+	"github.com/Seriyin/GiveMeBackend/config/deadletter"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/paths"
+	"github.com/Seriyin/GiveMeBackend/config/logging"
+	"github.com/Seriyin/GiveMeBackend/config/outbox"
+	"github.com/Seriyin/GiveMeBackend/config/services"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
+)
+
+// sweepLimit bounds how many notifications one sweep attempts.
+const sweepLimit = 200
+
+// Handler delivers the notifications of the outbox.
+type Handler struct {
+	Dispatcher *outbox.Dispatcher
+}
+
+// NewHandler builds a Handler over the services of c.
+func NewHandler(c *services.Container) (*Handler, error) {
+	db, err := c.DB()
+	if err != nil {
+		return nil, err
+	}
+	notifier, err := c.Notifier()
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{Dispatcher: outbox.NewDispatcher(db, notifier)}, nil
+}
+
+// PubSubMessage is the payload of a Pub/Sub event.
+type PubSubMessage struct {
+	Data []byte `json:"data"`
+}
+
+// NewTrigger builds the handler Dispatch runs over the services of c.
+func NewTrigger(c *services.Container) (trigger.Handler, error) {
+	h, err := NewHandler(c)
+	if err != nil {
+		return nil, err
+	}
+	return h.Dispatch, nil
+}
+
+// Dispatch is the deployed entry point, over the default services.
+var Dispatch = deadletter.Entry("dispatch", NewTrigger)
+
+// Sweep is the deployed entry point, over the default services.
+// A schedule tick is no event to dead-letter, the next one sweeps
+// again, and notifications failing for good die in the outbox.
+func Sweep(
+	ctx context.Context,
+	m PubSubMessage,
+) error {
+	h, err := NewHandler(services.Default())
+	if err != nil {
+		return err
+	}
+	return trigger.Run(ctx, "sweep", func(ctx context.Context) error {
+		return h.Sweep(ctx, m)
+	})
+}
+
+// Dispatch delivers a notification as soon as it lands in the outbox.
+func (h *Handler) Dispatch(
+	ctx context.Context,
+	e firestore.Event,
+) error {
+	ctx = logging.ForEvent(ctx, "dispatch", e.Value.Name)
+	key := paths.ExtractDocumentId(e.Value.Name)
+
+	logging.Debug(ctx, "Dispatching notification")
+	return h.Dispatcher.Dispatch(ctx, key)
+}
+
+// Sweep retries notifications whose backoff has elapsed.
+// Meant to run on a schedule through Pub/Sub.
+func (h *Handler) Sweep(
+	ctx context.Context,
+	m PubSubMessage,
+) error {
+	ctx = logging.ForEvent(ctx, "sweep", "")
+	return h.Dispatcher.DispatchDue(ctx, sweepLimit)
+}
@@ -0,0 +1,170 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	fcm "firebase.google.com/go/messaging"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/datastore/datastoretest"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/schema"
+	"github.com/Seriyin/GiveMeBackend/config/outbox"
+)
+
+// setup enqueues a request notification for b, who has a phone and a
+// tablet, dispatched at *now through notifier.
+func setup(
+	t *testing.T,
+	notifier messaging.Notifier,
+) (context.Context, datastore.GiveMeDatabase, *Handler, *datastore.Notification, *time.Time) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	now := time.Date(2019, 2, 13, 0, 0, 0, 0, time.UTC)
+	datastoretest.AddProfiles(t, ctx, db, datastore.UID{Id: "b", Phone: "+351222222222"})
+	for _, token := range []string{"phone", "tablet"} {
+		if err := db.RegisterDevice(ctx, "b", datastore.Device{Token: token, LastSeen: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	transfer := &datastore.MonetaryRequest{
+		From:       "+351111111111",
+		To:         "+351222222222",
+		AmountUnit: 5,
+		Currency:   "€",
+		Snowflake:  "s1",
+	}
+	link := messaging.Link{Path: "MonetaryRequests/b/2019-02", Snowflake: "s1"}
+	n := outbox.New(ctx, messaging.ActionRequest, "b", transfer, link, transfer.From)
+	n.NextAttempt = now
+	if err := db.AddNotifications(ctx, []*datastore.Notification{n}); err != nil {
+		t.Fatal(err)
+	}
+
+	d := outbox.NewDispatcher(db, notifier)
+	d.Now = func() time.Time { return now }
+	return ctx, db, &Handler{Dispatcher: d}, n, &now
+}
+
+// created is the event of n landing in the outbox.
+func created(n *datastore.Notification) firestore.Event {
+	var e firestore.Event
+	e.Value.Name = "projects/p/databases/(default)/documents/" + schema.Outbox + "/" + n.Key
+	return e
+}
+
+// tokens are those of the messages notifier sent.
+func tokens(notifier *messaging.RecordingNotifier) []string {
+	var tokens []string
+	for _, m := range notifier.Messages() {
+		tokens = append(tokens, m.Token)
+	}
+	return tokens
+}
+
+func TestRetriesFailedSends(t *testing.T) {
+	down := true
+	notifier := &messaging.RecordingNotifier{
+		Fail: func(m *fcm.Message) error {
+			if down {
+				return errors.New("unavailable")
+			}
+			return nil
+		},
+	}
+	ctx, db, h, n, now := setup(t, notifier)
+	if err := h.Dispatch(ctx, created(n)); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.Messages()) != 0 {
+		t.Fatal(notifier.Messages())
+	}
+
+	// Swept again only once the backoff elapsed.
+	down = false
+	if err := h.Sweep(ctx, PubSubMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.Messages()) != 0 {
+		t.Fatal(notifier.Messages())
+	}
+	*now = now.Add(h.Dispatcher.Backoff(1))
+	if err := h.Sweep(ctx, PubSubMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := tokens(notifier); len(got) != 2 {
+		t.Fatal(got)
+	}
+	due, err := db.GetDueNotifications(ctx, now.Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Errorf("%+v", due)
+	}
+}
+
+func TestKeepsOffLeasedNotifications(t *testing.T) {
+	notifier := &messaging.RecordingNotifier{}
+	ctx, db, h, n, now := setup(t, notifier)
+
+	// Another dispatcher holds the notification, and stops responding.
+	if _, ok, err := db.ClaimNotification(ctx, n.Key, *now, h.Dispatcher.Lease); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	*now = now.Add(h.Dispatcher.Lease - time.Second)
+	if err := h.Dispatch(ctx, created(n)); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Sweep(ctx, PubSubMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.Messages()) != 0 {
+		t.Fatal("delivered under another's lease", tokens(notifier))
+	}
+
+	*now = now.Add(time.Second)
+	if err := h.Sweep(ctx, PubSubMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := tokens(notifier); len(got) != 2 {
+		t.Error(got)
+	}
+}
+
+func TestSkipsSentTokens(t *testing.T) {
+	tabletDown := true
+	notifier := &messaging.RecordingNotifier{
+		Fail: func(m *fcm.Message) error {
+			if tabletDown && m.Token == "tablet" {
+				return errors.New("unavailable")
+			}
+			return nil
+		},
+	}
+	ctx, _, h, n, now := setup(t, notifier)
+	if err := h.Dispatch(ctx, created(n)); err != nil {
+		t.Fatal(err)
+	}
+	if got := tokens(notifier); len(got) != 1 || got[0] != "phone" {
+		t.Fatal(got)
+	}
+
+	tabletDown = false
+	*now = now.Add(h.Dispatcher.Backoff(1))
+	// The event redelivered and the sweep both find it due.
+	if err := h.Dispatch(ctx, created(n)); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Sweep(ctx, PubSubMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := tokens(notifier); len(got) != 2 || got[1] != "tablet" {
+		t.Error(got)
+	}
+}
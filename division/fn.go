@@ -2,177 +2,356 @@ package division
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"github.com/Seriyin/GiveMeBackend/config/datastore"
-	"github.com/Seriyin/GiveMeBackend/config/firebase"
+	"github.com/Seriyin/GiveMeBackend/config/deadletter"
 	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
 	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
 	"github.com/Seriyin/GiveMeBackend/config/firebase/paths"
-	"log"
-	"strconv"
-	"strings"
+	"github.com/Seriyin/GiveMeBackend/config/idempotency"
+	"github.com/Seriyin/GiveMeBackend/config/logging"
+	"github.com/Seriyin/GiveMeBackend/config/outbox"
+	"github.com/Seriyin/GiveMeBackend/config/services"
+	"github.com/Seriyin/GiveMeBackend/config/telemetry"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
+	"sync"
+	"time"
 )
 
-var db = firebase.GetDB()
-var mesClient = firebase.GetMessaging()
+// Handler splits group requests into requests per member.
+type Handler struct {
+	DB datastore.GiveMeDatabase
+}
+
+// NewHandler builds a Handler over the services of c.
+func NewHandler(c *services.Container) (*Handler, error) {
+	db, err := c.DB()
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{DB: db}, nil
+}
+
+// NewTrigger builds the handler Division runs over the services of c.
+func NewTrigger(c *services.Container) (trigger.Handler, error) {
+	h, err := NewHandler(c)
+	if err != nil {
+		return nil, err
+	}
+	return h.Division, nil
+}
+
+// Division is the deployed entry point, over the default services.
+var Division = deadletter.Entry("division", NewTrigger)
+
+func (h *Handler) Division(
+	ctx context.Context,
+	e firestore.Event,
+) error {
+	ctx = logging.ForEvent(ctx, "division", e.Value.Name)
+	return idempotency.Once(
+		ctx,
+		h.DB,
+		"division",
+		idempotency.DefaultTTL,
+		func(ctx context.Context) error {
+			return h.division(ctx, e)
+		},
+	)
+}
 
-func Division(
+func (h *Handler) division(
 	ctx context.Context,
 	e firestore.Event,
 ) error {
 	groupT, err :=
 		firestore.UnmarshallAndConvertGroup(e.Value.Fields) // Json object to Monetary Structure
+	if err != nil {
+		return err
+	}
 
-	log.Print("Attempted unmarshal")
+	groupPath, err := paths.Parse(e.Value.Name)
 	if err != nil {
 		return err
 	}
+	if groupT.Group != "" {
+		if err := h.resolveGroup(ctx, groupPath.UserId, groupT); err != nil {
+			return err
+		}
+	}
 
-	newAmountUnit, newAmountCents, err := calculateResultingAmounts(groupT)
+	requests, err := memberRequests(groupT, groupPath.Snowflake)
+	if err != nil {
+		// Redelivering the same group divides it no better.
+		return datastore.NewError(
+			datastore.ErrInvalidEvent,
+			"division: could not divide among %v: %v",
+			countMembers(groupT),
+			err,
+		)
+	}
 
-	log.Print("Attempted division")
+	monPath, err := groupPath.AsMonetary()
 	if err != nil {
 		return err
 	}
 
-	monPath := paths.TransformGroupIntoMonetary(e.Value.Name)
-
-	log.Printf("Transformed path: %v", monPath)
-	monetaryTs := extractIndividualTos(
+	ctx = logging.WithUsers(ctx, groupPath.UserId)
+	logging.Info(
+		ctx,
+		"Dividing group request",
+		"snowflake", groupPath.Snowflake,
+		"members", countMembers(groupT),
+		"payers", len(groupT.Payers),
+		"requests", len(requests),
+	)
+	telemetry.DivisionFanOut.Record(ctx, float64(len(requests)))
+	report, err := h.extractIndividualTos(
 		ctx,
 		monPath,
-		groupT,
-		newAmountUnit,
-		newAmountCents,
+		requests,
+		countMembers(groupT),
 	)
-
-	dbPath := paths.ExtractMethodIdAndDatePath(monPath)
-
-	log.Printf("Extracted db path: %v", dbPath)
-	err = db.SetMonetaryRequestsByFullPath(
+	if report == nil {
+		return err
+	}
+	logging.Info(
 		ctx,
-		monetaryTs,
-		dbPath,
+		"Divided group request",
+		"snowflake", groupPath.Snowflake,
+		"written", report.Written,
+		"pendingInvite", report.PendingInvite,
+		"failed", report.Failed,
 	)
-
+	// The creditor sees the report on the group request, rewritten
+	// by the retry of a partly failed division.
+	if reportErr := h.DB.SetDivisionReport(
+		ctx,
+		groupPath.Collection(),
+		groupPath.Snowflake,
+		report,
+	); reportErr != nil && err == nil {
+		err = reportErr
+	}
 	return err
 }
 
-func extractIndividualTos(
+// defaultCurrency is charged in when neither the group request
+// nor its group say otherwise.
+const defaultCurrency = "€"
+
+// resolveGroup fills in who groupT charges from the members of its
+// Group, every one but the creditor, and how it splits and in which
+// currency from the defaults of the group, unless groupT says.
+func (h *Handler) resolveGroup(
 	ctx context.Context,
-	networkPath string,
+	creditorId string,
 	groupT *datastore.GroupRequest,
-	newAmountUnit int64,
-	newAmountCents int64,
-) []*datastore.MonetaryRequest {
-	monetaryTs := make(
-		[]*datastore.MonetaryRequest,
-		len(groupT.Tos),
-	)
-
-	for _, to := range groupT.Tos {
-		m := &datastore.MonetaryRequest{
-			From:          groupT.From,
-			To:            to,
-			Desc:          groupT.Desc,
-			Date:          groupT.Date,
-			AmountUnit:    newAmountUnit,
-			AmountCents:   newAmountCents,
-			Currency:      "€", //missing from grouptransfer
-			ConfirmedFrom: false,
-			ConfirmedTo:   false,
-			GroupId:       groupT.GroupId,
-			RecurrentId:   -1,
+) error {
+	g, err := h.DB.GetGroup(ctx, groupT.Group)
+	if err != nil {
+		return err
+	}
+	if _, ok := g.Member(creditorId); !ok {
+		return datastore.NewError(
+			datastore.ErrInvalidEvent,
+			"division: creditor is not a member of group %v",
+			g.Id,
+		)
+	}
+	tos := make([]string, 0, len(g.Members))
+	for _, m := range g.Members {
+		if m.ProfileId == creditorId || (m.Phone != "" && m.Phone == groupT.From) {
+			continue
+		}
+		phone := m.Phone
+		if m.ProfileId != "" {
+			// Profiles are current, the member's phone may not be.
+			p, err := h.DB.GetProfile(ctx, m.ProfileId)
+			if err != nil {
+				return err
+			}
+			phone = p.Phone
 		}
-		monetaryTs = append(monetaryTs, m)
+		tos = append(tos, phone)
+	}
+	groupT.Tos = tos
+	if groupT.Currency == "" {
+		groupT.Currency = g.DefaultCurrency
+	}
+	if g.DefaultSplit == datastore.SplitEqualIncluded {
+		groupT.Included = true
+	}
+	return nil
+}
 
-		// If no profile can be gathered, the user may not exist.
-		// Either by network error or profile not existing, must skip.
-		profile, err := db.GetProfileByPhoneNumber(ctx, to)
-		if err == nil {
-			dbPath := paths.ExtractAndReplaceMethodIdAndDatePath(profile.Id, networkPath)
-
-			//Add has side-effects and assigns a LinkedId to monetary transfer which
-			//is the first return param.
-			_, err = db.AddMonetaryRequestByFullPath(ctx, m, dbPath)
-
-			if err == nil {
-				err = produceAndSendNotification(
-					ctx,
-					profile,
-					m,
-				)
-				if err != nil {
-					log.Print(err)
-				}
-			} else {
-				log.Print(err)
+// currency is what groupT charges in.
+func currency(groupT *datastore.GroupRequest) string {
+	if groupT.Currency != "" {
+		return groupT.Currency
+	}
+	return defaultCurrency
+}
+
+// fanOut bounds how many members are written at once.
+const fanOut = 8
+
+// extractIndividualTos writes the requests of a group request,
+// fanOut at a time, reporting each outcome in the order given.
+// Requests failing transiently fail the event once the rest are
+// written, the retry rewrites every one to the same documents.
+func (h *Handler) extractIndividualTos(
+	ctx context.Context,
+	monPath paths.RequestPath,
+	requests []*datastore.MonetaryRequest,
+	members int64,
+) (*datastore.DivisionReport, error) {
+	// Parties are resolved at once, those without a profile
+	// do not exist and have no copy of their own written.
+	var phones []string
+	seen := make(map[string]bool)
+	for _, m := range requests {
+		for _, phone := range []string{m.From, m.To} {
+			if !seen[phone] {
+				seen[phone] = true
+				phones = append(phones, phone)
 			}
+		}
+	}
+	profiles, err := h.DB.GetProfilesByPhoneNumbers(ctx, phones)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]datastore.MemberResult, len(requests))
+	failures := make([]error, len(requests))
+	slots := make(chan struct{}, fanOut)
+	var wg sync.WaitGroup
+	for i, m := range requests {
+		wg.Add(1)
+		go func(i int, m *datastore.MonetaryRequest) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
 
-		} else {
-			log.Print(err)
+			results[i], failures[i] = h.writeMember(
+				ctx,
+				monPath,
+				m,
+				profiles[m.From],
+				profiles[m.To],
+				members,
+			)
+		}(i, m)
+	}
+	wg.Wait()
+
+	report := &datastore.DivisionReport{Date: time.Now()}
+	var retry error
+	for i, result := range results {
+		report.Add(result)
+		if failures[i] != nil && datastore.Retryable(failures[i]) {
+			retry = failures[i]
 		}
-		//skip otherwise
 	}
-	return monetaryTs
+	return report, retry
 }
 
-func calculateResultingAmounts(groupT *datastore.GroupRequest) (int64, int64, error) {
-	totalValue := groupT.AmountUnit*100 + groupT.AmountCents
+// writeMember writes the request m of one member, kept by the
+// creditor's profile, or by the owner of the group request if the
+// creditor has none, and mirrored to the debtor's profile if there
+// is one.
+func (h *Handler) writeMember(
+	ctx context.Context,
+	monPath paths.RequestPath,
+	m *datastore.MonetaryRequest,
+	creditor *datastore.Profile,
+	debtor *datastore.Profile,
+	members int64,
+) (datastore.MemberResult, error) {
+	result := datastore.MemberResult{
+		Member:    m.To,
+		Payer:     m.From,
+		Snowflake: m.Snowflake,
+		Status:    datastore.MemberWritten,
+	}
+	creditorPath := monPath.Collection()
+	if creditor != nil {
+		creditorPath = monPath.WithOwner(creditor.Id).Collection()
+	}
 
-	var newAmountUnit int64
-	var newAmountCents int64
 	var err error
-	if groupT.Included {
-		newAmountUnit, newAmountCents, err = extractDivide(
-			totalValue,
-			int64(len(groupT.Tos)+1),
+	if debtor != nil {
+		dbPath := monPath.WithOwner(debtor.Id).Collection()
+
+		// Dispatched as one multicast to every device of the debtor.
+		n := outbox.New(
+			ctx,
+			messaging.ActionRequest,
+			debtor.Id,
+			m,
+			messaging.Link{Path: dbPath, Snowflake: m.Snowflake},
+			m.From,
+		)
+		n.Members = members
+
+		//Set with a deterministic snowflake, so replays overwrite
+		//the same documents and enqueue no second notification.
+		err = h.DB.SetMirroredMonetaryRequest(
+			ctx,
+			m,
+			creditorPath,
+			dbPath,
+			[]*datastore.Notification{n},
 		)
+		if err == nil {
+			telemetry.RequestsCreated.Add(ctx, 1, telemetry.Attr("handler", "division"))
+		}
 	} else {
-		newAmountUnit, newAmountCents, err = extractDivide(
-			totalValue,
-			int64(len(groupT.Tos)),
+		logging.Info(
+			ctx,
+			"Member has no profile, writing the creditor's copy only",
+			"member", logging.Redact(m.To),
 		)
+		result.Status = datastore.MemberPendingInvite
+		_, err = h.DB.SetMonetaryRequestByFullPath(ctx, m, creditorPath)
 	}
 	if err != nil {
-		return -1, -1, err
+		logging.Error(
+			ctx,
+			"Could not write member request",
+			"member", logging.Redact(m.To),
+			"error", err,
+		)
+		// Only the kind of failure, the error names other users' paths.
+		result.Status = datastore.MemberFailed
+		result.Reason = telemetry.Outcome(err)
 	}
-	return newAmountUnit, newAmountCents, nil
+	return result, err
 }
 
-func extractDivide(totalValue int64, groupNum int64) (int64, int64, error) {
-	dividedvalue := float64(totalValue) / float64(groupNum)
-	st := fmt.Sprintf("%.2f", dividedvalue)
-	sp := strings.Split(st, ".")
-	newAmountUnit, err := strconv.ParseInt(sp[0], 10, 64)
-	if err != nil {
-		return -1, -1, err
-	}
-	newAmountCents, err := strconv.ParseInt(sp[1], 10, 64)
-	if err != nil {
-		return -1, -1, err
-	}
-	return newAmountUnit, newAmountCents, err
+// memberSnowflake derives the snowflake of a member's request
+// from the group document and the member, so replays converge.
+func memberSnowflake(
+	groupSnowflake string,
+	member string,
+) string {
+	return fmt.Sprintf(
+		"%v-%x",
+		groupSnowflake,
+		sha256.Sum256([]byte(member)),
+	)[:len(groupSnowflake)+17]
 }
 
-func produceAndSendNotification(
-	ctx context.Context,
-	profile *datastore.Profile,
-	transfer *datastore.MonetaryRequest,
-) error {
-	//generate notification message
-	token := profile.Token
-	message := messaging.GenerateRequestNotification(
-		token,
-		transfer.AmountUnit,
-		transfer.AmountCents,
-		transfer.Currency,
-		transfer.From,
-	)
-
-	str, err := mesClient.Send(ctx, message)
-	if err != nil {
-		log.Print(str)
+// countMembers is how many ways the expense is split,
+// counting the creditor when included.
+func countMembers(groupT *datastore.GroupRequest) int64 {
+	if len(groupT.Payers) > 0 {
+		return int64(len(participants(groupT)))
 	}
-	return err
+	if groupT.Included {
+		return int64(len(groupT.Tos) + 1)
+	}
+	return int64(len(groupT.Tos))
 }
@@ -0,0 +1,326 @@
+package division
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	fcm "firebase.google.com/go/messaging"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/datastore/datastoretest"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/schema"
+	"github.com/Seriyin/GiveMeBackend/config/outbox"
+)
+
+func TestReportsEveryMember(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	datastoretest.AddProfiles(t, ctx, db,
+		datastore.UID{Id: "b", Phone: "+351222222222"},
+		datastore.UID{Id: "c", Phone: "+351333333333"},
+	)
+
+	var e firestore.Event
+	e.Value.Name = "projects/p/databases/(default)/documents/GroupRequests/a/2019-02/g1"
+	e.Value.Fields = []byte(`{
+		"from": {"stringValue": "+351111111111"},
+		"tos": {"arrayValue": {"values": [
+			{"stringValue": "+351222222222"},
+			{"stringValue": "+351444444444"},
+			{"stringValue": "+351333333333"}
+		]}},
+		"amountUnit": {"integerValue": "9"}
+	}`)
+
+	h := &Handler{DB: db}
+	if err := h.Division(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := db.GetDivisionReport(ctx, "GroupRequests/a/2019-02", "g1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Written != 2 || report.PendingInvite != 1 || report.Failed != 0 {
+		t.Errorf("%+v", report)
+	}
+	want := []string{datastore.MemberWritten, datastore.MemberPendingInvite, datastore.MemberWritten}
+	for i, result := range report.Members {
+		if result.Status != want[i] || result.Snowflake == "" {
+			t.Errorf("%v: %+v", i, result)
+		}
+	}
+	if report.Members[1].Member != "+351444444444" {
+		t.Error("members out of order", report.Members)
+	}
+
+	// Every member has a copy on the creditor's side,
+	// members with a profile on theirs too.
+	stored, _ := db.ListMonetaryRequests(ctx, schema.MonetaryRequests, "a")
+	if len(stored) != 3 {
+		t.Errorf("%+v", stored)
+	}
+	for _, debtor := range []string{"b", "c"} {
+		stored, _ := db.ListMonetaryRequests(ctx, schema.MonetaryRequests, debtor)
+		if len(stored) != 1 || stored[0].Request.AmountUnit != 3 {
+			t.Errorf("%v: %+v", debtor, stored)
+		}
+	}
+}
+
+func TestDividesAmongGroup(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	datastoretest.AddProfiles(t, ctx, db,
+		datastore.UID{Id: "a", Phone: "+351111111111"},
+		datastore.UID{Id: "b", Phone: "+351222222222"},
+	)
+	_, err := db.AddGroup(ctx, &datastore.Group{
+		Id:   "trip",
+		Name: "Trip",
+		Members: []datastore.GroupMember{
+			{ProfileId: "a", Role: datastore.RoleAdmin},
+			{ProfileId: "b", Role: datastore.RoleMember},
+			{Phone: "+351444444444", Role: datastore.RoleMember},
+		},
+		DefaultCurrency: "$",
+		DefaultSplit:    datastore.SplitEqualIncluded,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e firestore.Event
+	e.Value.Name = "projects/p/databases/(default)/documents/GroupRequests/a/2019-02/g1"
+	e.Value.Fields = []byte(`{
+		"from": {"stringValue": "+351111111111"},
+		"group": {"stringValue": "trip"},
+		"amountUnit": {"integerValue": "9"}
+	}`)
+	h := &Handler{DB: db}
+	if err := h.Division(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+
+	// Split three ways, the creditor included but not charged.
+	stored, _ := db.ListMonetaryRequests(ctx, schema.MonetaryRequests, "a")
+	if len(stored) != 2 {
+		t.Fatalf("%+v", stored)
+	}
+	for _, s := range stored {
+		if s.Request.To == "+351111111111" || s.Request.AmountUnit != 3 || s.Request.Currency != "$" || s.Request.Group != "trip" {
+			t.Errorf("%+v", s.Request)
+		}
+	}
+}
+
+func TestSettle(t *testing.T) {
+	for _, c := range []struct {
+		name         string
+		payers       []datastore.Payer
+		participants []datastore.Participant
+		want         []transfer
+	}{
+		{
+			"one owes the payer who paid more than their part",
+			[]datastore.Payer{{Phone: "a", AmountUnit: 60}, {Phone: "b", AmountUnit: 30}},
+			[]datastore.Participant{{Phone: "a", Shares: 1}, {Phone: "b", Shares: 1}, {Phone: "c", Shares: 1}},
+			[]transfer{{"a", "c", 3000}},
+		},
+		{
+			"largest debts go to largest creditors",
+			[]datastore.Payer{{Phone: "a", AmountUnit: 50}, {Phone: "b", AmountUnit: 50}},
+			[]datastore.Participant{{Phone: "c", Shares: 2}, {Phone: "d", Shares: 1}, {Phone: "a", Shares: 1}},
+			[]transfer{{"b", "c", 5000}, {"a", "d", 2500}},
+		},
+		{
+			"cents that do not divide go to the first",
+			[]datastore.Payer{{Phone: "a", AmountUnit: 10}},
+			[]datastore.Participant{{Phone: "x", Shares: 1}, {Phone: "y", Shares: 1}, {Phone: "z", Shares: 1}},
+			[]transfer{{"a", "x", 334}, {"a", "y", 333}, {"a", "z", 333}},
+		},
+	} {
+		got, err := settle(c.payers, c.participants)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v: %+v %v", c.name, got, err)
+		}
+	}
+
+	for _, participants := range [][]datastore.Participant{
+		nil,
+		{{Phone: "x", Shares: 0}},
+		{{Phone: "x", Shares: 1}, {Phone: "x", Shares: 1}},
+	} {
+		if _, err := settle([]datastore.Payer{{Phone: "a", AmountUnit: 1}}, participants); err == nil {
+			t.Errorf("settled among %+v", participants)
+		}
+	}
+}
+
+func TestSplitsEquallyToTheCent(t *testing.T) {
+	phones := []string{"+351222222222", "+351333333333", "+351444444444", "+351555555555", "+351666666666", "+351777777777"}
+	for _, c := range []struct {
+		unit     int64
+		cents    int64
+		members  int
+		included bool
+	}{
+		{10, 0, 3, false},
+		{10, 0, 2, true},
+		{0, 1, 3, false},
+		{100, 1, 6, true},
+		{7, 99, 5, false},
+		{0, 0, 3, false},
+	} {
+		groupT := &datastore.GroupRequest{
+			From:        "+351111111111",
+			Tos:         phones[:c.members],
+			Included:    c.included,
+			AmountUnit:  c.unit,
+			AmountCents: c.cents,
+		}
+		requests, err := memberRequests(groupT, "g1")
+		if err != nil || len(requests) != c.members {
+			t.Fatalf("%+v: %+v %v", c, requests, err)
+		}
+		total := c.unit*100 + c.cents
+		ways := countMembers(groupT)
+		var charged int64
+		for _, m := range requests {
+			owed := m.AmountUnit*100 + m.AmountCents
+			if owed != total/ways && owed != total/ways+1 {
+				t.Errorf("%+v: charged %v", c, owed)
+			}
+			charged += owed
+		}
+		// What is not charged is the creditor's own share.
+		if own := total - charged; own < 0 || (c.included && own != total/ways && own != total/ways+1) ||
+			(!c.included && own != 0) {
+			t.Errorf("%+v: charged %v of %v", c, charged, total)
+		}
+	}
+}
+
+func TestDividesAmongPayers(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	datastoretest.AddProfiles(t, ctx, db,
+		datastore.UID{Id: "a", Phone: "+351111111111"},
+		datastore.UID{Id: "b", Phone: "+351222222222"},
+		datastore.UID{Id: "c", Phone: "+351333333333"},
+	)
+
+	// a uploads the bill, paid with b, split with c and d, who has no profile.
+	var e firestore.Event
+	e.Value.Name = "projects/p/databases/(default)/documents/GroupRequests/a/2019-02/g1"
+	e.Value.Fields = []byte(`{
+		"from": {"stringValue": "+351111111111"},
+		"payers": {"arrayValue": {"values": [
+			{"mapValue": {"fields": {"phone": {"stringValue": "+351111111111"}, "amountUnit": {"integerValue": "30"}}}},
+			{"mapValue": {"fields": {"phone": {"stringValue": "+351222222222"}, "amountUnit": {"integerValue": "10"}}}}
+		]}},
+		"participants": {"arrayValue": {"values": [
+			{"mapValue": {"fields": {"phone": {"stringValue": "+351111111111"}, "shares": {"integerValue": "1"}}}},
+			{"mapValue": {"fields": {"phone": {"stringValue": "+351222222222"}, "shares": {"integerValue": "1"}}}},
+			{"mapValue": {"fields": {"phone": {"stringValue": "+351333333333"}, "shares": {"integerValue": "1"}}}},
+			{"mapValue": {"fields": {"phone": {"stringValue": "+351444444444"}, "shares": {"integerValue": "1"}}}}
+		]}}
+	}`)
+	h := &Handler{DB: db}
+	if err := h.Division(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each owes 10, so b is even and a is owed by c and d.
+	report, err := db.GetDivisionReport(ctx, "GroupRequests/a/2019-02", "g1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Members) != 2 || report.Written != 1 || report.PendingInvite != 1 {
+		t.Errorf("%+v", report)
+	}
+	for owner, want := range map[string]int{"a": 2, "c": 1} {
+		stored, _ := db.ListMonetaryRequests(ctx, schema.MonetaryRequests, owner)
+		if len(stored) != want {
+			t.Errorf("%v: %v requests", owner, len(stored))
+		}
+		for _, s := range stored {
+			if s.Request.From != "+351111111111" || s.Request.AmountUnit != 10 {
+				t.Errorf("%v: %+v", owner, s.Request)
+			}
+		}
+	}
+	if stored, _ := db.ListMonetaryRequests(ctx, schema.MonetaryRequests, "b"); len(stored) != 0 {
+		t.Errorf("b is even but was charged: %+v", stored[0].Request)
+	}
+}
+
+// multicasts keeps the tokens of every multicast sent.
+type multicasts struct {
+	messaging.RecordingNotifier
+	Tokens [][]string
+}
+
+func (n *multicasts) SendMulticast(
+	ctx context.Context,
+	message *fcm.MulticastMessage,
+) (*fcm.BatchResponse, error) {
+	n.Tokens = append(n.Tokens, message.Tokens)
+	return n.RecordingNotifier.SendMulticast(ctx, message)
+}
+
+func TestMulticastsToMemberDevices(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	now := time.Now()
+	datastoretest.AddProfiles(t, ctx, db,
+		datastore.UID{Id: "b", Phone: "+351222222222"},
+		datastore.UID{Id: "c", Phone: "+351333333333"},
+	)
+	for _, id := range []string{"b", "c"} {
+		for _, device := range []string{"phone", "tablet"} {
+			db.RegisterDevice(ctx, id, datastore.Device{Token: id + "-" + device, LastSeen: now})
+		}
+	}
+
+	var e firestore.Event
+	e.Value.Name = "projects/p/databases/(default)/documents/GroupRequests/a/2019-02/g1"
+	e.Value.Fields = []byte(`{
+		"from": {"stringValue": "+351111111111"},
+		"tos": {"arrayValue": {"values": [
+			{"stringValue": "+351222222222"},
+			{"stringValue": "+351333333333"}
+		]}},
+		"amountUnit": {"integerValue": "8"}
+	}`)
+	h := &Handler{DB: db}
+	if err := h.Division(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+
+	notifier := &multicasts{}
+	if err := outbox.NewDispatcher(db, notifier).DispatchDue(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	// One multicast per member, covering each of their devices.
+	var got []string
+	for _, tokens := range notifier.Tokens {
+		if len(tokens) != 2 || tokens[0][0] != tokens[1][0] {
+			t.Errorf("multicast to %v", tokens)
+		}
+		got = append(got, tokens...)
+	}
+	sort.Strings(got)
+	want := []string{"b-phone", "b-tablet", "c-phone", "c-tablet"}
+	if len(notifier.Tokens) != 2 || !reflect.DeepEqual(got, want) {
+		t.Errorf("%v", notifier.Tokens)
+	}
+	if len(notifier.Messages()) != 4 {
+		t.Errorf("%+v", notifier.Messages())
+	}
+}
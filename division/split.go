@@ -0,0 +1,209 @@
+package division
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+)
+
+// memberRequests are the requests groupT divides into, one per member
+// charged by From, or, when several paid, the fewest that settle what
+// every participant owes every payer.
+func memberRequests(
+	groupT *datastore.GroupRequest,
+	groupSnowflake string,
+) ([]*datastore.MonetaryRequest, error) {
+	request := func(from string, to string, unit int64, cents int64) *datastore.MonetaryRequest {
+		return &datastore.MonetaryRequest{
+			From:          from,
+			To:            to,
+			Desc:          groupT.Desc,
+			Date:          groupT.Date,
+			AmountUnit:    unit,
+			AmountCents:   cents,
+			Currency:      currency(groupT),
+			ConfirmedFrom: false,
+			ConfirmedTo:   false,
+			Group:         groupT.Group,
+			RecurrentId:   -1,
+		}
+	}
+
+	if len(groupT.Payers) == 0 {
+		if len(groupT.Tos) == 0 {
+			return nil, fmt.Errorf("no members")
+		}
+		total := groupT.AmountUnit*100 + groupT.AmountCents
+		if total < 0 {
+			return nil, fmt.Errorf("negative amount")
+		}
+		// A share each, the creditor's own first when included.
+		shares := make([]int64, countMembers(groupT))
+		for i := range shares {
+			shares[i] = 1
+		}
+		owed := allocate(total, shares)[len(shares)-len(groupT.Tos):]
+		requests := make([]*datastore.MonetaryRequest, 0, len(groupT.Tos))
+		for i, to := range groupT.Tos {
+			m := request(groupT.From, to, owed[i]/100, owed[i]%100)
+			m.Snowflake = memberSnowflake(groupSnowflake, to)
+			requests = append(requests, m)
+		}
+		return requests, nil
+	}
+
+	transfers, err := settle(groupT.Payers, participants(groupT))
+	if err != nil {
+		return nil, err
+	}
+	requests := make([]*datastore.MonetaryRequest, 0, len(transfers))
+	for _, t := range transfers {
+		m := request(t.creditor, t.debtor, t.cents/100, t.cents%100)
+		// Keyed by both parties, a debtor may owe several payers.
+		m.Snowflake = memberSnowflake(groupSnowflake, t.creditor+">"+t.debtor)
+		requests = append(requests, m)
+	}
+	return requests, nil
+}
+
+// participants are who split groupT: its Participants if listed,
+// its Tos otherwise, From with them if included, a share each.
+func participants(groupT *datastore.GroupRequest) []datastore.Participant {
+	if len(groupT.Participants) > 0 {
+		return groupT.Participants
+	}
+	ps := make([]datastore.Participant, 0, len(groupT.Tos)+1)
+	if groupT.Included {
+		ps = append(ps, datastore.Participant{Phone: groupT.From, Shares: 1})
+	}
+	for _, to := range groupT.Tos {
+		ps = append(ps, datastore.Participant{Phone: to, Shares: 1})
+	}
+	return ps
+}
+
+// transfer is what debtor owes creditor, in cents.
+type transfer struct {
+	creditor string
+	debtor   string
+	cents    int64
+}
+
+// settle works out what participants owe payers: each owes the total
+// paid in proportion to their shares, the cents that do not divide
+// going to the largest remainders, then the largest debts are paid
+// to the largest creditors first. That takes fewer transfers than
+// people involved, and none between two who are even.
+func settle(
+	payers []datastore.Payer,
+	participants []datastore.Participant,
+) ([]transfer, error) {
+	if len(participants) == 0 {
+		return nil, fmt.Errorf("no participants")
+	}
+	// Net positions, in order of first appearance for determinism.
+	var order []string
+	net := make(map[string]int64)
+	appear := func(phone string) {
+		if _, ok := net[phone]; !ok {
+			net[phone] = 0
+			order = append(order, phone)
+		}
+	}
+
+	var total int64
+	for _, p := range payers {
+		paid := p.AmountUnit*100 + p.AmountCents
+		if p.Phone == "" || paid < 0 || p.AmountCents < 0 || p.AmountCents > 99 {
+			return nil, fmt.Errorf("invalid payer %+v", p)
+		}
+		appear(p.Phone)
+		net[p.Phone] += paid
+		total += paid
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("nothing paid")
+	}
+
+	var shares int64
+	seen := make(map[string]bool)
+	for _, p := range participants {
+		if p.Phone == "" || p.Shares <= 0 || seen[p.Phone] {
+			return nil, fmt.Errorf("invalid participant %+v", p)
+		}
+		seen[p.Phone] = true
+		shares += p.Shares
+	}
+	parts := make([]int64, len(participants))
+	for i, p := range participants {
+		parts[i] = p.Shares
+	}
+	owed := allocate(total, parts)
+	for i, p := range participants {
+		appear(p.Phone)
+		net[p.Phone] -= owed[i]
+	}
+
+	var creditors, debtors []string
+	for _, phone := range order {
+		switch {
+		case net[phone] > 0:
+			creditors = append(creditors, phone)
+		case net[phone] < 0:
+			debtors = append(debtors, phone)
+		}
+	}
+	largest := func(phones []string, sign int64) {
+		sort.SliceStable(phones, func(i, j int) bool {
+			return sign*net[phones[i]] > sign*net[phones[j]]
+		})
+	}
+	largest(creditors, 1)
+	largest(debtors, -1)
+
+	var transfers []transfer
+	for len(creditors) > 0 && len(debtors) > 0 {
+		creditor, debtor := creditors[0], debtors[0]
+		cents := net[creditor]
+		if -net[debtor] < cents {
+			cents = -net[debtor]
+		}
+		transfers = append(transfers, transfer{creditor, debtor, cents})
+		net[creditor] -= cents
+		net[debtor] += cents
+		if net[creditor] == 0 {
+			creditors = creditors[1:]
+		}
+		if net[debtor] == 0 {
+			debtors = debtors[1:]
+		}
+	}
+	return transfers, nil
+}
+
+// allocate splits total cents by shares, none of them zero, so the
+// parts add up to total: each is rounded down, and the cents left
+// over go one each to the largest remainders, earliest first.
+func allocate(total int64, shares []int64) []int64 {
+	var sum int64
+	for _, s := range shares {
+		sum += s
+	}
+	owed := make([]int64, len(shares))
+	remainders := make([]int, len(shares))
+	var assigned int64
+	for i, s := range shares {
+		owed[i] = total * s / sum
+		assigned += owed[i]
+		remainders[i] = i
+	}
+	sort.SliceStable(remainders, func(a, b int) bool {
+		i, j := remainders[a], remainders[b]
+		return total*shares[i]%sum > total*shares[j]%sum
+	})
+	for k := int64(0); k < total-assigned; k++ {
+		owed[remainders[k]]++
+	}
+	return owed
+}
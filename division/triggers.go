@@ -0,0 +1,25 @@
+package division
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Seriyin/GiveMeBackend/config/deadletter"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
+)
+
+// DivisionHTTP is the entry point of Division on 2nd gen runtimes.
+func DivisionHTTP(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	trigger.Serve(w, r, Division, deadletter.Reject("division"))
+}
+
+// DivisionPubSub is the entry point of Division for commands sent through Pub/Sub.
+func DivisionPubSub(
+	ctx context.Context,
+	m trigger.PubSubMessage,
+) error {
+	return trigger.FromPubSub(ctx, m, Division, deadletter.Reject("division"))
+}
@@ -0,0 +1,164 @@
+package membership
+
+import (
+	"context"
+	"time"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/deadletter"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/paths"
+	"github.com/Seriyin/GiveMeBackend/config/logging"
+	"github.com/Seriyin/GiveMeBackend/config/outbox"
+	"github.com/Seriyin/GiveMeBackend/config/services"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
+)
+
+// Handler tells members when they join or leave a group.
+type Handler struct {
+	DB datastore.GiveMeDatabase
+}
+
+// NewHandler builds a Handler over the services of c.
+func NewHandler(c *services.Container) (*Handler, error) {
+	db, err := c.DB()
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{DB: db}, nil
+}
+
+// NewTrigger builds the handler Membership runs over the services of c.
+func NewTrigger(c *services.Container) (trigger.Handler, error) {
+	h, err := NewHandler(c)
+	if err != nil {
+		return nil, err
+	}
+	return h.Membership, nil
+}
+
+// Membership is the deployed entry point, over the default services.
+var Membership = deadletter.Entry("membership", NewTrigger)
+
+// Membership notifies the members a write of a group added or removed.
+// Notifications are keyed by the version of the group, so redelivered
+// events enqueue none twice. Membership changes made by other than an
+// admin are undone, restoring the group as it was, and notify no one.
+func (h *Handler) Membership(
+	ctx context.Context,
+	e firestore.Event,
+) error {
+	name := e.Value.Name
+	if name == "" {
+		name = e.OldValue.Name
+	}
+	ctx = logging.ForEvent(ctx, "membership", name)
+
+	old, err := firestore.UnmarshallAndConvertGroupEntity(e.OldValue.Fields)
+	if err != nil {
+		return err
+	}
+	g, err := firestore.UnmarshallAndConvertGroupEntity(e.Value.Fields)
+	if err != nil {
+		return err
+	}
+	groupId := paths.ExtractDocumentId(name)
+	version := e.Value.UpdateTime
+	for _, group := range []*datastore.Group{old, g} {
+		if group != nil {
+			group.Id = groupId
+		}
+	}
+	if g == nil {
+		// Deleted, every member left.
+		version = e.OldValue.UpdateTime
+	}
+
+	if err := datastore.AuthorizeMembership(old, g); err != nil {
+		if old == nil {
+			return err
+		}
+		logging.Warning(ctx, "Restoring group changed by a non-admin", "error", err)
+		restored := *old
+		restored.UpdatedBy = ""
+		return h.DB.UpdateGroup(ctx, &restored)
+	}
+	if old != nil && g != nil && g.UpdatedBy == "" {
+		// Restores put back what no one was told of.
+		logging.Info(ctx, "Group restored", "group", groupId)
+		return nil
+	}
+
+	added, removed := datastore.MembershipChanges(old, g)
+	logging.Info(
+		ctx,
+		"Group membership changed",
+		"group", groupId,
+		"added", len(added),
+		"removed", len(removed),
+	)
+	var notifications []*datastore.Notification
+	joined, err := h.notifications(ctx, messaging.ActionGroupJoined, added, g, version)
+	if err != nil {
+		return err
+	}
+	notifications = append(notifications, joined...)
+	left, err := h.notifications(ctx, messaging.ActionGroupLeft, removed, old, version)
+	if err != nil {
+		return err
+	}
+	notifications = append(notifications, left...)
+	if len(notifications) == 0 {
+		return nil
+	}
+	return h.DB.AddNotifications(ctx, notifications)
+}
+
+// notifications prepares the notification of action for every one
+// of members with a profile, those known by phone alone are not users
+// yet and have nowhere to be told.
+func (h *Handler) notifications(
+	ctx context.Context,
+	action string,
+	members []datastore.GroupMember,
+	g *datastore.Group,
+	version time.Time,
+) ([]*datastore.Notification, error) {
+	var phones []string
+	for _, m := range members {
+		if m.ProfileId == "" {
+			phones = append(phones, m.Phone)
+		}
+	}
+	var profiles map[string]*datastore.Profile
+	if len(phones) > 0 {
+		var err error
+		profiles, err = h.DB.GetProfilesByPhoneNumbers(ctx, phones)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	notifications := make([]*datastore.Notification, 0, len(members))
+	for _, m := range members {
+		recipient := m.ProfileId
+		if recipient == "" {
+			p, ok := profiles[m.Phone]
+			if !ok {
+				logging.Debug(
+					ctx,
+					"Member has no profile to notify",
+					"member", logging.Redact(m.Phone),
+				)
+				continue
+			}
+			recipient = p.Id
+		}
+		notifications = append(
+			notifications,
+			outbox.NewMembership(ctx, action, recipient, g, version),
+		)
+	}
+	return notifications, nil
+}
@@ -0,0 +1,144 @@
+package membership
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/datastore/datastoretest"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
+)
+
+const name = "projects/p/databases/(default)/documents/Groups/trip"
+
+// fields is a version of the group written by author.
+func fields(author string, members string) []byte {
+	return []byte(`{
+		"name": {"stringValue": "Trip"},
+		"members": {"arrayValue": {"values": [` + members + `]}},
+		"updatedBy": {"stringValue": "` + author + `"}
+	}`)
+}
+
+const (
+	memberA = `{"mapValue": {"fields": {"profileId": {"stringValue": "a"}, "role": {"stringValue": "admin"}}}}`
+	memberB = `{"mapValue": {"fields": {"phone": {"stringValue": "+351222222222"}, "role": {"stringValue": "member"}}}}`
+	memberC = `{"mapValue": {"fields": {"phone": {"stringValue": "+351333333333"}, "role": {"stringValue": "member"}}}}`
+)
+
+func TestNotifiesAddedAndRemoved(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	datastoretest.AddProfiles(t, ctx, db,
+		datastore.UID{Id: "a", Phone: "+351111111111"},
+		datastore.UID{Id: "b", Phone: "+351222222222"},
+	)
+	h := &Handler{DB: db}
+	created := time.Date(2019, 2, 13, 0, 0, 0, 0, time.UTC)
+
+	var e firestore.Event
+	e.Value = firestore.Value{Name: name, Fields: fields("a", memberA+","+memberB+","+memberC), UpdateTime: created}
+	// Redelivered, as triggers may be.
+	for i := 0; i < 2; i++ {
+		if err := h.Membership(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// c has no profile, so a and b alone are told.
+	due, _ := db.GetDueNotifications(ctx, time.Now(), 10)
+	if len(due) != 2 {
+		t.Fatalf("%+v", due)
+	}
+	for _, n := range due {
+		if n.Action != messaging.ActionGroupJoined || n.Snowflake != "trip" || n.Name != "Trip" {
+			t.Errorf("%+v", n)
+		}
+	}
+
+	e.OldValue = e.Value
+	e.Value = firestore.Value{Name: name, Fields: fields("a", memberA), UpdateTime: created.Add(time.Hour)}
+	if err := h.Membership(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	due, _ = db.GetDueNotifications(ctx, time.Now(), 10)
+	var left []string
+	for _, n := range due {
+		if n.Action == messaging.ActionGroupLeft {
+			left = append(left, n.Recipient)
+		}
+	}
+	if len(due) != 3 || len(left) != 1 || left[0] != "b" {
+		t.Errorf("%+v", due)
+	}
+}
+
+func TestEnforcesAdminRoles(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	datastoretest.AddProfiles(t, ctx, db,
+		datastore.UID{Id: "a", Phone: "+351111111111"},
+		datastore.UID{Id: "b", Phone: "+351222222222"},
+		datastore.UID{Id: "c", Phone: "+351333333333"},
+	)
+	memberB := `{"mapValue": {"fields": {"profileId": {"stringValue": "b"}, "role": {"stringValue": "member"}}}}`
+	_, err := db.AddGroup(ctx, &datastore.Group{
+		Id:   "trip",
+		Name: "Trip",
+		Members: []datastore.GroupMember{
+			{ProfileId: "a", Role: datastore.RoleAdmin},
+			{ProfileId: "b", Role: datastore.RoleMember},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{DB: db}
+	created := time.Date(2019, 2, 13, 0, 0, 0, 0, time.UTC)
+	update := func(old string, new string, hours int) firestore.Event {
+		var e firestore.Event
+		e.OldValue = firestore.Value{Name: name, Fields: []byte(old), UpdateTime: created}
+		e.Value = firestore.Value{Name: name, Fields: []byte(new), UpdateTime: created.Add(time.Duration(hours) * time.Hour)}
+		return e
+	}
+	both := string(fields("a", memberA+","+memberB))
+
+	// b adding c is undone, and no one is told.
+	rogue := string(fields("b", memberA+","+memberB+","+memberC))
+	if err := h.Membership(ctx, update(both, rogue, 1)); err != nil {
+		t.Fatal(err)
+	}
+	g, err := db.GetGroup(ctx, "trip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Members) != 2 || g.UpdatedBy != "" {
+		t.Errorf("%+v", g)
+	}
+	// The restore comes back as an event of its own.
+	restored := string(fields("", memberA+","+memberB))
+	if err := h.Membership(ctx, update(rogue, restored, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ := db.GetDueNotifications(ctx, time.Now(), 10); len(due) != 0 {
+		t.Fatalf("%+v", due)
+	}
+
+	// b may leave, though.
+	if err := h.Membership(ctx, update(both, string(fields("b", memberA)), 3)); err != nil {
+		t.Fatal(err)
+	}
+	due, _ := db.GetDueNotifications(ctx, time.Now(), 10)
+	if len(due) != 1 || due[0].Action != messaging.ActionGroupLeft || due[0].Recipient != "b" {
+		t.Errorf("%+v", due)
+	}
+
+	// A creator must make themselves admin.
+	var e firestore.Event
+	e.Value = firestore.Value{Name: name, Fields: fields("b", memberA+","+memberB), UpdateTime: created}
+	if err := h.Membership(ctx, e); !errors.Is(err, datastore.ErrInvalidEvent) {
+		t.Error(err)
+	}
+}
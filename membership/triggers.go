@@ -0,0 +1,25 @@
+package membership
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Seriyin/GiveMeBackend/config/deadletter"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
+)
+
+// MembershipHTTP is the entry point of Membership on 2nd gen runtimes.
+func MembershipHTTP(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	trigger.Serve(w, r, Membership, deadletter.Reject("membership"))
+}
+
+// MembershipPubSub is the entry point of Membership for commands sent through Pub/Sub.
+func MembershipPubSub(
+	ctx context.Context,
+	m trigger.PubSubMessage,
+) error {
+	return trigger.FromPubSub(ctx, m, Membership, deadletter.Reject("membership"))
+}
@@ -0,0 +1,149 @@
+package phoneChange
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/deadletter"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/paths"
+	"github.com/Seriyin/GiveMeBackend/config/logging"
+	"github.com/Seriyin/GiveMeBackend/config/services"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
+)
+
+// Handler migrates profiles onto verified phone numbers.
+type Handler struct {
+	DB    datastore.GiveMeDatabase
+	Users services.Users
+}
+
+// NewHandler builds a Handler over the services of c.
+func NewHandler(c *services.Container) (*Handler, error) {
+	db, err := c.DB()
+	if err != nil {
+		return nil, err
+	}
+	users, err := c.Users()
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{DB: db, Users: users}, nil
+}
+
+// NewTrigger builds the handler PhoneChange runs over the services of c.
+func NewTrigger(c *services.Container) (trigger.Handler, error) {
+	h, err := NewHandler(c)
+	if err != nil {
+		return nil, err
+	}
+	return h.PhoneChange, nil
+}
+
+// PhoneChange is the deployed entry point, over the default services.
+var PhoneChange = deadletter.Entry("phoneChange", NewTrigger)
+
+// PhoneChange migrates a profile onto a new phone number.
+// Requests on both sides are rewritten before the profile itself,
+// so a retry after a partial failure picks up where it stopped.
+func (h *Handler) PhoneChange(
+	ctx context.Context,
+	e firestore.Event,
+) error {
+	ctx = logging.ForEvent(ctx, "phoneChange", e.Value.Name)
+	change, err := firestore.UnmarshallAndConvertPhoneChange(e.Value.Fields)
+	if err != nil {
+		return err
+	}
+
+	userId := paths.ExtractDocumentId(e.Value.Name)
+	ctx = logging.WithUsers(ctx, userId)
+	profile, err := h.DB.GetProfile(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	oldPhone := profile.Phone
+	if oldPhone == change.NewPhone {
+		logging.Info(ctx, "Phone number already migrated")
+		return nil
+	}
+
+	// Only trust numbers Firebase Auth has verified for this user.
+	user, err := h.Users.GetUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if user.PhoneNumber != change.NewPhone {
+		return datastore.NewError(
+			datastore.ErrInvalidEvent,
+			"phonechange: new number %v is not the one verified for the user",
+			logging.Redact(change.NewPhone),
+		)
+	}
+
+	involved, err := h.DB.ReplacePhoneNumberInRequests(
+		ctx,
+		userId,
+		oldPhone,
+		change.NewPhone,
+	)
+	if err != nil {
+		return err
+	}
+	logging.Info(ctx, "Rewrote own requests", "requests", len(involved))
+
+	err = h.rewriteCounterparties(
+		ctx,
+		oldPhone,
+		change.NewPhone,
+		involved,
+	)
+	if err != nil {
+		return err
+	}
+
+	profile.PreviousPhones = append(profile.PreviousPhones, oldPhone)
+	profile.Phone = change.NewPhone
+	return h.DB.UpdateProfile(ctx, profile)
+}
+
+func (h *Handler) rewriteCounterparties(
+	ctx context.Context,
+	oldPhone string,
+	newPhone string,
+	involved []*datastore.MonetaryRequest,
+) error {
+	seen := make(map[string]bool)
+	for _, m := range involved {
+		counterparty := m.From
+		if counterparty == newPhone {
+			counterparty = m.To
+		}
+		if seen[counterparty] {
+			continue
+		}
+		seen[counterparty] = true
+
+		// Counterparties who never joined have no copies to rewrite.
+		id, err := h.DB.GetProfileIdByPhoneNumber(ctx, counterparty)
+		if errors.Is(err, datastore.ErrNotFound) {
+			logging.Debug(ctx, "Counterparty has no copies to rewrite", "counterparty", logging.Redact(counterparty))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = h.DB.ReplacePhoneNumberInRequests(
+			ctx,
+			id,
+			oldPhone,
+			newPhone,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
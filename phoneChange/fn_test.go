@@ -0,0 +1,124 @@
+package phoneChange
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/auth"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/datastore/datastoretest"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/schema"
+)
+
+// verified has every user verified on the number it holds for them.
+type verified map[string]string
+
+func (v verified) GetUser(ctx context.Context, uid string) (*auth.UserRecord, error) {
+	return &auth.UserRecord{UserInfo: &auth.UserInfo{UID: uid, PhoneNumber: v[uid]}}, nil
+}
+
+func (v verified) VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error) {
+	return nil, errors.New("not needed")
+}
+
+// unavailable fails looking up the profile of phone.
+type unavailable struct {
+	datastore.GiveMeDatabase
+	phone string
+}
+
+func (db unavailable) GetProfileIdByPhoneNumber(
+	ctx context.Context,
+	phoneNumber string,
+) (string, error) {
+	if phoneNumber == db.phone {
+		return "", datastore.NewError(datastore.ErrUnavailable, "test: lookup failed")
+	}
+	return db.GiveMeDatabase.GetProfileIdByPhoneNumber(ctx, phoneNumber)
+}
+
+func setup(t *testing.T) (context.Context, datastore.GiveMeDatabase) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	datastoretest.AddProfiles(t, ctx, db,
+		datastore.UID{Id: "a", Phone: "+351111111111"},
+		datastore.UID{Id: "b", Phone: "+351222222222"},
+	)
+	request := func(snowflake string, to string) *datastore.MonetaryRequest {
+		return &datastore.MonetaryRequest{
+			From:        "+351111111111",
+			To:          to,
+			Date:        time.Date(2019, 2, 13, 0, 0, 0, 0, time.UTC),
+			AmountUnit:  5,
+			Currency:    "€",
+			Snowflake:   snowflake,
+			RecurrentId: -1,
+		}
+	}
+	err := db.SetMirroredMonetaryRequest(ctx, request("s1", "+351222222222"),
+		"MonetaryRequests/a/2019-02", "MonetaryRequests/b/2019-02", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Charged to someone who never joined, so the creditor's copy alone.
+	_, err = db.SetMonetaryRequestByFullPath(ctx, request("s2", "+351333333333"),
+		"MonetaryRequests/a/2019-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ctx, db
+}
+
+func event() firestore.Event {
+	var e firestore.Event
+	e.Value.Name = "projects/p/databases/(default)/documents/PhoneChanges/a"
+	e.Value.Fields = []byte(`{"newPhone": {"stringValue": "+351100000000"}}`)
+	return e
+}
+
+func TestMigratesCounterparties(t *testing.T) {
+	ctx, db := setup(t)
+	h := &Handler{DB: db, Users: verified{"a": "+351100000000"}}
+	if err := h.PhoneChange(ctx, event()); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := db.ListMonetaryRequests(ctx, schema.MonetaryRequests, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].Request.From != "+351100000000" {
+		t.Fatalf("%+v", stored)
+	}
+	profile, err := db.GetProfile(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Phone != "+351100000000" || len(profile.PreviousPhones) != 1 {
+		t.Errorf("%+v", profile)
+	}
+}
+
+func TestRetriesFailedCounterpartyLookups(t *testing.T) {
+	ctx, db := setup(t)
+	h := &Handler{
+		DB:    unavailable{GiveMeDatabase: db, phone: "+351222222222"},
+		Users: verified{"a": "+351100000000"},
+	}
+	if err := h.PhoneChange(ctx, event()); !errors.Is(err, datastore.ErrUnavailable) {
+		t.Fatalf("got %v", err)
+	}
+
+	// The profile keeps its number, so the retry migrates b's copy.
+	profile, err := db.GetProfile(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Phone != "+351111111111" {
+		t.Errorf("%+v", profile)
+	}
+}
@@ -2,15 +2,100 @@ package register
 
 import (
 	"context"
-	"github.com/Seriyin/GiveMeBackend/config/firebase"
+	"time"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/deadletter"
 	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/paths"
+	"github.com/Seriyin/GiveMeBackend/config/logging"
+	"github.com/Seriyin/GiveMeBackend/config/services"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
 )
 
-var db = firebase.GetDB()
+// Handler registers the devices profiles receive pushes on.
+type Handler struct {
+	DB    datastore.GiveMeDatabase
+	Users services.Users
+}
+
+// NewHandler builds a Handler over the services of c.
+func NewHandler(c *services.Container) (*Handler, error) {
+	db, err := c.DB()
+	if err != nil {
+		return nil, err
+	}
+	users, err := c.Users()
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{DB: db, Users: users}, nil
+}
+
+// NewTrigger builds the handler Register runs over the services of c.
+func NewTrigger(c *services.Container) (trigger.Handler, error) {
+	h, err := NewHandler(c)
+	if err != nil {
+		return nil, err
+	}
+	return h.Register, nil
+}
 
-func Register(
+// Register is the deployed entry point, over the default services.
+var Register = deadletter.Entry("register", NewTrigger)
+
+// registration is what a client writes along with its device,
+// the ID token of the user it is signed in as.
+type registration struct {
+	IdToken string `firestore:"idToken"`
+}
+
+// Register adds the device written under Devices/{uid}/Tokens/{token}
+// to the profile uid, or refreshes it. Clients rewrite the document
+// on every start and whenever FCM hands them a new token, and the
+// time of each write is when the device was last seen, so devices
+// in use stay active.
+// Any client may write any path, so the document must carry an ID
+// token of uid, or someone else's pushes could be registered to it.
+func (h *Handler) Register(
 	ctx context.Context,
 	e firestore.Event,
 ) error {
-	return nil
+	ctx = logging.ForEvent(ctx, "register", e.Value.Name)
+	path, err := paths.ParseDevice(e.Value.Name)
+	if err != nil {
+		return err
+	}
+	ctx = logging.WithUsers(ctx, path.UserId)
+
+	var reg registration
+	if err := firestore.DecodeFields(e.Value.Fields, &reg); err != nil {
+		return err
+	}
+	// A token failing to verify will not on a retry either,
+	// the client writes a fresh one on its next start.
+	token, err := h.Users.VerifyIDToken(ctx, reg.IdToken)
+	if err != nil {
+		return datastore.NewError(datastore.ErrInvalidEvent, "register: could not verify the writer: %v", err)
+	}
+	if token.UID != path.UserId {
+		return datastore.NewError(datastore.ErrInvalidEvent, "register: device written for another user")
+	}
+
+	var device datastore.Device
+	if err := firestore.DecodeFields(e.Value.Fields, &device); err != nil {
+		return err
+	}
+	device.Token = path.Token
+	device.LastSeen = e.Value.UpdateTime
+	if device.LastSeen.IsZero() {
+		device.LastSeen = time.Now()
+	}
+	logging.Info(
+		ctx,
+		"Registering device",
+		"platform", device.Platform,
+		"appVersion", device.AppVersion,
+	)
+	return h.DB.RegisterDevice(ctx, path.UserId, device)
 }
@@ -0,0 +1,111 @@
+package register
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/auth"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/datastore/datastoretest"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+)
+
+// signedIn verifies the ID tokens it holds, as those of their uid.
+type signedIn map[string]string
+
+func (s signedIn) GetUser(ctx context.Context, uid string) (*auth.UserRecord, error) {
+	return nil, errors.New("not needed")
+}
+
+func (s signedIn) VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error) {
+	uid, ok := s[idToken]
+	if !ok {
+		return nil, errors.New("invalid ID token")
+	}
+	return &auth.Token{UID: uid}, nil
+}
+
+// device is a write of token for a, signed in with idToken.
+func device(token string, idToken string, version string, at time.Time) firestore.Event {
+	var e firestore.Event
+	e.Value.Name = "projects/p/databases/(default)/documents/Devices/a/Tokens/" + token
+	e.Value.Fields = []byte(`{
+		"idToken": {"stringValue": "` + idToken + `"},
+		"platform": {"stringValue": "ios"},
+		"appVersion": {"stringValue": "` + version + `"}
+	}`)
+	e.Value.UpdateTime = at
+	return e
+}
+
+func TestRegistersAndRefreshesDevices(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	datastoretest.AddProfiles(t, ctx, db, datastore.UID{Id: "a", Phone: "+351111111111"})
+	h := &Handler{DB: db, Users: signedIn{"id-a": "a"}}
+	write := func(token string, version string, at time.Time) error {
+		return h.Register(ctx, device(token, "id-a", version, at))
+	}
+
+	now := time.Now()
+	stale := now.Add(-datastore.DeviceStaleAfter - time.Hour)
+	for _, err := range []error{
+		write("phone", "1.0", stale),
+		write("tablet", "1.0", stale),
+		// The phone is started again, on a newer version.
+		write("phone", "1.1", now),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	profile, err := db.GetProfile(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profile.Devices) != 2 {
+		t.Fatalf("%+v", profile.Devices)
+	}
+	active := profile.ActiveDevices(now)
+	if len(active) != 1 || active[0].Token != "phone" || active[0].AppVersion != "1.1" ||
+		active[0].Platform != datastore.PlatformIOS {
+		t.Errorf("%+v", active)
+	}
+}
+
+func TestRejectsOtherWriters(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	datastoretest.AddProfiles(t, ctx, db,
+		datastore.UID{Id: "a", Phone: "+351111111111"},
+		datastore.UID{Id: "b", Phone: "+351222222222"},
+	)
+	h := &Handler{DB: db, Users: signedIn{"id-b": "b"}}
+	for _, idToken := range []string{"", "forged", "id-b"} {
+		err := h.Register(ctx, device("phone", idToken, "1.0", time.Now()))
+		if !errors.Is(err, datastore.ErrInvalidEvent) {
+			t.Errorf("%q: %v", idToken, err)
+		}
+	}
+	profile, err := db.GetProfile(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profile.Devices) != 0 {
+		t.Errorf("%+v", profile.Devices)
+	}
+}
+
+func TestRejectsOtherPaths(t *testing.T) {
+	h := &Handler{DB: datastore.NewMemoryDB(), Users: signedIn{"id-a": "a"}}
+	var e firestore.Event
+	e.Value.Name = "projects/p/databases/(default)/documents/Profiles/a"
+	e.Value.Fields = []byte(`{"idToken": {"stringValue": "id-a"}}`)
+	if err := h.Register(context.Background(), e); !errors.Is(err, datastore.ErrInvalidEvent) {
+		t.Error(err)
+	}
+}
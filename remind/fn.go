@@ -2,13 +2,40 @@ package remind
 
 import (
 	"context"
-	"github.com/Seriyin/GiveMeBackend/config/firebase"
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/deadletter"
 	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+	"github.com/Seriyin/GiveMeBackend/config/services"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
 )
 
-var db = firebase.GetDB()
+// Handler sends reminders of pending requests.
+type Handler struct {
+	DB datastore.GiveMeDatabase
+}
+
+// NewHandler builds a Handler over the services of c.
+func NewHandler(c *services.Container) (*Handler, error) {
+	db, err := c.DB()
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{DB: db}, nil
+}
+
+// NewTrigger builds the handler Remind runs over the services of c.
+func NewTrigger(c *services.Container) (trigger.Handler, error) {
+	h, err := NewHandler(c)
+	if err != nil {
+		return nil, err
+	}
+	return h.Remind, nil
+}
+
+// Remind is the deployed entry point, over the default services.
+var Remind = deadletter.Entry("remind", NewTrigger)
 
-func Remind(
+func (h *Handler) Remind(
 	ctx context.Context,
 	e firestore.Event,
 ) error {
@@ -2,83 +2,118 @@ package request
 
 import (
 	"context"
+	"errors"
 	"github.com/Seriyin/GiveMeBackend/config/datastore"
-	"github.com/Seriyin/GiveMeBackend/config/firebase"
+	"github.com/Seriyin/GiveMeBackend/config/deadletter"
 	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
 	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
 	"github.com/Seriyin/GiveMeBackend/config/firebase/paths"
-	"log"
+	"github.com/Seriyin/GiveMeBackend/config/idempotency"
+	"github.com/Seriyin/GiveMeBackend/config/logging"
+	"github.com/Seriyin/GiveMeBackend/config/outbox"
+	"github.com/Seriyin/GiveMeBackend/config/services"
+	"github.com/Seriyin/GiveMeBackend/config/telemetry"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
 )
 
-var db = firebase.GetDB()
-var mesClient = firebase.GetMessaging()
+// Handler mirrors new requests into the debtor's collection.
+type Handler struct {
+	DB datastore.GiveMeDatabase
+}
 
-func Request(
-	ctx context.Context,
-	e firestore.Event,
-) error {
-	monetaryT, err := firestore.UnmarshallAndConvertMonetary(e.Value.Fields) // Json object to Monetary Structure
+// NewHandler builds a Handler over the services of c.
+func NewHandler(c *services.Container) (*Handler, error) {
+	db, err := c.DB()
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{DB: db}, nil
+}
 
-	log.Print("Attempted unmarshal")
+// NewTrigger builds the handler Request runs over the services of c.
+func NewTrigger(c *services.Container) (trigger.Handler, error) {
+	h, err := NewHandler(c)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return h.Request, nil
+}
 
-	// If no profile can be gathered, the user may not exist.
-	// Either by network error or profile not existing, must return.
-	profile, err := db.GetProfileByPhoneNumber(
+// Request is the deployed entry point, over the default services.
+var Request = deadletter.Entry("request", NewTrigger)
+
+func (h *Handler) Request(
+	ctx context.Context,
+	e firestore.Event,
+) error {
+	ctx = logging.ForEvent(ctx, "request", e.Value.Name)
+	return idempotency.Once(
 		ctx,
-		monetaryT.To,
+		h.DB,
+		"request",
+		idempotency.DefaultTTL,
+		func(ctx context.Context) error {
+			return h.request(ctx, e)
+		},
 	)
+}
 
-	log.Print("Attempted profile grab")
+func (h *Handler) request(
+	ctx context.Context,
+	e firestore.Event,
+) error {
+	monetaryT, err := firestore.UnmarshallAndConvertMonetary(e.Value.Fields) // Json object to Monetary Structure
 	if err != nil {
 		return err
 	}
 
-	dbPath := paths.ExtractAndReplaceMethodIdAndDatePath(
-		profile.Id,
-		e.Value.Name,
-	)
+	path, err := paths.Parse(e.Value.Name)
+	if err != nil {
+		return err
+	}
 
-	log.Printf("Extracted db path: %v", dbPath)
-	_, err = db.SetMonetaryRequestByFullPath(
+	// Debtors who never joined have no copy of their own, the
+	// creditor's stands as an invite, as division writes them.
+	profile, err := h.DB.GetProfileByPhoneNumber(
 		ctx,
-		monetaryT,
-		dbPath,
+		monetaryT.To,
 	)
+	if errors.Is(err, datastore.ErrNotFound) {
+		logging.Info(
+			ctx,
+			"Debtor has no profile, request pending invite",
+			"debtor", logging.Redact(monetaryT.To),
+			"snowflake", monetaryT.Snowflake,
+		)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
+	ctx = logging.WithUsers(ctx, path.UserId, profile.Id)
+	dbPath := path.WithOwner(profile.Id).Collection()
 
-	err = produceAndSendNotification(
+	// The notification is enqueued with the write, the dispatcher
+	// delivers it, so a failed push never rewrites the request.
+	_, err = h.DB.SetMonetaryRequestByFullPathWithOutbox(
 		ctx,
-		profile,
 		monetaryT,
+		dbPath,
+		[]*datastore.Notification{
+			outbox.New(
+				ctx,
+				messaging.ActionRequest,
+				profile.Id,
+				monetaryT,
+				messaging.Link{Path: dbPath, Snowflake: monetaryT.Snowflake},
+				monetaryT.From,
+			),
+		},
 	)
-
-	log.Print("Attempted produce send notification")
-	return err
-}
-
-func produceAndSendNotification(
-	ctx context.Context,
-	profile *datastore.Profile,
-	transfer *datastore.MonetaryRequest,
-) error {
-	//generate notification message
-	token := profile.Token
-	message := messaging.GenerateRequestNotification(
-		token,
-		transfer.AmountUnit,
-		transfer.AmountCents,
-		transfer.Currency,
-		transfer.From,
-	)
-
-	str, err := mesClient.Send(ctx, message)
 	if err != nil {
-		log.Print(str)
+		return err
 	}
-	return err
+	logging.Info(ctx, "Mirrored request to debtor", "snowflake", monetaryT.Snowflake)
+	telemetry.RequestsCreated.Add(ctx, 1, telemetry.Attr("handler", "request"))
+	return nil
 }
@@ -0,0 +1,76 @@
+package request
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/datastore/datastoretest"
+	"github.com/Seriyin/GiveMeBackend/config/deadletter"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/firestore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/schema"
+)
+
+func TestMirrorsToDebtor(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	datastoretest.AddProfiles(t, ctx, db, datastore.UID{Id: "b", Phone: "+351222222222"})
+
+	var e firestore.Event
+	e.Value.Name = "projects/p/databases/(default)/documents/MonetaryRequests/a/2019-02/s1"
+	e.Value.Fields = []byte(`{
+		"from": {"stringValue": "+351111111111"},
+		"to": {"stringValue": "+351222222222"},
+		"amountUnit": {"integerValue": "5"}
+	}`)
+
+	h := &Handler{DB: db}
+	if err := h.Request(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := db.ListMonetaryRequests(ctx, schema.MonetaryRequests, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].Path != "MonetaryRequests/b/2019-02" {
+		t.Fatalf("%+v", stored)
+	}
+	if stored[0].Request.AmountUnit != 5 {
+		t.Errorf("%+v", stored[0].Request)
+	}
+}
+
+func TestLeavesInvitesPending(t *testing.T) {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+
+	// A pending invite of division, to a number with no profile yet.
+	var e firestore.Event
+	e.Value.Name = "projects/p/databases/(default)/documents/MonetaryRequests/a/2019-02/g1-0123456789abcdef"
+	e.Value.Fields = []byte(`{
+		"from": {"stringValue": "+351111111111"},
+		"to": {"stringValue": "+351444444444"},
+		"amountUnit": {"integerValue": "3"}
+	}`)
+
+	h := &Handler{DB: db}
+	if err := deadletter.Guard(ctx, db, "request", deadletter.DefaultMaxAttempts, e, h.Request); err != nil {
+		t.Fatal(err)
+	}
+	letters, err := db.ListDeadLetters(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 0 {
+		t.Errorf("%+v", letters)
+	}
+	due, err := db.GetDueNotifications(ctx, time.Now().Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Errorf("%+v", due)
+	}
+}
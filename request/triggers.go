@@ -0,0 +1,25 @@
+package request
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Seriyin/GiveMeBackend/config/deadletter"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
+)
+
+// RequestHTTP is the entry point of Request on 2nd gen runtimes.
+func RequestHTTP(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	trigger.Serve(w, r, Request, deadletter.Reject("request"))
+}
+
+// RequestPubSub is the entry point of Request for commands sent through Pub/Sub.
+func RequestPubSub(
+	ctx context.Context,
+	m trigger.PubSubMessage,
+) error {
+	return trigger.FromPubSub(ctx, m, Request, deadletter.Reject("request"))
+}
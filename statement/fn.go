@@ -0,0 +1,195 @@
+package statement
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/schema"
+	"github.com/Seriyin/GiveMeBackend/config/ledger"
+	"github.com/Seriyin/GiveMeBackend/config/logging"
+	"github.com/Seriyin/GiveMeBackend/config/outbox"
+	"github.com/Seriyin/GiveMeBackend/config/services"
+	"github.com/Seriyin/GiveMeBackend/config/telemetry"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
+)
+
+// Handler serves the ledgers of groups to their members
+// and sums them up for them on a schedule.
+type Handler struct {
+	DB datastore.GiveMeDatabase
+	// Users verifies who asks for a statement,
+	// nil where none can, as locally.
+	Users services.Users
+	// Now is overridable for tests.
+	Now func() time.Time
+}
+
+// NewHandler builds a Handler over the services of c.
+func NewHandler(c *services.Container) (*Handler, error) {
+	db, err := c.DB()
+	if err != nil {
+		return nil, err
+	}
+	users, err := c.Users()
+	if err != nil && err != services.ErrLocal {
+		return nil, err
+	}
+	return &Handler{DB: db, Users: users, Now: time.Now}, nil
+}
+
+// Statement is the deployed HTTP entry point, over the default services:
+//
+//	GET ?group={groupId}
+//	Authorization: Bearer {Firebase ID token}
+//
+// answering the ledger of the group as JSON, to its members only.
+func Statement(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	h, err := NewHandler(services.Default())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer telemetry.Flush(r.Context())
+	h.ServeHTTP(w, r)
+}
+
+// Summary is the deployed entry point, over the default services.
+func Summary(
+	ctx context.Context,
+	m trigger.PubSubMessage,
+) error {
+	h, err := NewHandler(services.Default())
+	if err != nil {
+		return err
+	}
+	return trigger.Run(ctx, "summary", func(ctx context.Context) error {
+		return h.Summary(ctx, m)
+	})
+}
+
+func (h *Handler) ServeHTTP(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	groupId := r.URL.Query().Get("group")
+	ctx := logging.ForEvent(r.Context(), "statement", schema.Groups+"/"+groupId)
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if groupId == "" {
+		http.Error(w, "statement: no group given", http.StatusBadRequest)
+		return
+	}
+
+	var l *ledger.Ledger
+	status := http.StatusOK
+	err := telemetry.Handle(ctx, "handler.statement", func(ctx context.Context) error {
+		uid, err := h.authenticate(ctx, r)
+		if err != nil {
+			status = http.StatusUnauthorized
+			return err
+		}
+		ctx = logging.WithUsers(ctx, uid)
+		g, err := h.DB.GetGroup(ctx, groupId)
+		if err != nil {
+			return err
+		}
+		// Strangers learn no more than that the group does not exist.
+		if _, ok := g.Member(uid); !ok {
+			status = http.StatusNotFound
+			return datastore.NewError(datastore.ErrNotFound, "statement: %v is not a member of %v", uid, groupId)
+		}
+		l, err = ledger.Compute(ctx, h.DB, groupId)
+		return err
+	})
+	if err != nil {
+		if status == http.StatusOK {
+			status = http.StatusInternalServerError
+			if errors.Is(err, datastore.ErrNotFound) {
+				status = http.StatusNotFound
+			}
+		}
+		logging.Warning(ctx, "Could not serve statement", "status", status, "error", err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l)
+}
+
+// authenticate verifies the ID token r bears, returning whose it is.
+func (h *Handler) authenticate(
+	ctx context.Context,
+	r *http.Request,
+) (string, error) {
+	if h.Users == nil {
+		return "", errors.New("statement: no users to verify tokens against")
+	}
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", errors.New("statement: no bearer token")
+	}
+	token, err := h.Users.VerifyIDToken(ctx, strings.TrimPrefix(header, "Bearer "))
+	if err != nil {
+		return "", err
+	}
+	return token.UID, nil
+}
+
+// Summary tells every member of every group how many of their
+// requests there are still open. Meant to run on a schedule through
+// Pub/Sub, at most once a day counts, later runs enqueue nothing new.
+// Groups failing are retried on the next delivery, the others are not.
+func (h *Handler) Summary(
+	ctx context.Context,
+	m trigger.PubSubMessage,
+) error {
+	ctx = logging.ForEvent(ctx, "summary", "")
+	groups, err := h.DB.ListGroups(ctx)
+	if err != nil {
+		return err
+	}
+	now := h.Now()
+	var failed error
+	for _, g := range groups {
+		if err := h.summarize(ctx, g, now); err != nil {
+			logging.Error(ctx, "Could not summarize group", "group", g.Id, "error", err)
+			failed = err
+		}
+	}
+	return failed
+}
+
+func (h *Handler) summarize(
+	ctx context.Context,
+	g *datastore.Group,
+	now time.Time,
+) error {
+	l, err := ledger.Compute(ctx, h.DB, g.Id)
+	if err != nil {
+		return err
+	}
+	var notifications []*datastore.Notification
+	for _, id := range g.ProfileIds() {
+		if b := l.Member(id); b != nil && b.Open > 0 {
+			notifications = append(
+				notifications,
+				outbox.NewSummary(ctx, id, g, b.Open, now),
+			)
+		}
+	}
+	logging.Debug(ctx, "Summarized group", "group", g.Id, "notified", len(notifications))
+	if len(notifications) == 0 {
+		return nil
+	}
+	return h.DB.AddNotifications(ctx, notifications)
+}
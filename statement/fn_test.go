@@ -0,0 +1,128 @@
+package statement
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/auth"
+
+	"github.com/Seriyin/GiveMeBackend/config/datastore"
+	"github.com/Seriyin/GiveMeBackend/config/datastore/datastoretest"
+	"github.com/Seriyin/GiveMeBackend/config/firebase/messaging"
+	"github.com/Seriyin/GiveMeBackend/config/ledger"
+	"github.com/Seriyin/GiveMeBackend/config/trigger"
+)
+
+// tokens verifies tokens named after the uid they stand for.
+type tokens struct{}
+
+func (tokens) GetUser(ctx context.Context, uid string) (*auth.UserRecord, error) {
+	return nil, errors.New("not needed")
+}
+
+func (tokens) VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error) {
+	if idToken == "" || idToken == "forged" {
+		return nil, errors.New("invalid token")
+	}
+	return &auth.Token{UID: idToken}, nil
+}
+
+func setup(t *testing.T) *Handler {
+	ctx := context.Background()
+	db := datastore.NewMemoryDB()
+	datastoretest.AddProfiles(t, ctx, db,
+		datastore.UID{Id: "a", Phone: "+351111111111"},
+		datastore.UID{Id: "b", Phone: "+351222222222"},
+		datastore.UID{Id: "z", Phone: "+351999999999"},
+	)
+	_, err := db.AddGroup(ctx, &datastore.Group{
+		Id:   "trip",
+		Name: "Trip",
+		Members: []datastore.GroupMember{
+			{ProfileId: "a", Role: datastore.RoleAdmin},
+			{ProfileId: "b", Role: datastore.RoleMember},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMirroredMonetaryRequest(ctx, &datastore.MonetaryRequest{
+		From:       "+351111111111",
+		To:         "+351222222222",
+		AmountUnit: 5,
+		Currency:   "€",
+		Snowflake:  "s1",
+		Group:      "trip",
+	}, "MonetaryRequests/a/2019-02", "MonetaryRequests/b/2019-02", nil)
+	return &Handler{
+		DB:    db,
+		Users: tokens{},
+		Now:   func() time.Time { return time.Date(2019, 2, 13, 9, 0, 0, 0, time.UTC) },
+	}
+}
+
+func TestStatement(t *testing.T) {
+	h := setup(t)
+	get := func(group string, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/?group="+group, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("trip", "b")
+	if w.Code != http.StatusOK {
+		t.Fatal(w.Code, w.Body)
+	}
+	var l ledger.Ledger
+	if err := json.NewDecoder(w.Body).Decode(&l); err != nil {
+		t.Fatal(err)
+	}
+	if l.Name != "Trip" || l.Member("b").Payable["€"] != 500 || len(l.Outstanding) != 1 {
+		t.Errorf("%+v", l)
+	}
+
+	for _, c := range []struct {
+		group string
+		token string
+		code  int
+	}{
+		{"trip", "", http.StatusUnauthorized},
+		{"trip", "forged", http.StatusUnauthorized},
+		{"trip", "z", http.StatusNotFound},
+		{"none", "a", http.StatusNotFound},
+		{"", "a", http.StatusBadRequest},
+	} {
+		if w := get(c.group, c.token); w.Code != c.code {
+			t.Errorf("%+v: %v", c, w.Code)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	h := setup(t)
+	ctx := context.Background()
+	// Scheduled twice the same day.
+	for i := 0; i < 2; i++ {
+		if err := h.Summary(ctx, trigger.PubSubMessage{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	due, _ := h.DB.GetDueNotifications(ctx, time.Now(), 10)
+	if len(due) != 2 {
+		t.Fatalf("%+v", due)
+	}
+	for _, n := range due {
+		if n.Action != messaging.ActionGroupSummary || n.Members != 1 || n.Name != "Trip" {
+			t.Errorf("%+v", n)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+module github.com/Seriyin/GiveMeBackend/statement
+
+require (
+	github.com/Seriyin/GiveMeBackend/config v0.0.0-20190213115352-2bf309bf9f90
+	github.com/googleapis/gax-go v2.0.2+incompatible // indirect
+)